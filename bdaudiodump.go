@@ -21,340 +21,212 @@ package main
 
 import (
 	"bdaudiodump/libbdaudiodump"
+	"context"
+	"errors"
 	"flag"
-	"math"
+	"io"
+	"log/slog"
 	"os"
-	"path/filepath"
-	"strconv"
+	"os/signal"
+	"strings"
+	"syscall"
 )
 
+type logFlags struct {
+	logLevel  *string
+	logFormat *string
+	logFile   *string
+}
+
 func main() {
-	// Parse CLI options
-	makemkvconDiscId := flag.Int("makemkvcon-disc-id", math.MaxInt, "The disc ID (for the disc: identifier) to pass to makemkvcon")
-	outputDirectory := flag.String("output-directory", "", "The directory to store output in")
-	volumeKeySha1 := flag.String("volume-key-sha1", "", "Use the specified SHA1 sum for detecting the disc instead of analyzing it")
-	replaceSpacesWithUnderscores := flag.Bool("replace-spaces-with-underscores", true, "Replace spaces with underscores in FLAC files and directory")
-	mkvSourcePath := flag.String("mkv-source-path", "", "Path to pre-extracted MKV files")
-	copyDiscBeforeMkvExtraction := flag.Bool("copy-disc-before-mkv-extraction", true, "Copy disc contents to destination before MKV extraction")
-	audioStreamType := flag.String("audio-stream-type", "", "Audio stream type (best, surround71, surround51, stereo21, or stereo20)")
-	configPath := flag.String("config-path", "", "An explicit path to a configuration JSON file")
-	discBasePath := flag.String("disc-base-path", "", "The base path to the mounted disc")
-	coverArtFullPath := flag.String("cover-art-full-path", "", "An explicit path to a cover art file")
-
-	flag.Parse()
-
-	if *outputDirectory == "" {
+	ctx, stopNotify := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+
+	// Once cleanup has started, a second interrupt kills the process immediately
+	go func() {
+		<-ctx.Done()
+		stopNotify()
+	}()
+
+	exitCode := runCommand(ctx, os.Args[1:])
+	stopNotify()
+	os.Exit(exitCode)
+}
+
+// runCommand runs the subcommand named by the first argument.  Arguments that start with a
+// flag are passed to rip, so command lines from before subcommands existed still work.
+func runCommand(ctx context.Context, args []string) int {
+	if len(args) == 0 {
 		printUsage()
-		os.Exit(1)
+		return 1
 	}
 
-	if *makemkvconDiscId == math.MaxInt && *mkvSourcePath == "" {
-		printUsage()
-		os.Exit(1)
+	if strings.HasPrefix(args[0], "-") {
+		return runRip(ctx, args)
 	}
 
-	if *audioStreamType != "" {
-		if *audioStreamType != "best" && *audioStreamType != "surround71" && *audioStreamType != "surround51" && *audioStreamType != "stereo21" && *audioStreamType != "stereo20" {
-			printUsage()
-			os.Exit(1)
-		}
+	switch args[0] {
+	case "rip":
+		return runRip(ctx, args[1:])
+	case "identify":
+		return runIdentify(ctx, args[1:])
+	case "probe":
+		return runProbe(ctx, args[1:])
+	case "validate":
+		return runValidate(ctx, args[1:])
+	case "list":
+		return runList(ctx, args[1:])
+	case "config":
+		return runConfig(ctx, args[1:])
+	case "drives":
+		return runDrives(ctx, args[1:])
+	case "serve":
+		return runServe(ctx, args[1:])
+	case "watch":
+		return runWatch(ctx, args[1:])
+	case "help":
+		printUsage()
+		return 0
 	}
 
-	var parsedConfig *[]libbdaudiodump.BluRayDiscConfig
-	var err error
+	println("Unknown command: " + args[0])
+	println("")
+	printUsage()
+	return 1
+}
 
-	if *configPath != "" {
-		parsedConfig, err = libbdaudiodump.ReadConfigFile(*configPath)
-		if err != nil {
-			println("Error loading config from: " + *configPath)
-			println(err.Error())
-			os.Exit(1)
-		}
-	} else {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			println("Unable to get your home directory to read config from")
-			os.Exit(1)
-		}
-		parsedConfig, err = libbdaudiodump.ReadConfigFile(homeDir + string(os.PathSeparator) + ".config" + string(os.PathSeparator) + "bdaudiodump_config.json")
-		if err != nil {
-			println("Unable to open config file at default location: " + homeDir + string(os.PathSeparator) + ".config" + string(os.PathSeparator) + "bdaudiodump_config.json")
-			os.Exit(1)
-		}
+func addLogFlags(flagSet *flag.FlagSet) logFlags {
+	return logFlags{
+		logLevel:  flagSet.String("log-level", "info", "The minimum level of log messages to write (debug, info, warn, or error)"),
+		logFormat: flagSet.String("log-format", "text", "The format of log messages (text or json)"),
+		logFile:   flagSet.String("log-file", "", "A file to append log messages to instead of writing them to stderr"),
 	}
+}
 
-	var discVolumeKeySha1Hash string
-	var discMountPoint string
+// stringListFlag collects every value of a flag that can be given more than once
+type stringListFlag []string
 
-	if *discBasePath != "" {
-		println("Using disc base path from CLI for filesystem access: " + *discBasePath)
-		discMountPoint = *discBasePath
-	} else if *mkvSourcePath == "" {
-		println("Detecting volume mount point for disc")
-		discMountPoint, err = libbdaudiodump.GetMountPointForMakemkvconDiscId(*makemkvconDiscId)
-		if err != nil {
-			println("Error detecting volume mount point")
-			println(err.Error())
-			os.Exit(1)
-		}
+func (listFlag *stringListFlag) String() string {
+	return strings.Join(*listFlag, ", ")
+}
+
+func (listFlag *stringListFlag) Set(value string) error {
+	*listFlag = append(*listFlag, value)
+	return nil
+}
+
+func addConfigPathFlag(flagSet *flag.FlagSet, configPaths *[]string) {
+	flagSet.Var((*stringListFlag)(configPaths), "config-path", "A configuration JSON file or a directory of them, which can be given more than once")
+}
+
+// getFlagParseExitCode returns success if parsing stopped because help was requested
+func getFlagParseExitCode(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
 	}
 
-	var discConfig *libbdaudiodump.BluRayDiscConfig
+	return 1
+}
 
-	if *volumeKeySha1 != "" {
-		println("Using volume key SHA1 hash from CLI parameters: " + *volumeKeySha1)
-		discVolumeKeySha1Hash = *volumeKeySha1
+// setUpLogging attaches a logger configured by the log flags to the context.  The returned
+// function closes the log file, if one was opened.
+func setUpLogging(ctx context.Context, logOptions logFlags) (context.Context, *slog.Logger, func(), error) {
+	parsedLogLevel, err := libbdaudiodump.ParseLogLevel(*logOptions.logLevel)
+	if err != nil {
+		return ctx, nil, nil, err
+	}
 
-		println("Looking up disc volume key SHA1 hash: " + discVolumeKeySha1Hash)
+	logWriter := io.Writer(os.Stderr)
+	closeLogFile := func() {}
 
-		discConfig, err = libbdaudiodump.GetDiscConfigByVolumeKeySha1Hash(discVolumeKeySha1Hash, parsedConfig)
-	} else {
-		println("Getting disc volume key SHA1 hash from disc")
-		discVolumeKeySha1Hash, err = libbdaudiodump.GetDiscVolumeKeySha1Hash(discMountPoint)
+	if *logOptions.logFile != "" {
+		openedLogFile, err := os.OpenFile(*logOptions.logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 		if err != nil {
-			println("Error getting disc volume key SHA1 hash from makemkvcon")
-			println(err.Error())
-			os.Exit(1)
+			return ctx, nil, nil, errors.New("unable to open log file: " + *logOptions.logFile + ": " + err.Error())
+		}
+		logWriter = openedLogFile
+		closeLogFile = func() {
+			openedLogFile.Close()
 		}
-
-		println("Looking up disc volume key SHA1 hash: " + discVolumeKeySha1Hash)
-
-		discConfig, err = libbdaudiodump.GetDiscConfigByVolumeKeySha1HashFromKeyFile(discMountPoint, parsedConfig)
 	}
 
+	logger, err := libbdaudiodump.NewLogger(logWriter, parsedLogLevel, *logOptions.logFormat)
 	if err != nil {
-		println("Unable to find matching disc in config")
-		println(err.Error())
-		os.Exit(1)
+		closeLogFile()
+		return ctx, nil, nil, err
 	}
 
-	println("Found matching disc in config: " + discConfig.BluRayTitle)
-
-	var mkvPath string
-	var mkvBasePath string
-
-	if *mkvSourcePath == "" {
-		if *copyDiscBeforeMkvExtraction {
-			println("Creating temp directory for disc copy")
-			discCopyTempDir, err := os.MkdirTemp(*outputDirectory, "discFiles")
-			if err != nil {
-				println("Error creating temporary directory for disc copy")
-				println(err.Error())
-				os.Exit(1)
-			}
-
-			println("Created temp directory: " + discCopyTempDir)
-			println("Copying disc to temp directory")
-
-			err = libbdaudiodump.BackupDisc(*makemkvconDiscId, discCopyTempDir)
-			if err != nil {
-				os.RemoveAll(discCopyTempDir)
-				println("Error copying disc contents to temp directory")
-				println(err.Error())
-				os.Exit(1)
-			}
-
-			println("Creating temp directory for MKV files")
-
-			mkvBasePath, err = os.MkdirTemp(*outputDirectory, "mkvFiles")
-			if err != nil {
-				os.RemoveAll(discCopyTempDir)
-				println("Error creating temp directory for MKV files")
-				println(err.Error())
-				os.Exit(1)
-			}
-
-			defer os.RemoveAll(mkvBasePath)
-
-			println("Dumping copied disc to MKV files in: " + mkvBasePath)
-
-			err = libbdaudiodump.ExtractMkvFromBackup(discCopyTempDir, mkvBasePath)
-			if err != nil {
-				os.RemoveAll(discCopyTempDir)
-				println("Error extracting MKVs from disc copy")
-				println(err.Error())
-				os.Exit(1)
-			}
-
-			println("Cleaning up copied disc files")
-
-			os.RemoveAll(discCopyTempDir)
-		} else {
-			println("Creating temp directory for MKV files")
-
-			mkvBasePath, err = os.MkdirTemp(*outputDirectory, "mkvFiles")
-			if err != nil {
-				println("Error creating temp directory for MKV files")
-				println(err.Error())
-				os.Exit(1)
-			}
-
-			defer os.RemoveAll(mkvBasePath)
-
-			println("Dumping copied disc to MKV files in: " + mkvBasePath)
-
-			err = libbdaudiodump.ExtractDiscToMkv(*makemkvconDiscId, mkvBasePath)
-			if err != nil {
-				println("Error using makemkv to extract disc.")
-				println(err.Error())
-				os.Exit(1)
-			}
-		}
+	return libbdaudiodump.WithLogger(ctx, logger), logger, closeLogFile, nil
+}
 
-		firstAlbum, firstDisc, firstTrack, err := libbdaudiodump.GetFirstAlbumDiscTrack(*discConfig)
+// loadConfig reads and merges the configs in configPaths, or from the default locations if
+// there aren't any.  Errors are logged here, so callers only need to exit.
+func loadConfig(logger *slog.Logger, configPaths []string) (*[]libbdaudiodump.BluRayDiscConfig, error) {
+	if len(configPaths) == 0 {
+		defaultConfigPaths, err := getDefaultConfigPaths()
 		if err != nil {
-			println("Error getting first album, disc, and track for BluRay disc")
-			println(err.Error())
-			os.Exit(1)
+			logger.Error("Unable to get your home directory to read config from")
+			return nil, err
 		}
 
-		mkvPath, err = libbdaudiodump.GetMkvPathByTrackNumber(mkvBasePath, firstAlbum.AlbumNumber, firstDisc.DiscNumber, firstTrack.TrackNumber, *discConfig)
+		parsedConfig, err := libbdaudiodump.ReadConfigPaths(defaultConfigPaths)
 		if err != nil {
-			println("Error setting MKV destination path.")
-			println(err.Error())
-			os.Exit(1)
+			logError(logger, "Unable to open config file at default location", err, "path", strings.Join(defaultConfigPaths, ", "))
+			return nil, err
 		}
 
-		mkvPath = filepath.Dir(mkvPath)
+		return parsedConfig, nil
+	}
 
-		println("Finished dumping disc.")
-	} else {
-		println("Using MKV path from CLI parameters: " + *mkvSourcePath)
-		mkvPath = *mkvSourcePath
+	parsedConfig, err := libbdaudiodump.ReadConfigPaths(configPaths)
+	if err != nil {
+		logError(logger, "Error loading config", err, "path", strings.Join(configPaths, ", "))
+		return nil, err
 	}
 
-	println("Running ffprobe on generated MKVs.")
+	return parsedConfig, nil
+}
 
-	ffProbeData, err := libbdaudiodump.GetFfprobeDataFromAllMkvs(mkvPath, *discConfig)
+// getDefaultConfigPaths returns ~/.config/bdaudiodump_config.json and ~/.config/bdaudiodump.d,
+// leaving out whichever doesn't exist.  If neither does, the config file is still returned so
+// the error says where it was expected.
+func getDefaultConfigPaths() ([]string, error) {
+	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		println("Error reading data from generated MKV files.")
-		println(err.Error())
-		os.Exit(1)
+		return nil, err
 	}
 
-	println("Finished collecting ffprobe data.")
-
-	println("Processing albums.")
-
-	for _, album := range discConfig.Albums {
-		println("Processing album: " + album.AlbumTitle)
-
-		var coverArtPath string
-		var fullCoverArtDestinationPath string
-
-		if *coverArtFullPath != "" {
-			println("Copying cover art.")
-			coverArtPath = libbdaudiodump.GetCoverArtDestinationPath(*outputDirectory, *discConfig, album, *replaceSpacesWithUnderscores)
-			println("Cover art source: " + *coverArtFullPath)
-			println("Cover art destination: " + coverArtPath)
-			fullCoverArtDestinationPath, err = libbdaudiodump.CopyCoverImageFromFileToDestinationDirectory(*coverArtFullPath, coverArtPath)
-			if err != nil {
-				println("Error copying cover art to destination.")
-				println(err.Error())
-				os.Exit(1)
-			}
-			println("Cover art copied.")
-		} else if discMountPoint != "" {
-			println("Copying cover art.")
-			coverArtPath = libbdaudiodump.GetCoverArtDestinationPath(*outputDirectory, *discConfig, album, *replaceSpacesWithUnderscores)
-			expandedCoverArtSourcePath := libbdaudiodump.GetExpandedCoverArtSourcePath(discMountPoint, album)
-			if album.CoverType == "plain" {
-				println("Cover art source: " + expandedCoverArtSourcePath)
-				println("Cover art destination: " + coverArtPath)
-				fullCoverArtDestinationPath, err = libbdaudiodump.CopyCoverImageFromFileToDestinationDirectory(expandedCoverArtSourcePath, coverArtPath)
-				if err != nil {
-					println("Error copying cover art to destination.")
-					println(err.Error())
-					os.Exit(1)
-				}
-			} else if album.CoverType == "zip" {
-				println("Cover art ZIP file: " + expandedCoverArtSourcePath)
-				println("File in ZIP to copy from: " + album.CoverRelativePath)
-				println("Cover art destination: " + coverArtPath)
-				fullCoverArtDestinationPath, err = libbdaudiodump.CopyCoverImageFromZipFileToDestinationDirectory(discMountPoint, album, coverArtPath)
-				if err != nil {
-					println("Error copying cover art to destination.")
-					println(err.Error())
-					os.Exit(1)
-				}
-			} else if album.CoverType == "mp3" {
-				println("Cover art source (extracting from MP3): " + expandedCoverArtSourcePath)
-				println("Cover art destination: " + coverArtPath)
-				fullCoverArtDestinationPath, err = libbdaudiodump.CopyCoverImageFromMp3FileToDestinationDirectory(discMountPoint, album, coverArtPath)
-				if err != nil {
-					println("Error copying cover art to destination.")
-					println(err.Error())
-					os.Exit(1)
-				}
-			} else if album.CoverType == "zip_mp3" {
-				println("Cover art ZIP file: " + expandedCoverArtSourcePath)
-				println("File in ZIP to copy from (extracting from MP3): " + album.CoverRelativePath)
-				println("Cover art destination: " + coverArtPath)
-				fullCoverArtDestinationPath, err = libbdaudiodump.CopyCoverImageFromZippedMp3FileToDestinationDirectory(discMountPoint, album, coverArtPath)
-				if err != nil {
-					println("Error copying cover art to destination.")
-					println(err.Error())
-					os.Exit(1)
-				}
-			} else if album.CoverType == "url" {
-				println("Cover art URL: " + album.CoverUrl)
-				println("Cover art destination: " + coverArtPath)
-				fullCoverArtDestinationPath, err = libbdaudiodump.CopyCoverImageFromUrlToDestinationDirectory(album.CoverUrl, coverArtPath)
-				if err != nil {
-					println("Error copying cover art to destination.")
-					println(err.Error())
-					os.Exit(1)
-				}
-			}
-			println("Cover art copied.")
+	configDir := homeDir + string(os.PathSeparator) + ".config" + string(os.PathSeparator)
+	defaultConfigPaths := make([]string, 0)
+
+	for _, defaultConfigPath := range []string{configDir + "bdaudiodump_config.json", configDir + "bdaudiodump.d"} {
+		if _, err := os.Stat(defaultConfigPath); err == nil {
+			defaultConfigPaths = append(defaultConfigPaths, defaultConfigPath)
 		}
+	}
+
+	if len(defaultConfigPaths) == 0 {
+		defaultConfigPaths = append(defaultConfigPaths, configDir+"bdaudiodump_config.json")
+	}
+
+	return defaultConfigPaths, nil
+}
 
-		println("Processing discs for album: " + album.AlbumTitle)
-
-		for _, disc := range album.Discs {
-			println("Processing disc " + strconv.Itoa(disc.DiscNumber) + " for album: " + album.AlbumTitle)
-
-			for _, track := range disc.Tracks {
-				println("Extracting track: " + strconv.Itoa(track.TrackNumber))
-				err = libbdaudiodump.ExtractFlacFromMkv(mkvPath, *outputDirectory, album.AlbumNumber, disc.DiscNumber, track.TrackNumber, ffProbeData, *discConfig, *audioStreamType, *replaceSpacesWithUnderscores)
-				if err != nil {
-					println("Error extracting FLAC from MKV.")
-					println(err.Error())
-					os.Exit(1)
-				}
-
-				println("Getting path for track: " + strconv.Itoa(track.TrackNumber))
-
-				flacPath, err := libbdaudiodump.GetFlacPathByTrackNumber(*outputDirectory, album.AlbumNumber, disc.DiscNumber, track.TrackNumber, *discConfig, *replaceSpacesWithUnderscores)
-				if err != nil {
-					println("Error getting FLAC output path.")
-					println(err.Error())
-					os.Exit(1)
-				}
-
-				println("Compressing track: " + flacPath)
-
-				err = libbdaudiodump.CompressFlac(flacPath)
-				if err != nil {
-					println("Error compressing FLAC file: " + flacPath)
-					println(err.Error())
-					os.Exit(1)
-				}
-
-				println("Tagging track: " + flacPath)
-
-				err = libbdaudiodump.TagFlac(*outputDirectory, album.AlbumNumber, disc.DiscNumber, track.TrackNumber, fullCoverArtDestinationPath, *discConfig, *replaceSpacesWithUnderscores)
-				if err != nil {
-					println("Error tagging FLAC file: " + flacPath)
-					println(err.Error())
-					os.Exit(1)
-				}
-
-				println("Finished processing track number: " + strconv.Itoa(track.TrackNumber))
-				println("Path: " + flacPath)
-			}
+// logError logs an error, plus the full command and the end of its output if an external tool failed
+func logError(logger *slog.Logger, message string, err error, args ...any) {
+	args = append(args, libbdaudiodump.LogKeyError, err.Error())
+
+	var toolError *libbdaudiodump.ToolError
+	if errors.As(err, &toolError) {
+		args = append(args, libbdaudiodump.LogKeyCommand, toolError.CommandLine())
+		if toolError.ExitCode >= 0 {
+			args = append(args, libbdaudiodump.LogKeyExitStatus, toolError.ExitCode)
+		}
+		if toolError.Output != "" {
+			args = append(args, "tool_output", strings.TrimRight(toolError.Output, "\n"))
 		}
 	}
+
+	logger.Error(message, args...)
 }
 
 func printUsage() {
@@ -362,54 +234,55 @@ func printUsage() {
 	println("Requires ffmpeg, ffprobe, and makemkvcon to be available on the user's path")
 	println("")
 	println("Usage:")
-	println("bdaudiodump [arguments]")
-	println("--makemkvcon-disc-id")
-	println("    Type: Integer")
-	println("    Required if not using an MKV source path. The disc ID")
-	println("    for the disc: identifier) to pass to makemkvcon.")
-	println("--output-directory")
-	println("    Type: String")
-	println("    Required. The directory to store output in.  FLAC files will be created")
-	println("    in a directory named for the disc.  Also, the directory will be used")
-	println("    for temporary files created as part of the process.")
-	println("--volume-key-sha1")
-	println("    Type: String")
-	println("    Skip detection of the SHA1 sum of /AACS/Unit_Key_RO.inf on the disc,")
-	println("    and use the specified SHA1 sum instead.")
-	println("--replace-spaces-with-underscores")
-	println("    Type: Boolean")
-	println("    Replace spaces in directory names and FLAC file names with underscores.")
-	println("    Defaults to true.")
-	println("--mkv-source-path")
-	println("    Type: String")
-	println("    Path to pre-extracted MKVs, if MakeMKV has already been used to rip")
-	println("    them from the disc.  Minimum segment length of 0 should be used for")
-	println("    pre-extractd MKV files.")
-	println("--copy-disc-before-mkv-extraction")
-	println("    Type: Boolean")
-	println("    Some discs cause frequent seeks during MKV extraction, causing extraction")
-	println("    to fail.  This works around that by copying the disc contents and key")
-	println("    information prior to MKV extraction.  Defaults to true.")
-	println("--audio-stream-type")
-	println("    Type: String")
-	println("    Some discs offer multiple audio streams of differing channel numbers,")
-	println("    such as stereo, 5.1, 7.1, etc.  This allows specifying which streams")
-	println("    to extract.  Valid values are: best, surround71, surround51,")
-	println("    stereo21, and stereo20.  If best is selected, the best available")
-	println("    version of each track as defined in the disc configuration will be")
-	println("    selected.  For all other options, if there is no matching version")
-	println("    for a given track, the default audio stream for that track will be")
-	println("    selected.")
+	println("bdaudiodump [command] [arguments]")
+	println("")
+	println("Commands:")
+	println("rip")
+	println("    Rip a disc to tagged FLAC files.  This is the default if the first")
+	println("    argument is a flag.")
+	println("identify")
+	println("    Hash /AACS/Unit_Key_RO.inf on a disc and show its entry in the config.")
+	println("probe")
+	println("    Show the titles and chapters in MKV files.")
+	println("validate")
+	println("    Check a config file for errors.")
+	println("list")
+	println("    List the discs in the config.")
+	println("config")
+	println("    Manage config files, such as migrating them to the latest version.")
+	println("drives")
+	println("    List the optical drives and the discs in them.")
+	println("serve")
+	println("    Run a local HTTP API that queues and runs rips.")
+	println("watch")
+	println("    Rip known discs automatically as they're inserted.")
+	println("")
+	println("Run bdaudiodump [command] --help to see the arguments for a command.")
+}
+
+func printConfigUsage() {
 	println("--config-path")
 	println("    Type: String")
-	println("    An explicit path to a disc configuration JSON file. If not specified,")
-	println("    it defaults to: ~/.config/bdaudiodump_config.json")
-	println("--disc-base-path")
+	println("    An explicit path to a disc configuration file (JSON, YAML, or TOML), or")
+	println("    a directory of them.  Can be given more than once, and the discs in")
+	println("    every file are merged.  If not specified, it defaults to both of these,")
+	println("    if they exist:")
+	println("    ~/.config/bdaudiodump_config.json")
+	println("    ~/.config/bdaudiodump.d/")
+}
+
+func printLogUsage() {
+	println("--log-level")
+	println("    Type: String")
+	println("    The minimum level of log messages to write.  Valid values are debug,")
+	println("    info, warn, and error.  At debug, every external command is logged")
+	println("    along with how long it took.  Defaults to info.")
+	println("--log-format")
 	println("    Type: String")
-	println("    The path to a mounted Blu-Ray disc, used for disc identification and")
-	println("    known cover art locations.  This overrides detected path locations.")
-	println("--cover-art-full-path")
+	println("    The format of log messages.  Valid values are text and json.")
+	println("    Defaults to text.")
+	println("--log-file")
 	println("    Type: String")
-	println("    An explicit path to a cover art file.  Overrides art locations")
-	println("    derived from the disc path.")
+	println("    A file to append log messages to.  If not specified, log messages")
+	println("    are written to stderr.")
 }
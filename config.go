@@ -0,0 +1,325 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bdaudiodump/libbdaudiodump"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// runConfig runs the config subcommand named by the first argument
+func runConfig(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		printConfigCommandUsage()
+		return 1
+	}
+
+	switch args[0] {
+	case "migrate":
+		return runConfigMigrate(ctx, args[1:])
+	case "convert":
+		return runConfigConvert(ctx, args[1:])
+	case "init":
+		return runConfigInit(ctx, args[1:])
+	case "help":
+		printConfigCommandUsage()
+		return 0
+	}
+
+	println("Unknown config command: " + args[0])
+	println("")
+	printConfigCommandUsage()
+	return 1
+}
+
+func runConfigMigrate(ctx context.Context, args []string) int {
+	flagSet := flag.NewFlagSet("config migrate", flag.ContinueOnError)
+	flagSet.Usage = printConfigMigrateUsage
+
+	configPaths := make([]string, 0)
+	addConfigPathFlag(flagSet, &configPaths)
+	logOptions := addLogFlags(flagSet)
+
+	err := flagSet.Parse(args)
+	if err != nil {
+		return getFlagParseExitCode(err)
+	}
+
+	_, logger, closeLogFile, err := setUpLogging(ctx, logOptions)
+	if err != nil {
+		println(err.Error())
+		printConfigMigrateUsage()
+		return 1
+	}
+	defer closeLogFile()
+
+	if len(configPaths) == 0 {
+		configPaths, err = getDefaultConfigPaths()
+		if err != nil {
+			logger.Error("Unable to get your home directory to read config from")
+			return 1
+		}
+	}
+
+	configFilePaths, err := libbdaudiodump.GetConfigFilePaths(configPaths)
+	if err != nil {
+		logError(logger, "Error reading config", err, "path", strings.Join(configPaths, ", "))
+		return 1
+	}
+
+	exitCode := 0
+	for _, configFilePath := range configFilePaths {
+		configVersion, err := libbdaudiodump.MigrateConfigFile(configFilePath)
+		if err != nil {
+			var configValidationError *libbdaudiodump.ConfigValidationError
+			if errors.As(err, &configValidationError) {
+				for _, configIssue := range configValidationError.Issues {
+					fmt.Println(configIssue.String())
+				}
+			}
+
+			logError(logger, "Unable to migrate config", err, "path", configFilePath)
+			exitCode = 1
+			continue
+		}
+
+		if configVersion == libbdaudiodump.CurrentConfigVersion {
+			fmt.Println(configFilePath + ": already version " + strconv.Itoa(configVersion))
+			continue
+		}
+
+		fmt.Println(configFilePath + ": migrated from version " + strconv.Itoa(configVersion) + " to " + strconv.Itoa(libbdaudiodump.CurrentConfigVersion) + ", original saved to " + configFilePath + ".bak")
+	}
+
+	return exitCode
+}
+
+func runConfigConvert(ctx context.Context, args []string) int {
+	flagSet := flag.NewFlagSet("config convert", flag.ContinueOnError)
+	flagSet.Usage = printConfigConvertUsage
+
+	inputPath := flagSet.String("input-path", "", "The config file to convert")
+	outputPath := flagSet.String("output-path", "", "The file to write the converted config to")
+	overwrite := flagSet.Bool("overwrite", false, "Replace the output file if it exists")
+	logOptions := addLogFlags(flagSet)
+
+	err := flagSet.Parse(args)
+	if err != nil {
+		return getFlagParseExitCode(err)
+	}
+
+	_, logger, closeLogFile, err := setUpLogging(ctx, logOptions)
+	if err != nil {
+		println(err.Error())
+		printConfigConvertUsage()
+		return 1
+	}
+	defer closeLogFile()
+
+	if *inputPath == "" || *outputPath == "" {
+		println("--input-path and --output-path are required")
+		printConfigConvertUsage()
+		return 1
+	}
+
+	err = libbdaudiodump.ConvertConfigFile(*inputPath, *outputPath, *overwrite)
+	if err != nil {
+		var configValidationError *libbdaudiodump.ConfigValidationError
+		if errors.As(err, &configValidationError) {
+			for _, configIssue := range configValidationError.Issues {
+				fmt.Println(configIssue.String())
+			}
+		}
+
+		logError(logger, "Unable to convert config", err, "path", *inputPath)
+		return 1
+	}
+
+	fmt.Println(*inputPath + ": converted to " + libbdaudiodump.GetConfigFormat(*outputPath) + " in " + *outputPath)
+	return 0
+}
+
+func runConfigInit(ctx context.Context, args []string) int {
+	flagSet := flag.NewFlagSet("config init", flag.ContinueOnError)
+	flagSet.Usage = printConfigInitUsage
+
+	mkvSourcePath := flagSet.String("mkv-source-path", "", "The directory of MKV files ripped from the disc")
+	volumeKeySha1 := flagSet.String("volume-key-sha1", "", "The SHA1 sum that identifies the disc")
+	discIdentifierType := flagSet.String("disc-identifier-type", "", "What the SHA1 sum is of (volume_key_sha1 or bdmv_content_sha1)")
+	outputPath := flagSet.String("output-path", "", "The file to write the draft config to")
+	overwrite := flagSet.Bool("overwrite", false, "Replace the output file if it exists")
+	logOptions := addLogFlags(flagSet)
+
+	err := flagSet.Parse(args)
+	if err != nil {
+		return getFlagParseExitCode(err)
+	}
+
+	ctx, logger, closeLogFile, err := setUpLogging(ctx, logOptions)
+	if err != nil {
+		println(err.Error())
+		printConfigInitUsage()
+		return 1
+	}
+	defer closeLogFile()
+
+	if *mkvSourcePath == "" || *volumeKeySha1 == "" {
+		println("--mkv-source-path and --volume-key-sha1 are required")
+		printConfigInitUsage()
+		return 1
+	}
+
+	mkvPaths, err := libbdaudiodump.GetMkvPathsInDirectory(*mkvSourcePath)
+	if err != nil {
+		logError(logger, "Unable to list MKV files", err, "path", *mkvSourcePath)
+		return 1
+	}
+
+	scaffold, err := libbdaudiodump.NewConfigScaffold(ctx, mkvPaths, strings.ToLower(*volumeKeySha1), *discIdentifierType)
+	if err != nil {
+		logError(logger, "Unable to draft config", err, "path", *mkvSourcePath)
+		return 1
+	}
+
+	if *outputPath == "" {
+		configData, err := scaffold.MarshalConfig(libbdaudiodump.ConfigFormatYaml)
+		if err != nil {
+			logError(logger, "Unable to draft config", err, "path", *mkvSourcePath)
+			return 1
+		}
+
+		fmt.Print(string(configData))
+		return 0
+	}
+
+	err = scaffold.WriteConfigFile(*outputPath, *overwrite)
+	if err != nil {
+		logError(logger, "Unable to write draft config", err, "path", *outputPath)
+		return 1
+	}
+
+	fmt.Println("Drafted " + strconv.Itoa(scaffold.DiscConfig.Albums[0].Discs[0].TotalTracks) + " tracks from " + strconv.Itoa(len(scaffold.Titles)) + " titles in " + *outputPath)
+	if libbdaudiodump.GetConfigFormat(*outputPath) == libbdaudiodump.ConfigFormatJson {
+		fmt.Println("Chapter timings written to " + libbdaudiodump.GetConfigScaffoldTitlesPath(*outputPath))
+	}
+	fmt.Println("Run bdaudiodump validate --config-path " + *outputPath + " to list the fields left to fill in")
+
+	return 0
+}
+
+func printConfigCommandUsage() {
+	println("Manages config files")
+	println("")
+	println("Usage:")
+	println("bdaudiodump config [command] [arguments]")
+	println("")
+	println("Commands:")
+	println("migrate")
+	println("    Rewrite config files in the latest config version.")
+	println("convert")
+	println("    Translate a config file between JSON, YAML, and TOML.")
+	println("init")
+	println("    Draft a config entry for a disc from its MKV files.")
+	println("")
+	println("Run bdaudiodump config [command] --help to see the arguments for a command.")
+}
+
+func printConfigMigrateUsage() {
+	println("Rewrites config files in the latest config version")
+	println("")
+	println("Usage:")
+	println("bdaudiodump config migrate [arguments]")
+	println("")
+	println("Each file is checked first, and files with errors aren't changed.  The")
+	println("original of each file that's rewritten is kept next to it with a .bak")
+	println("extension.  Older versions can still be read without migrating them.")
+	println("Files are rewritten in the format they're in, but comments in YAML and")
+	println("TOML files aren't kept.")
+	printConfigUsage()
+	printLogUsage()
+}
+
+func printConfigConvertUsage() {
+	println("Translates a config file between JSON, YAML, and TOML")
+	println("")
+	println("Usage:")
+	println("bdaudiodump config convert [arguments]")
+	println("")
+	println("The format of each file is picked by its extension (.json, .yaml, .yml, or")
+	println(".toml).  The input is checked first, and the output is written in the")
+	println("latest config version.  The converted config is read back and compared")
+	println("with the input before it's written, so only comments and formatting are")
+	println("lost.")
+	println("--input-path")
+	println("    Type: String")
+	println("    The config file to convert.  Required.")
+	println("--output-path")
+	println("    Type: String")
+	println("    The file to write the converted config to.  Required.")
+	println("--overwrite")
+	println("    Type: Boolean")
+	println("    Replace the output file if it already exists.")
+	printLogUsage()
+}
+
+func printConfigInitUsage() {
+	println("Drafts a config entry for a disc from the MKV files makemkvcon ripped from it")
+	println("")
+	println("Usage:")
+	println("bdaudiodump config init [arguments]")
+	println("")
+	println("Each MKV file is probed with ffprobe, and the draft has one album and")
+	println("disc with a track for every chapter of every title, in title order.  The")
+	println("makemkv_prefix is taken from the file names, and is also used as the")
+	println("Blu-ray and album titles.  Tracks are titled Track 1, Track 2, and so")
+	println("on.  In YAML and TOML, each track has a comment with its chapter's start,")
+	println("end, and duration.  For JSON, they're written as JSON next to the config,")
+	println("in a file with .chapters added to its name.  Fields that can't be worked")
+	println("out from the files, such as the album artist and cover, are left empty,")
+	println("so bdaudiodump validate lists what's left to fill in.  Titles that repeat")
+	println("chapters from other titles should be removed by hand.")
+	println("--mkv-source-path")
+	println("    Type: String")
+	println("    The directory of MKV files ripped from the disc, named the way")
+	println("    makemkvcon names them (<prefix>_t##.mkv).  Required.")
+	println("--volume-key-sha1")
+	println("    Type: String")
+	println("    The SHA1 sum of /AACS/Unit_Key_RO.inf (or BDMV content SHA1, for")
+	println("    discs without it) that identifies the disc.  bdaudiodump identify")
+	println("    shows it.  Required.")
+	println("--disc-identifier-type")
+	println("    Type: String")
+	println("    What --volume-key-sha1 is a hash of, volume_key_sha1 or")
+	println("    bdmv_content_sha1.  Defaults to volume_key_sha1.")
+	println("--output-path")
+	println("    Type: String")
+	println("    The file to write the draft to, in the format of its extension")
+	println("    (.json, .yaml, .yml, or .toml).  If not specified, the draft is")
+	println("    printed as YAML.")
+	println("--overwrite")
+	println("    Type: Boolean")
+	println("    Replace the output file if it already exists.")
+	printLogUsage()
+}
@@ -0,0 +1,29 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package config holds the disc config format schema, so it's built into the binary and the
+// tool validates configs against the same file editors use.
+package config
+
+import (
+	_ "embed"
+)
+
+//go:embed config_format_schema.json
+var FormatSchema []byte
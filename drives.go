@@ -0,0 +1,115 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bdaudiodump/libbdaudiodump"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+)
+
+func runDrives(ctx context.Context, args []string) int {
+	flagSet := flag.NewFlagSet("drives", flag.ContinueOnError)
+	flagSet.Usage = printDrivesUsage
+
+	configPaths := make([]string, 0)
+	addConfigPathFlag(flagSet, &configPaths)
+	logOptions := addLogFlags(flagSet)
+
+	err := flagSet.Parse(args)
+	if err != nil {
+		return getFlagParseExitCode(err)
+	}
+
+	ctx, logger, closeLogFile, err := setUpLogging(ctx, logOptions)
+	if err != nil {
+		println(err.Error())
+		printDrivesUsage()
+		return 1
+	}
+	defer closeLogFile()
+
+	parsedConfig, err := loadConfig(logger, configPaths)
+	if err != nil {
+		return 1
+	}
+
+	opticalDevices, err := libbdaudiodump.GetOpticalDevices(ctx)
+	if err != nil {
+		logError(logger, "Error listing drives", err)
+		return 1
+	}
+
+	if len(opticalDevices) == 0 {
+		fmt.Println("No optical drives found")
+		return 0
+	}
+
+	for i, opticalDevice := range opticalDevices {
+		if i > 0 {
+			fmt.Println("")
+		}
+
+		fmt.Println(opticalDevice.DevicePath)
+
+		if opticalDevice.MountPoint == "" {
+			fmt.Println("    No disc mounted")
+			continue
+		}
+
+		fmt.Println("    Mount point: " + opticalDevice.MountPoint)
+		fmt.Println("    Disc label: " + opticalDevice.DiscLabel)
+
+		discIdentifiers, err := libbdaudiodump.GetDiscIdentifiers(opticalDevice.MountPoint)
+		if err != nil {
+			logger.Debug("Unable to identify disc", libbdaudiodump.LogKeyError, err.Error(), "path", opticalDevice.MountPoint)
+			fmt.Println("    Disc identifiers: unavailable (not a Blu-ray disc?)")
+			continue
+		}
+
+		for _, discIdentifier := range discIdentifiers {
+			fmt.Println("    " + getDiscIdentifierDescription(discIdentifier.Type) + ": " + discIdentifier.Value)
+		}
+
+		discConfig, _, err := libbdaudiodump.GetDiscConfigByIdentifiers(ctx, discIdentifiers, parsedConfig)
+		if errors.Is(err, libbdaudiodump.ErrUnknownDiscHash) {
+			fmt.Println("    Blu-ray title: not in config")
+		} else if err != nil {
+			logError(logger, "Error looking up disc in config", err)
+			return 1
+		} else {
+			fmt.Println("    Blu-ray title: " + discConfig.BluRayTitle)
+		}
+	}
+
+	return 0
+}
+
+func printDrivesUsage() {
+	println("Lists the optical drives, where their discs are mounted, and which")
+	println("discs in the config they hold")
+	println("")
+	println("Usage:")
+	println("bdaudiodump drives [arguments]")
+	printConfigUsage()
+	printLogUsage()
+}
@@ -1,7 +1,9 @@
 module bdaudiodump
 
-go 1.20
+go 1.21
 
 require (
-	github.com/dhowden/tag v0.0.0-20230630033851-978a0926ee25 // indirect
+	github.com/dhowden/tag v0.0.0-20230630033851-978a0926ee25
+	github.com/pelletier/go-toml/v2 v2.2.2
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,156 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bdaudiodump/libbdaudiodump"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+)
+
+func runIdentify(ctx context.Context, args []string) int {
+	flagSet := flag.NewFlagSet("identify", flag.ContinueOnError)
+	flagSet.Usage = printIdentifyUsage
+
+	makemkvconDiscId := flagSet.Int("makemkvcon-disc-id", math.MaxInt, "The disc ID (for the disc: identifier) to pass to makemkvcon")
+	device := flagSet.String("device", "", "The device path of the drive the disc is in, such as /dev/sr0")
+	discBasePath := flagSet.String("disc-base-path", "", "The base path to the mounted disc")
+	volumeKeySha1 := flagSet.String("volume-key-sha1", "", "Look up the specified SHA1 sum instead of analyzing a disc")
+	configPaths := make([]string, 0)
+	addConfigPathFlag(flagSet, &configPaths)
+	logOptions := addLogFlags(flagSet)
+
+	err := flagSet.Parse(args)
+	if err != nil {
+		return getFlagParseExitCode(err)
+	}
+
+	if *makemkvconDiscId == math.MaxInt && *device == "" && *discBasePath == "" && *volumeKeySha1 == "" {
+		printIdentifyUsage()
+		return 1
+	}
+
+	ctx, logger, closeLogFile, err := setUpLogging(ctx, logOptions)
+	if err != nil {
+		println(err.Error())
+		printIdentifyUsage()
+		return 1
+	}
+	defer closeLogFile()
+
+	parsedConfig, err := loadConfig(logger, configPaths)
+	if err != nil {
+		return 1
+	}
+
+	// A hash from the command line could be for any identifier type
+	discIdentifiers := []libbdaudiodump.DiscIdentifier{{Value: *volumeKeySha1}}
+
+	if *volumeKeySha1 == "" {
+		discMountPoint := *discBasePath
+		if discMountPoint == "" && *device != "" {
+			logger.Info("Detecting volume mount point for device", "device", *device)
+			discMountPoint, err = libbdaudiodump.GetMountPointForDevice(ctx, *device)
+			if err != nil {
+				logError(logger, "Error detecting volume mount point", err)
+				return 1
+			}
+		} else if discMountPoint == "" {
+			logger.Info("Detecting volume mount point for disc")
+			discMountPoint, err = libbdaudiodump.GetMountPointForMakemkvconDiscId(ctx, *makemkvconDiscId)
+			if err != nil {
+				logError(logger, "Error detecting volume mount point", err)
+				return 1
+			}
+		}
+
+		discIdentifiers, err = libbdaudiodump.GetDiscIdentifiers(discMountPoint)
+		if err != nil {
+			logError(logger, "Error identifying disc", err, "path", discMountPoint)
+			return 1
+		}
+	}
+
+	for _, discIdentifier := range discIdentifiers {
+		fmt.Println(getDiscIdentifierDescription(discIdentifier.Type) + ": " + discIdentifier.Value)
+	}
+
+	discConfig, _, err := libbdaudiodump.GetDiscConfigByIdentifiers(ctx, discIdentifiers, parsedConfig)
+	if err != nil {
+		logError(logger, "Unable to find matching disc in config", err)
+		return 1
+	}
+
+	discConfigJson, err := json.MarshalIndent(discConfig, "", "    ")
+	if err != nil {
+		logError(logger, "Error formatting config entry", err)
+		return 1
+	}
+
+	fmt.Println("Blu-ray title: " + discConfig.BluRayTitle)
+	if discConfig.VariantName != "" {
+		fmt.Println("Variant: " + discConfig.VariantName)
+	}
+	if discConfig.CatalogNumber != "" {
+		fmt.Println("Catalog number: " + discConfig.CatalogNumber)
+	}
+	fmt.Println("Config entry:")
+	fmt.Println(string(discConfigJson))
+
+	return 0
+}
+
+func getDiscIdentifierDescription(discIdentifierType string) string {
+	switch discIdentifierType {
+	case libbdaudiodump.DiscIdentifierTypeBdmvContentSha1:
+		return "BDMV content SHA1"
+	default:
+		return "Volume key SHA1"
+	}
+}
+
+func printIdentifyUsage() {
+	println("Identifies a Blu-Ray disc and shows its entry in the config")
+	println("")
+	println("Usage:")
+	println("bdaudiodump identify [arguments]")
+	println("--makemkvcon-disc-id")
+	println("    Type: Integer")
+	println("    The disc ID (for the disc: identifier) makemkvcon uses for the drive")
+	println("    the disc is in.  Used to find where the disc is mounted.")
+	println("--device")
+	println("    Type: String")
+	println("    The device path of the drive the disc is in, such as /dev/sr0.")
+	println("    Used to find where the disc is mounted without makemkvcon.")
+	println("--disc-base-path")
+	println("    Type: String")
+	println("    The path to a mounted Blu-Ray disc.  Overrides the detected mount")
+	println("    point.")
+	println("--volume-key-sha1")
+	println("    Type: String")
+	println("    Look up the specified SHA1 sum of /AACS/Unit_Key_RO.inf (or BDMV")
+	println("    content SHA1, for discs without it) instead of reading it from a")
+	println("    disc.")
+	printConfigUsage()
+	printLogUsage()
+}
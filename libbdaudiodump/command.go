@@ -0,0 +1,140 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long a cancelled child process has to exit after being interrupted before it's killed
+const commandInterruptGracePeriod = 10 * time.Second
+
+// CommandRunner is how the library finds and runs external tools.  The default implementation
+// uses os/exec, and a different one can be supplied to library functions with WithCommandRunner.
+type CommandRunner interface {
+	LookPath(file string) (string, error)
+	CombinedOutput(ctx context.Context, name string, args ...string) ([]byte, error)
+	// StreamOutputLines runs a command like CombinedOutput, but passes each line of output to
+	// onLine as soon as it's written instead of returning all of it at the end.
+	StreamOutputLines(ctx context.Context, name string, onLine func(line string), args ...string) error
+}
+
+type ExecCommandRunner struct{}
+
+type commandRunnerContextKey struct{}
+
+func WithCommandRunner(ctx context.Context, commandRunner CommandRunner) context.Context {
+	return context.WithValue(ctx, commandRunnerContextKey{}, commandRunner)
+}
+
+func GetCommandRunner(ctx context.Context) CommandRunner {
+	commandRunner, ok := ctx.Value(commandRunnerContextKey{}).(CommandRunner)
+	if !ok || commandRunner == nil {
+		return ExecCommandRunner{}
+	}
+
+	return commandRunner
+}
+
+func (ExecCommandRunner) LookPath(file string) (string, error) {
+	return exec.LookPath(file)
+}
+
+func (ExecCommandRunner) CombinedOutput(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return newCommand(ctx, name, args...).CombinedOutput()
+}
+
+func (ExecCommandRunner) StreamOutputLines(ctx context.Context, name string, onLine func(line string), args ...string) error {
+	outputLineWriter := &lineWriter{onLine: onLine}
+
+	command := newCommand(ctx, name, args...)
+	command.Stdout = outputLineWriter
+	command.Stderr = outputLineWriter
+
+	err := command.Run()
+	outputLineWriter.Flush()
+
+	return err
+}
+
+// lineWriter splits everything written to it into lines.  Carriage returns also end a line,
+// since some tools use them to redraw progress in place.
+type lineWriter struct {
+	onLine      func(line string)
+	partialLine bytes.Buffer
+	writeMutex  sync.Mutex
+}
+
+func (outputLineWriter *lineWriter) Write(output []byte) (int, error) {
+	outputLineWriter.writeMutex.Lock()
+	defer outputLineWriter.writeMutex.Unlock()
+
+	for _, outputByte := range output {
+		if outputByte != '\n' && outputByte != '\r' {
+			outputLineWriter.partialLine.WriteByte(outputByte)
+			continue
+		}
+
+		outputLineWriter.emitLine()
+	}
+
+	return len(output), nil
+}
+
+func (outputLineWriter *lineWriter) Flush() {
+	outputLineWriter.writeMutex.Lock()
+	defer outputLineWriter.writeMutex.Unlock()
+
+	outputLineWriter.emitLine()
+}
+
+func (outputLineWriter *lineWriter) emitLine() {
+	line := strings.TrimSpace(outputLineWriter.partialLine.String())
+	outputLineWriter.partialLine.Reset()
+
+	if line != "" {
+		outputLineWriter.onLine(line)
+	}
+}
+
+// newCommand works like exec.CommandContext, except that when the context is cancelled, the
+// process is sent an interrupt first so tools like makemkvcon and ffmpeg get a chance to exit
+// cleanly.  It's only killed if it's still running after the grace period.
+func newCommand(ctx context.Context, name string, args ...string) *exec.Cmd {
+	command := exec.CommandContext(ctx, name, args...)
+	command.Cancel = func() error {
+		// Interrupts aren't supported on Windows, so fall back to killing the process there
+		err := command.Process.Signal(os.Interrupt)
+		if err != nil {
+			return command.Process.Kill()
+		}
+
+		return nil
+	}
+	command.WaitDelay = commandInterruptGracePeriod
+
+	return command
+}
@@ -23,18 +23,58 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
-	"net/url"
 	"os"
 	"strconv"
 	"strings"
-	"time"
 )
 
+// CurrentConfigVersion is the config format version this build writes.  Configs in older
+// versions are migrated in memory when they're read.
+const CurrentConfigVersion = 2
+
+// BluRayConfigFile is the versioned envelope configs are written in.  Version 1 configs were a
+// bare array of discs, and are still read.
+type BluRayConfigFile struct {
+	Version int                `json:"version"`
+	Discs   []BluRayDiscConfig `json:"discs"`
+}
+
 type BluRayDiscConfig struct {
-	DiscVolumeKeySha1 string                  `json:"disc_volume_key_sha1"`
-	BluRayTitle       string                  `json:"bluray_title"`
-	MakemkvPrefix     string                  `json:"makemkv_prefix"`
-	Albums            []BluRayDiscConfigAlbum `json:"albums"`
+	DiscVolumeKeySha1  string                    `json:"disc_volume_key_sha1,omitempty"`
+	DiscIdentifierType string                    `json:"disc_identifier_type,omitempty"`
+	BluRayTitle        string                    `json:"bluray_title"`
+	MakemkvPrefix      string                    `json:"makemkv_prefix"`
+	Variants           []BluRayDiscConfigVariant `json:"variants,omitempty"`
+	Albums             []BluRayDiscConfigAlbum   `json:"albums"`
+
+	// Replaces the entry for the same disc from an earlier config file, rather than being
+	// reported as a duplicate
+	Override bool `json:"override,omitempty"`
+
+	// Set by GetDiscConfigByVolumeKeySha1Hash when the disc matched one of the variants
+	VariantName   string `json:"-"`
+	CatalogNumber string `json:"-"`
+}
+
+// BluRayDiscConfigVariant is one pressing of a disc, such as a reissue with a corrected master.
+// Each pressing has its own volume key SHA1, and can adjust tracks that differ between them.
+type BluRayDiscConfigVariant struct {
+	VariantName        string                          `json:"variant_name"`
+	CatalogNumber      string                          `json:"catalog_number,omitempty"`
+	DiscVolumeKeySha1  string                          `json:"disc_volume_key_sha1"`
+	DiscIdentifierType string                          `json:"disc_identifier_type,omitempty"`
+	TrackOverrides     []BluRayDiscConfigTrackOverride `json:"track_overrides,omitempty"`
+}
+
+// BluRayDiscConfigTrackOverride replaces the title or trims of a track for one variant.  Fields
+// that are left out keep the values from the track.
+type BluRayDiscConfigTrackOverride struct {
+	AlbumNumber int      `json:"album_number"`
+	DiscNumber  int      `json:"disc_number"`
+	TrackNumber int      `json:"track_number"`
+	TrackTitle  string   `json:"track_title,omitempty"`
+	TrimStartS  *float64 `json:"trim_start_s,omitempty"`
+	TrimEndS    *float64 `json:"trim_end_s,omitempty"`
 }
 
 type BluRayDiscConfigAlbum struct {
@@ -71,162 +111,390 @@ type BluRayDiscConfigAlbumDiscTrack struct {
 	Artists    []string `json:"artists,omitempty"`
 }
 
+// ReadConfigFile reads and checks a config file.  If it has any errors, a *ConfigValidationError
+// listing all of them is returned.
 func ReadConfigFile(configPath string) (*[]BluRayDiscConfig, error) {
-	bluRayConfigs := &[]BluRayDiscConfig{}
+	return ReadConfigPaths([]string{configPath})
+}
 
-	configData, err := os.ReadFile(configPath)
+// ReadConfigPaths reads, checks, and merges config files and directories of them, in the same
+// way as ValidateConfigPaths.  If any have errors, a *ConfigValidationError listing all of them
+// is returned.
+func ReadConfigPaths(configPaths []string) (*[]BluRayDiscConfig, error) {
+	bluRayConfigs, configIssues, err := ValidateConfigPaths(configPaths)
 	if err != nil {
 		return nil, err
 	}
 
-	jsonDecoder := json.NewDecoder(bytes.NewReader(configData))
-	jsonDecoder.DisallowUnknownFields()
-	err = jsonDecoder.Decode(bluRayConfigs)
+	if len(GetConfigIssuesBySeverity(configIssues, ConfigIssueSeverityError)) > 0 {
+		return nil, &ConfigValidationError{Issues: configIssues}
+	}
+
+	return bluRayConfigs, nil
+}
+
+// configMigration upgrades a config by one version.  Configs are migrated as generic JSON, with
+// numbers as json.Number, so a migration can rename or reshape fields the current types no
+// longer have.  getSourcePointer maps a pointer in the upgraded config back to the value it came
+// from, so problems are reported where they are in the file.
+type configMigration struct {
+	migrate          func(document any) (any, error)
+	getSourcePointer func(pointer string) string
+}
+
+// configMigrations holds the migration from each version to the next, starting from version 1
+var configMigrations = []configMigration{
+	{migrate: migrateConfigV1ToV2, getSourcePointer: getConfigV1SourcePointer},
+}
+
+// Version 2 moves the discs into an object with the version, so newer formats can be told apart
+// from older ones instead of failing on unknown fields
+func migrateConfigV1ToV2(document any) (any, error) {
+	return map[string]any{"version": json.Number("2"), "discs": document}, nil
+}
+
+func getConfigV1SourcePointer(pointer string) string {
+	if pointer == "/discs" || strings.HasPrefix(pointer, "/discs/") {
+		return strings.TrimPrefix(pointer, "/discs")
+	}
+
+	return ""
+}
+
+// decodeConfigDocument decodes a config as generic JSON for migrating it
+func decodeConfigDocument(configData []byte) (any, error) {
+	var document any
+
+	decoder := json.NewDecoder(bytes.NewReader(configData))
+	decoder.UseNumber()
+	err := decoder.Decode(&document)
 	if err != nil {
 		return nil, err
 	}
 
-	discVolumeSha1s := make(map[string]bool)
+	return document, nil
+}
 
-	for i, _ := range *bluRayConfigs {
-		if (*bluRayConfigs)[i].DiscVolumeKeySha1 == "" {
-			return nil, errors.New("missing disc volume key SHA1 for disc: " + (*bluRayConfigs)[i].BluRayTitle)
+// GetConfigDocumentVersion returns the format version of a config decoded as generic JSON.
+func GetConfigDocumentVersion(document any) (int, error) {
+	switch typedDocument := document.(type) {
+	case []any:
+		return 1, nil
+	case map[string]any:
+		versionValue, hasVersion := typedDocument["version"]
+		if !hasVersion {
+			return 0, errors.New("missing config version")
 		}
 
-		_, hasDiscVolumeSha1 := discVolumeSha1s[(*bluRayConfigs)[i].DiscVolumeKeySha1]
-		if hasDiscVolumeSha1 {
-			return nil, errors.New("duplicate disc volume key SHA1: " + (*bluRayConfigs)[i].DiscVolumeKeySha1)
-		} else {
-			discVolumeSha1s[(*bluRayConfigs)[i].DiscVolumeKeySha1] = true
+		versionNumber, _ := versionValue.(json.Number)
+		version, err := strconv.Atoi(versionNumber.String())
+		if err != nil || version < 2 {
+			return 0, errors.New("invalid config version: " + formatJsonValue(versionValue))
 		}
 
-		if (*bluRayConfigs)[i].BluRayTitle == "" {
-			return nil, errors.New("missing Blu-ray title for disc: " + (*bluRayConfigs)[i].DiscVolumeKeySha1)
+		if version > CurrentConfigVersion {
+			return 0, errors.New("config version " + strconv.Itoa(version) + " is newer than the latest version this build of bdaudiodump supports (" + strconv.Itoa(CurrentConfigVersion) + ")")
 		}
-		if (*bluRayConfigs)[i].MakemkvPrefix == "" {
-			return nil, errors.New("missing MakeMKV prefix for disc: " + (*bluRayConfigs)[i].BluRayTitle)
+
+		return version, nil
+	}
+
+	return 0, errors.New("config must be an object with a version and discs, or an array of discs")
+}
+
+// MigrateConfigDocument upgrades a config decoded as generic JSON to CurrentConfigVersion.  It
+// also returns the version the config was in, and a function that maps pointers in the upgraded
+// config back to where they were in the original.
+func MigrateConfigDocument(document any) (any, int, func(pointer string) string, error) {
+	version, err := GetConfigDocumentVersion(document)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	getSourcePointer := func(pointer string) string {
+		return pointer
+	}
+
+	for migrationVersion := version; migrationVersion < CurrentConfigVersion; migrationVersion++ {
+		migration := configMigrations[migrationVersion-1]
+
+		document, err = migration.migrate(document)
+		if err != nil {
+			return nil, 0, nil, errors.New("unable to migrate config from version " + strconv.Itoa(migrationVersion) + ": " + err.Error())
 		}
-		if (*bluRayConfigs)[i].Albums == nil || len((*bluRayConfigs)[i].Albums) == 0 {
-			return nil, errors.New("missing album for disc: " + (*bluRayConfigs)[i].BluRayTitle)
+
+		getMigratedSourcePointer := getSourcePointer
+		getSourcePointer = func(pointer string) string {
+			return getMigratedSourcePointer(migration.getSourcePointer(pointer))
 		}
+	}
+
+	return document, version, getSourcePointer, nil
+}
+
+// MarshalConfigFile writes discs as a config in the current version.
+func MarshalConfigFile(bluRayConfigs []BluRayDiscConfig) ([]byte, error) {
+	var configBuffer bytes.Buffer
+
+	encoder := json.NewEncoder(&configBuffer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "    ")
+	err := encoder.Encode(BluRayConfigFile{Version: CurrentConfigVersion, Discs: bluRayConfigs})
+	if err != nil {
+		return nil, err
+	}
+
+	return configBuffer.Bytes(), nil
+}
+
+// decodeConfigFileDocument decodes a config in any format as generic JSON for migrating it
+func decodeConfigFileDocument(configData []byte, configFormat string) (any, error) {
+	if configFormat == ConfigFormatJson {
+		return decodeConfigDocument(configData)
+	}
+
+	document, _, _, configIssue := decodeFormattedConfigDocument(configData, configFormat)
+	if configIssue != nil {
+		return nil, errors.New(configIssue.Message)
+	}
+
+	return document, nil
+}
+
+// getMigratedConfigFile decodes a migrated config directly, since the validated discs have had
+// their cover paths changed to use the OS's path separator
+func getMigratedConfigFile(document any) (*BluRayConfigFile, error) {
+	migratedData, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
 
-		albumNums := make(map[int]bool)
-		albumTitles := make(map[string]bool)
-
-		for albumIndex, album := range (*bluRayConfigs)[i].Albums {
-			if album.AlbumNumber < 1 {
-				return nil, errors.New("missing album number for album index " + strconv.Itoa(albumIndex) + " for disc: " + (*bluRayConfigs)[i].BluRayTitle)
-			}
-			if album.AlbumTitle == "" {
-				return nil, errors.New("missing album title for album index " + strconv.Itoa(albumIndex) + " for disc: " + (*bluRayConfigs)[i].BluRayTitle)
-			}
-			if album.AlbumArtist == "" {
-				return nil, errors.New("missing album artist for album " + album.AlbumTitle + " for disc: " + (*bluRayConfigs)[i].BluRayTitle)
-			}
-			if album.Genre == "" {
-				return nil, errors.New("missing genre for album " + album.AlbumTitle + " for disc: " + (*bluRayConfigs)[i].BluRayTitle)
-			}
-			if album.ReleaseDate == "" {
-				return nil, errors.New("missing release date for album " + album.AlbumTitle + " for disc: " + (*bluRayConfigs)[i].BluRayTitle)
-			}
-			_, err = time.Parse(time.DateOnly, album.ReleaseDate)
-			if err != nil {
-				return nil, errors.New("invalid date (must be YYYY-MM-DD format) for release date for album " + album.AlbumTitle + " for disc: " + (*bluRayConfigs)[i].BluRayTitle)
-			}
-			if album.TotalDiscs < 1 {
-				return nil, errors.New("invalid total number of discs (" + strconv.Itoa(album.TotalDiscs) + ") for album " + album.AlbumArtist + " for disc: " + (*bluRayConfigs)[i].BluRayTitle)
-			}
-			if album.CoverUrl != "" {
-				var parsedUrl *url.URL
-				parsedUrl, err = url.Parse(album.CoverUrl)
-				if err != nil || (parsedUrl.Scheme != "http" && parsedUrl.Scheme != "https") {
-					return nil, errors.New("invalid URL (must be HTTP or HTTPS) for cover image for album " + album.AlbumTitle + " for disc: " + (*bluRayConfigs)[i].BluRayTitle)
-				}
-			}
-			if album.CoverType == "" {
-				return nil, errors.New("missing cover type for album " + album.AlbumTitle + " for disc: " + (*bluRayConfigs)[i].BluRayTitle)
-			}
-
-			(*bluRayConfigs)[i].Albums[albumIndex].CoverContainerRelativePath = strings.ReplaceAll((*bluRayConfigs)[i].Albums[albumIndex].CoverContainerRelativePath, "/", string(os.PathSeparator))
-			(*bluRayConfigs)[i].Albums[albumIndex].CoverRelativePath = strings.ReplaceAll((*bluRayConfigs)[i].Albums[albumIndex].CoverRelativePath, "/", string(os.PathSeparator))
-
-			if album.Discs == nil || len(album.Discs) == 0 {
-				return nil, errors.New("no discs found for album " + album.AlbumTitle + " for disc: " + (*bluRayConfigs)[i].BluRayTitle)
-			}
-
-			_, hasAlbum := albumNums[album.AlbumNumber]
-			if hasAlbum {
-				return nil, errors.New("duplicate album number for album " + album.AlbumTitle + " for disc: " + (*bluRayConfigs)[i].BluRayTitle)
-			} else {
-				albumNums[album.AlbumNumber] = true
-			}
-
-			_, hasAlbum = albumTitles[album.AlbumTitle]
-			if hasAlbum {
-				return nil, errors.New("duplicate album title for album number " + strconv.Itoa(album.AlbumNumber) + " for disc: " + (*bluRayConfigs)[i].BluRayTitle)
-			} else {
-				albumTitles[album.AlbumTitle] = true
-			}
-
-			discNums := make(map[int]bool)
-
-			for _, disc := range album.Discs {
-				if disc.DiscNumber < 1 {
-					return nil, errors.New("invalid disc number (" + strconv.Itoa(disc.DiscNumber) + ") for album " + album.AlbumTitle + " for disc: " + (*bluRayConfigs)[i].BluRayTitle)
-				}
-				if disc.DiscNumber > album.TotalDiscs {
-					return nil, errors.New("disc number is greater than total discs for disc number " + strconv.Itoa(disc.DiscNumber) + " for album " + album.AlbumTitle + " for disc: " + (*bluRayConfigs)[i].BluRayTitle)
-				}
-				if disc.TotalTracks != len(disc.Tracks) {
-					return nil, errors.New("number of tracks does not match total track value for disc number " + strconv.Itoa(disc.DiscNumber) + " for album " + album.AlbumTitle + " for disc: " + (*bluRayConfigs)[i].BluRayTitle)
-				}
-
-				_, hasDisc := discNums[disc.DiscNumber]
-				if hasDisc {
-					return nil, errors.New("duplicate disc number (" + strconv.Itoa(disc.DiscNumber) + ") for album " + album.AlbumTitle + " for disc: " + (*bluRayConfigs)[i].BluRayTitle)
-				} else {
-					discNums[disc.DiscNumber] = true
-				}
-
-				trackNums := make(map[int]bool)
-
-				for _, track := range disc.Tracks {
-					if track.TrackNumber < 1 || track.TrackNumber > disc.TotalTracks {
-						return nil, errors.New("invalid track number (" + strconv.Itoa(track.TrackNumber) + ") for disc number " + strconv.Itoa(disc.DiscNumber) + " for album " + album.AlbumTitle + " for disc: " + (*bluRayConfigs)[i].BluRayTitle)
-					}
-					if track.TitleNumber == "" {
-						return nil, errors.New("missing title number for track " + strconv.Itoa(track.TrackNumber) + " for disc number " + strconv.Itoa(disc.DiscNumber) + " for album " + album.AlbumTitle + " for disc: " + (*bluRayConfigs)[i].BluRayTitle)
-					}
-					if len(track.ChapterNumbers) == 0 {
-						return nil, errors.New("missing chapters for track " + strconv.Itoa(track.TrackNumber) + " for disc number " + strconv.Itoa(disc.DiscNumber) + " for album " + album.AlbumTitle + " for disc: " + (*bluRayConfigs)[i].BluRayTitle)
-					}
-					for _, chapter := range track.ChapterNumbers {
-						if chapter < 0 {
-							return nil, errors.New("invalid chapter number (" + strconv.Itoa(chapter) + ") for track " + strconv.Itoa(track.TrackNumber) + " for disc number " + strconv.Itoa(disc.DiscNumber) + " for album " + album.AlbumTitle + " for disc: " + (*bluRayConfigs)[i].BluRayTitle)
-						}
-					}
-					for _, audioStream := range track.AudioStreams {
-						if audioStream.ChannelType != "best" && audioStream.ChannelType != "surround71" && audioStream.ChannelType != "surround51" && audioStream.ChannelType != "stereo21" && audioStream.ChannelType != "stereo20" {
-							return nil, errors.New("invalid audio stream type (" + audioStream.ChannelType + ") for track " + strconv.Itoa(track.TrackNumber) + " for disc number " + strconv.Itoa(disc.DiscNumber) + " for album " + album.AlbumTitle + " for disc: " + (*bluRayConfigs)[i].BluRayTitle)
-						}
-					}
-					if track.TrackTitle == "" {
-						return nil, errors.New("missing track title for track " + strconv.Itoa(track.TrackNumber) + " for disc number " + strconv.Itoa(disc.DiscNumber) + " for album " + album.AlbumTitle + " for disc: " + (*bluRayConfigs)[i].BluRayTitle)
-					}
-					for _, artist := range track.Artists {
-						if artist == "" {
-							return nil, errors.New("empty artist string for track " + strconv.Itoa(track.TrackNumber) + " for disc number " + strconv.Itoa(disc.DiscNumber) + " for album " + album.AlbumTitle + " for disc: " + (*bluRayConfigs)[i].BluRayTitle)
-						}
-					}
-					_, hasTrack := trackNums[track.TrackNumber]
-					if hasTrack {
-						return nil, errors.New("duplicate track number (" + strconv.Itoa(track.TrackNumber) + ") for disc number " + strconv.Itoa(disc.DiscNumber) + " for album " + album.AlbumTitle + " for disc: " + (*bluRayConfigs)[i].BluRayTitle)
-					} else {
-						trackNums[track.TrackNumber] = true
-					}
-				}
-			}
+	var configFile BluRayConfigFile
+	err = json.Unmarshal(migratedData, &configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &configFile, nil
+}
+
+// readConfigFileForRewrite reads and checks a config file that's about to be rewritten, and
+// returns it migrated to the current version, along with the version it was in
+func readConfigFileForRewrite(configPath string) ([]byte, *BluRayConfigFile, int, error) {
+	configData, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	configFormat := GetConfigFormat(configPath)
+	_, configIssues := ValidateConfigDataInFormat(configData, configFormat)
+	if len(GetConfigIssuesBySeverity(configIssues, ConfigIssueSeverityError)) > 0 {
+		for i := range configIssues {
+			configIssues[i].Path = configPath
 		}
+
+		return nil, nil, 0, &ConfigValidationError{Issues: configIssues}
 	}
-	return bluRayConfigs, nil
+
+	document, err := decodeConfigFileDocument(configData, configFormat)
+	if err != nil {
+		return nil, nil, 0, errors.New("invalid config: " + configPath + ": " + err.Error())
+	}
+
+	document, configVersion, _, err := MigrateConfigDocument(document)
+	if err != nil {
+		return nil, nil, 0, errors.New(configPath + ": " + err.Error())
+	}
+
+	configFile, err := getMigratedConfigFile(document)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	return configData, configFile, configVersion, nil
+}
+
+// writeConfigFile writes to a temporary file first, so a failed write never leaves a partial config
+func writeConfigFile(configPath string, configData []byte) error {
+	tempConfigPath := configPath + ".tmp"
+	err := os.WriteFile(tempConfigPath, configData, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tempConfigPath, configPath)
+}
+
+// writeConfigBackup only creates a new file, so running a migration again can't replace the
+// original config with one that was already migrated
+func writeConfigBackup(backupPath string, configData []byte) error {
+	backupFile, err := os.OpenFile(backupPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return errors.New("backup file already exists, move it out of the way to migrate the config: " + backupPath)
+	} else if err != nil {
+		return err
+	}
+
+	_, err = backupFile.Write(configData)
+	if err != nil {
+		backupFile.Close()
+		os.Remove(backupPath)
+		return err
+	}
+
+	return backupFile.Close()
+}
+
+// checkConfigOutputPath returns an error if a file that's about to be written already exists,
+// unless it can be overwritten
+func checkConfigOutputPath(outputPath string, overwrite bool) error {
+	if overwrite {
+		return nil
+	}
+
+	_, err := os.Stat(outputPath)
+	if err == nil {
+		return errors.New("output file already exists: " + outputPath)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// MigrateConfigFile rewrites a config file in the current version, in the same format, keeping
+// the original next to it with a .bak extension.  It returns the version the file was in, and
+// leaves files that are already current alone.  An existing backup is never replaced, so the
+// file isn't migrated if one is in the way.  If the config has errors, the file isn't changed
+// and a *ConfigValidationError listing them is returned.  Comments in YAML and TOML configs
+// aren't kept.
+func MigrateConfigFile(configPath string) (int, error) {
+	configData, configFile, configVersion, err := readConfigFileForRewrite(configPath)
+	if err != nil {
+		return configVersion, err
+	}
+
+	if configVersion == CurrentConfigVersion {
+		return configVersion, nil
+	}
+
+	migratedConfigData, err := MarshalConfigFileInFormat(configFile.Discs, GetConfigFormat(configPath))
+	if err != nil {
+		return configVersion, err
+	}
+
+	err = writeConfigBackup(configPath+".bak", configData)
+	if err != nil {
+		return configVersion, err
+	}
+
+	return configVersion, writeConfigFile(configPath, migratedConfigData)
+}
+
+// ConvertConfigFile translates a config to the format of outputPath's extension, in the current
+// version.  The converted config is decoded again and compared with the original before it's
+// written, so nothing is lost other than comments and formatting.  An existing output file is
+// only replaced if overwrite is set.
+func ConvertConfigFile(inputPath string, outputPath string, overwrite bool) error {
+	_, configFile, _, err := readConfigFileForRewrite(inputPath)
+	if err != nil {
+		return err
+	}
+
+	outputFormat := GetConfigFormat(outputPath)
+	convertedConfigData, err := MarshalConfigFileInFormat(configFile.Discs, outputFormat)
+	if err != nil {
+		return errors.New("unable to convert config to " + outputFormat + ": " + err.Error())
+	}
+
+	convertedDocument, err := decodeConfigFileDocument(convertedConfigData, outputFormat)
+	if err != nil {
+		return errors.New("unable to read converted config: " + err.Error())
+	}
+
+	convertedConfigFile, err := getMigratedConfigFile(convertedDocument)
+	if err != nil {
+		return errors.New("unable to read converted config: " + err.Error())
+	}
+
+	// Compare the configs as they'd be written to JSON, so fields left out because they're empty
+	// don't count as differences
+	originalJsonData, err := MarshalConfigFile(configFile.Discs)
+	if err != nil {
+		return err
+	}
+
+	convertedJsonData, err := MarshalConfigFile(convertedConfigFile.Discs)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(originalJsonData, convertedJsonData) {
+		return errors.New("converted config doesn't match the original, not writing: " + outputPath)
+	}
+
+	err = checkConfigOutputPath(outputPath, overwrite)
+	if err != nil {
+		return err
+	}
+
+	return writeConfigFile(outputPath, convertedConfigData)
+}
+
+// GetDiscConfigVolumeKeySha1s returns every volume key SHA1 a disc config matches, including its
+// variants'.
+func GetDiscConfigVolumeKeySha1s(discConfig BluRayDiscConfig) []string {
+	discVolumeKeySha1s := make([]string, 0)
+
+	if discConfig.DiscVolumeKeySha1 != "" {
+		discVolumeKeySha1s = append(discVolumeKeySha1s, discConfig.DiscVolumeKeySha1)
+	}
+
+	for _, variant := range discConfig.Variants {
+		discVolumeKeySha1s = append(discVolumeKeySha1s, variant.DiscVolumeKeySha1)
+	}
+
+	return discVolumeKeySha1s
+}
+
+// ResolveDiscConfigVariant returns a copy of the disc config as the given variant, with its track
+// overrides applied and its volume key SHA1, name, and catalog number filled in.  The original
+// disc config isn't changed.
+func ResolveDiscConfigVariant(discConfig BluRayDiscConfig, variant BluRayDiscConfigVariant) BluRayDiscConfig {
+	resolvedDiscConfig := discConfig
+	resolvedDiscConfig.DiscVolumeKeySha1 = variant.DiscVolumeKeySha1
+	resolvedDiscConfig.DiscIdentifierType = GetDiscConfigVariantIdentifierType(discConfig, variant)
+	resolvedDiscConfig.VariantName = variant.VariantName
+	resolvedDiscConfig.CatalogNumber = variant.CatalogNumber
+
+	// Copy the albums, discs, and tracks, since the overrides change tracks in place
+	resolvedDiscConfig.Albums = make([]BluRayDiscConfigAlbum, len(discConfig.Albums))
+	for albumIndex, album := range discConfig.Albums {
+		resolvedDiscConfig.Albums[albumIndex] = album
+		resolvedDiscConfig.Albums[albumIndex].Discs = make([]BluRayDiscConfigAlbumDisc, len(album.Discs))
+
+		for discIndex, disc := range album.Discs {
+			resolvedDiscConfig.Albums[albumIndex].Discs[discIndex] = disc
+			resolvedDiscConfig.Albums[albumIndex].Discs[discIndex].Tracks = append([]BluRayDiscConfigAlbumDiscTrack(nil), disc.Tracks...)
+		}
+	}
+
+	for _, trackOverride := range variant.TrackOverrides {
+		track, err := GetTrack(trackOverride.AlbumNumber, trackOverride.DiscNumber, trackOverride.TrackNumber, resolvedDiscConfig)
+		if err != nil {
+			continue
+		}
+
+		if trackOverride.TrackTitle != "" {
+			track.TrackTitle = trackOverride.TrackTitle
+		}
+		if trackOverride.TrimStartS != nil {
+			track.TrimStartS = *trackOverride.TrimStartS
+		}
+		if trackOverride.TrimEndS != nil {
+			track.TrimEndS = *trackOverride.TrimEndS
+		}
+	}
+
+	return resolvedDiscConfig
 }
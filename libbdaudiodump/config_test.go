@@ -0,0 +1,340 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testLegacyConfig = `[
+    {
+        "disc_volume_key_sha1": "0123456789abcdef0123456789abcdef01234567",
+        "bluray_title": "Test Disc",
+        "makemkv_prefix": "TEST_DISC",
+        "albums": [
+            {
+                "album_number": 1,
+                "album_title": "Test Album",
+                "album_artist": "Test Artist",
+                "genre": "Game",
+                "release_date": "2014-03-26",
+                "total_discs": 1,
+                "cover_url": "https://example.com/cover.jpg",
+                "cover_type": "url",
+                "discs": [
+                    {
+                        "disc_number": 1,
+                        "total_tracks": 1,
+                        "tracks": [
+                            {"track_number": 1, "title_number": "00", "chapter_numbers": [0], "track_title": "First"}
+                        ]
+                    }
+                ]
+            }
+        ]
+    }
+]
+`
+
+func TestMigrateConfigDocument(t *testing.T) {
+	tests := []struct {
+		name            string
+		config          string
+		expectedVersion int
+		expectedError   string
+	}{
+		{name: "version 1", config: testLegacyConfig, expectedVersion: 1},
+		{name: "current version", config: `{"version": 2, "discs": []}`, expectedVersion: 2},
+		{name: "missing version", config: `{"discs": []}`, expectedError: "missing config version"},
+		{name: "version 1 in an envelope", config: `{"version": 1, "discs": []}`, expectedError: "invalid config version: 1"},
+		{name: "version that isn't a number", config: `{"version": "2", "discs": []}`, expectedError: `invalid config version: "2"`},
+		{name: "newer version", config: `{"version": 3, "discs": []}`, expectedError: "config version 3 is newer than the latest version"},
+		{name: "not an object or array", config: `"discs"`, expectedError: "config must be an object with a version and discs, or an array of discs"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			document, err := decodeConfigDocument([]byte(test.config))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			migratedDocument, version, getSourcePointer, err := MigrateConfigDocument(document)
+			if test.expectedError != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), test.expectedError) {
+					t.Errorf("got error %v, expected %s", err, test.expectedError)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if version != test.expectedVersion {
+				t.Errorf("got version %d, expected %d", version, test.expectedVersion)
+			}
+
+			migratedConfigFile, err := getMigratedConfigFile(migratedDocument)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if migratedConfigFile.Version != CurrentConfigVersion {
+				t.Errorf("migrated config is version %d", migratedConfigFile.Version)
+			}
+
+			if version == 1 {
+				if len(migratedConfigFile.Discs) != 1 || migratedConfigFile.Discs[0].BluRayTitle != "Test Disc" {
+					t.Errorf("unexpected migrated discs: %+v", migratedConfigFile.Discs)
+				}
+
+				sourcePointers := map[string]string{
+					"/discs/0/bluray_title": "/0/bluray_title",
+					"/discs":                "",
+					"/version":              "",
+				}
+				for pointer, expectedSourcePointer := range sourcePointers {
+					if getSourcePointer(pointer) != expectedSourcePointer {
+						t.Errorf("%s: got source pointer %q, expected %q", pointer, getSourcePointer(pointer), expectedSourcePointer)
+					}
+				}
+			} else if getSourcePointer("/discs/0") != "/discs/0" {
+				t.Errorf("pointers in a current config shouldn't change, got %s", getSourcePointer("/discs/0"))
+			}
+		})
+	}
+}
+
+func TestMigrateConfigFile(t *testing.T) {
+	for _, configFileName := range []string{"discs.json", "discs.yaml"} {
+		t.Run(configFileName, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), configFileName)
+			backupPath := configPath + ".bak"
+
+			// JSON is valid YAML, so the same legacy config works for both
+			err := os.WriteFile(configPath, []byte(testLegacyConfig), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			configVersion, err := MigrateConfigFile(configPath)
+			if err != nil || configVersion != 1 {
+				t.Fatalf("got version %d and error %v, expected version 1", configVersion, err)
+			}
+
+			backupData, err := os.ReadFile(backupPath)
+			if err != nil || string(backupData) != testLegacyConfig {
+				t.Errorf("backup doesn't match the original config: %v", err)
+			}
+
+			migratedData, err := os.ReadFile(configPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			document, err := decodeConfigFileDocument(migratedData, GetConfigFormat(configPath))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			migratedVersion, err := GetConfigDocumentVersion(document)
+			if err != nil || migratedVersion != CurrentConfigVersion {
+				t.Errorf("migrated config is version %d: %v", migratedVersion, err)
+			}
+
+			_, configIssues, err := ValidateConfigFile(configPath)
+			if err != nil || len(configIssues) != 0 {
+				t.Errorf("migrated config has issues: %v %v", configIssues, err)
+			}
+
+			// A current config is left alone
+			configVersion, err = MigrateConfigFile(configPath)
+			if err != nil || configVersion != CurrentConfigVersion {
+				t.Errorf("got version %d and error %v for a current config", configVersion, err)
+			}
+
+			// An old config with a backup already next to it would replace the backup
+			err = os.WriteFile(configPath, []byte(strings.Replace(testLegacyConfig, "First", "Changed", 1)), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = MigrateConfigFile(configPath)
+			if err == nil || !strings.Contains(err.Error(), "backup file already exists") {
+				t.Errorf("expected an error about the existing backup, got %v", err)
+			}
+
+			backupData, err = os.ReadFile(backupPath)
+			if err != nil || string(backupData) != testLegacyConfig {
+				t.Errorf("existing backup was changed: %v", err)
+			}
+
+			configData, err := os.ReadFile(configPath)
+			if err != nil || !strings.Contains(string(configData), "Changed") || strings.Contains(string(configData), `"version"`) {
+				t.Errorf("config was changed even though its backup was in the way: %v", err)
+			}
+		})
+	}
+}
+
+func TestMigrateConfigFileWithErrors(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "discs.json")
+	invalidConfig := strings.Replace(testLegacyConfig, `"cover_type": "url"`, `"cover_type": "jpeg"`, 1)
+
+	err := os.WriteFile(configPath, []byte(invalidConfig), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = MigrateConfigFile(configPath)
+
+	var configValidationError *ConfigValidationError
+	if !errors.As(err, &configValidationError) || len(configValidationError.Issues) != 1 || configValidationError.Issues[0].Path != configPath {
+		t.Fatalf("expected a validation error for the config, got %v", err)
+	}
+
+	if _, err := os.Stat(configPath + ".bak"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected no backup for a config that wasn't migrated, got %v", err)
+	}
+
+	configData, err := os.ReadFile(configPath)
+	if err != nil || string(configData) != invalidConfig {
+		t.Errorf("config with errors was changed: %v", err)
+	}
+
+	// The issue points at the value as it's written in the version 1 config
+	var issuePointer string
+	if configValidationError != nil {
+		issuePointer = configValidationError.Issues[0].Pointer
+	}
+	if issuePointer != "/0/albums/0/cover_type" {
+		t.Errorf("unexpected issue pointer: %s", issuePointer)
+	}
+
+}
+
+func TestConvertConfigFile(t *testing.T) {
+	tempDirectory := t.TempDir()
+	inputPath := filepath.Join("..", "config", "bdaudiodump_config.json")
+
+	originalConfigs, configIssues, err := ValidateConfigFile(inputPath)
+	if err != nil || len(configIssues) != 0 {
+		t.Fatalf("bundled config has issues: %v %v", configIssues, err)
+	}
+
+	// Convert through every format and back to JSON
+	configPaths := []string{
+		inputPath,
+		filepath.Join(tempDirectory, "discs.yaml"),
+		filepath.Join(tempDirectory, "discs.toml"),
+		filepath.Join(tempDirectory, "discs.json"),
+	}
+	for i := 1; i < len(configPaths); i++ {
+		err := ConvertConfigFile(configPaths[i-1], configPaths[i], false)
+		if err != nil {
+			t.Fatalf("unable to convert %s to %s: %v", configPaths[i-1], configPaths[i], err)
+		}
+
+		convertedConfigs, configIssues, err := ValidateConfigFile(configPaths[i])
+		if err != nil || len(configIssues) != 0 {
+			t.Fatalf("%s has issues: %v %v", configPaths[i], configIssues, err)
+		}
+
+		if !reflect.DeepEqual(convertedConfigs, originalConfigs) {
+			t.Errorf("%s doesn't match the original config", configPaths[i])
+		}
+	}
+
+	// The bundled config is formatted by hand, so compare with it as bdaudiodump would write it
+	originalData, err := MarshalConfigFile(*originalConfigs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roundTripData, err := os.ReadFile(configPaths[len(configPaths)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(roundTripData) != string(originalData) {
+		t.Errorf("round tripped JSON config doesn't match the original")
+	}
+
+	// An existing output is only replaced with overwrite set
+	yamlPath := configPaths[1]
+	err = ConvertConfigFile(configPaths[3], yamlPath, false)
+	if err == nil || !strings.HasPrefix(err.Error(), "output file already exists") {
+		t.Errorf("expected an error about the existing output, got %v", err)
+	}
+
+	err = ConvertConfigFile(configPaths[3], yamlPath, true)
+	if err != nil {
+		t.Errorf("unable to overwrite %s: %v", yamlPath, err)
+	}
+}
+
+func TestValidateConfigReportsUnknownKeys(t *testing.T) {
+	tests := []struct {
+		name         string
+		configFormat string
+		config       string
+		expectedLine int
+	}{
+		{
+			name:         "yaml",
+			configFormat: ConfigFormatYaml,
+			config:       "version: 2\ndiscs:\n  - bluray_title: Test Disc\n    colour: red\n",
+			expectedLine: 4,
+		},
+		{
+			name:         "toml",
+			configFormat: ConfigFormatToml,
+			config:       "version = 2\n\n[[discs]]\nbluray_title = \"Test Disc\"\ncolour = \"red\"\n",
+			expectedLine: 5,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, configIssues := ValidateConfigDataInFormat([]byte(test.config), test.configFormat)
+
+			var unknownFieldIssue *ConfigIssue
+			for i, configIssue := range configIssues {
+				if configIssue.Pointer == "/discs/0/colour" {
+					unknownFieldIssue = &configIssues[i]
+				}
+			}
+
+			if unknownFieldIssue == nil {
+				t.Fatalf("no issue for the unknown key in %v", configIssues)
+			}
+
+			if unknownFieldIssue.Severity != ConfigIssueSeverityError || unknownFieldIssue.Message != "unknown field: colour" || unknownFieldIssue.Line != test.expectedLine {
+				t.Errorf("unexpected issue for the unknown key: %s", unknownFieldIssue)
+			}
+		})
+	}
+}
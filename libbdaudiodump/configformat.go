@@ -0,0 +1,597 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ConfigFormatJson = "json"
+	ConfigFormatYaml = "yaml"
+	ConfigFormatToml = "toml"
+)
+
+// GetConfigFormat picks a config's format from its extension.  Files with other extensions are
+// read as JSON, as they were before other formats were supported.
+func GetConfigFormat(configPath string) string {
+	switch strings.ToLower(filepath.Ext(configPath)) {
+	case ".yaml", ".yml":
+		return ConfigFormatYaml
+	case ".toml":
+		return ConfigFormatToml
+	}
+
+	return ConfigFormatJson
+}
+
+// IsConfigFileName reports whether a file in a config directory should be read
+func IsConfigFileName(fileName string) bool {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".json", ".yaml", ".yml", ".toml":
+		return !strings.HasPrefix(fileName, ".")
+	}
+
+	return false
+}
+
+// configValueLocations maps JSON pointers to the line and column of their values, for formats
+// that aren't JSON
+type configValueLocations map[string][2]int
+
+func (valueLocations configValueLocations) getPointerLocation(pointer string) (line int, column int) {
+	for {
+		location, hasLocation := valueLocations[pointer]
+		if hasLocation {
+			return location[0], location[1]
+		}
+
+		if pointer == "" {
+			return 1, 1
+		}
+
+		pointer = pointer[:strings.LastIndex(pointer, "/")]
+	}
+}
+
+// decodeFormattedConfigDocument decodes a YAML or TOML config into the same generic values as
+// decodeConfigDocument, so it's migrated and checked the same way as JSON.  Dates and times that
+// aren't quoted are decoded as strings, as they're written.  It also returns the pointers of
+// keys that are repeated in the same mapping, which TOML doesn't allow.
+func decodeFormattedConfigDocument(configData []byte, configFormat string) (any, configValueLocations, []string, *ConfigIssue) {
+	switch configFormat {
+	case ConfigFormatYaml:
+		return decodeYamlConfigDocument(configData)
+	case ConfigFormatToml:
+		document, valueLocations, configIssue := decodeTomlConfigDocument(configData)
+		return document, valueLocations, nil, configIssue
+	}
+
+	return nil, nil, nil, &ConfigIssue{Severity: ConfigIssueSeverityError, Line: 1, Column: 1, Message: "unsupported config format: " + configFormat}
+}
+
+var yamlErrorLinePattern = regexp.MustCompile(`line (\d+)`)
+
+func decodeYamlConfigDocument(configData []byte) (any, configValueLocations, []string, *ConfigIssue) {
+	var documentNode yaml.Node
+	err := yaml.Unmarshal(configData, &documentNode)
+	if err != nil {
+		configIssue := &ConfigIssue{Severity: ConfigIssueSeverityError, Line: 1, Column: 1, Message: "invalid YAML: " + strings.TrimPrefix(err.Error(), "yaml: ")}
+		if lineMatch := yamlErrorLinePattern.FindStringSubmatch(err.Error()); lineMatch != nil {
+			configIssue.Line, _ = strconv.Atoi(lineMatch[1])
+		}
+
+		return nil, nil, nil, configIssue
+	}
+
+	if len(documentNode.Content) == 0 {
+		return nil, nil, nil, &ConfigIssue{Severity: ConfigIssueSeverityError, Line: 1, Column: 1, Message: "empty YAML config"}
+	}
+
+	valueLocations := make(configValueLocations)
+	duplicateKeys := make([]string, 0)
+	document, err := convertYamlNode(documentNode.Content[0], "", valueLocations, &duplicateKeys)
+	if err != nil {
+		line, column := valueLocations.getPointerLocation("")
+		return nil, nil, nil, &ConfigIssue{Severity: ConfigIssueSeverityError, Line: line, Column: column, Message: "invalid YAML: " + err.Error()}
+	}
+
+	return document, valueLocations, duplicateKeys, nil
+}
+
+func convertYamlNode(node *yaml.Node, pointer string, valueLocations configValueLocations, duplicateKeys *[]string) (any, error) {
+	valueLocations[pointer] = [2]int{node.Line, node.Column}
+
+	switch node.Kind {
+	case yaml.AliasNode:
+		return convertYamlNode(node.Alias, pointer, valueLocations, duplicateKeys)
+	case yaml.MappingNode:
+		mapping := make(map[string]any)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			keyPointer := pointer + "/" + EscapeJsonPointerToken(key)
+
+			if _, isDuplicate := mapping[key]; isDuplicate {
+				*duplicateKeys = append(*duplicateKeys, keyPointer)
+			}
+
+			value, err := convertYamlNode(node.Content[i+1], keyPointer, valueLocations, duplicateKeys)
+			if err != nil {
+				return nil, err
+			}
+
+			mapping[key] = value
+		}
+
+		return mapping, nil
+	case yaml.SequenceNode:
+		sequence := make([]any, 0, len(node.Content))
+		for i, elementNode := range node.Content {
+			element, err := convertYamlNode(elementNode, pointer+"/"+strconv.Itoa(i), valueLocations, duplicateKeys)
+			if err != nil {
+				return nil, err
+			}
+
+			sequence = append(sequence, element)
+		}
+
+		return sequence, nil
+	}
+
+	switch node.ShortTag() {
+	case "!!null":
+		return nil, nil
+	case "!!bool":
+		var boolValue bool
+		err := node.Decode(&boolValue)
+		return boolValue, err
+	case "!!int":
+		var intValue int64
+		err := node.Decode(&intValue)
+		return json.Number(strconv.FormatInt(intValue, 10)), err
+	case "!!float":
+		var floatValue float64
+		err := node.Decode(&floatValue)
+		if err != nil {
+			return nil, err
+		}
+
+		return getFloatJsonNumber(floatValue)
+	}
+
+	return node.Value, nil
+}
+
+func getFloatJsonNumber(floatValue float64) (json.Number, error) {
+	if math.IsNaN(floatValue) || math.IsInf(floatValue, 0) {
+		return "", errors.New("numbers must be finite: " + strconv.FormatFloat(floatValue, 'g', -1, 64))
+	}
+
+	return json.Number(strconv.FormatFloat(floatValue, 'f', -1, 64)), nil
+}
+
+func decodeTomlConfigDocument(configData []byte) (any, configValueLocations, *ConfigIssue) {
+	var tomlDocument map[string]any
+	err := toml.Unmarshal(configData, &tomlDocument)
+	if err != nil {
+		configIssue := &ConfigIssue{Severity: ConfigIssueSeverityError, Line: 1, Column: 1, Message: "invalid TOML: " + err.Error()}
+
+		var decodeError *toml.DecodeError
+		if errors.As(err, &decodeError) {
+			configIssue.Line, configIssue.Column = decodeError.Position()
+		}
+
+		return nil, nil, configIssue
+	}
+
+	document, err := convertTomlValue(tomlDocument)
+	if err != nil {
+		return nil, nil, &ConfigIssue{Severity: ConfigIssueSeverityError, Line: 1, Column: 1, Message: "invalid TOML: " + err.Error()}
+	}
+
+	return document, getTomlLocations(configData), nil
+}
+
+func convertTomlValue(value any) (any, error) {
+	switch typedValue := value.(type) {
+	case map[string]any:
+		mapping := make(map[string]any)
+		for key, mappingValue := range typedValue {
+			convertedValue, err := convertTomlValue(mappingValue)
+			if err != nil {
+				return nil, err
+			}
+
+			mapping[key] = convertedValue
+		}
+
+		return mapping, nil
+	case []any:
+		sequence := make([]any, 0, len(typedValue))
+		for _, element := range typedValue {
+			convertedElement, err := convertTomlValue(element)
+			if err != nil {
+				return nil, err
+			}
+
+			sequence = append(sequence, convertedElement)
+		}
+
+		return sequence, nil
+	case int64:
+		return json.Number(strconv.FormatInt(typedValue, 10)), nil
+	case float64:
+		return getFloatJsonNumber(typedValue)
+	case time.Time:
+		return typedValue.Format(time.RFC3339Nano), nil
+	case toml.LocalDate:
+		return typedValue.String(), nil
+	case toml.LocalTime:
+		return typedValue.String(), nil
+	case toml.LocalDateTime:
+		return typedValue.String(), nil
+	}
+
+	return value, nil
+}
+
+// getTomlLocations finds where each key is in a TOML config.  Tables and arrays of tables are
+// found from their headers, counting each [[header]] to know which element of the array it is.
+func getTomlLocations(configData []byte) configValueLocations {
+	valueLocations := configValueLocations{"": {1, 1}}
+	arrayTableCounts := make(map[string]int)
+	tablePointer := ""
+
+	parser := unstable.Parser{}
+	parser.Reset(configData)
+
+	for parser.NextExpression() {
+		expression := parser.Expression()
+
+		switch expression.Kind {
+		case unstable.Table, unstable.ArrayTable:
+			keyIterator := expression.Key()
+			tablePointer = ""
+
+			for keyIterator.Next() {
+				keyNode := keyIterator.Node()
+				tablePointer = tablePointer + "/" + EscapeJsonPointerToken(string(keyNode.Data))
+
+				if expression.Kind == unstable.ArrayTable && keyIterator.IsLast() {
+					setTomlLocation(valueLocations, tablePointer, configData, keyNode)
+
+					elementIndex := arrayTableCounts[tablePointer]
+					arrayTableCounts[tablePointer] = elementIndex + 1
+					tablePointer = tablePointer + "/" + strconv.Itoa(elementIndex)
+				} else if arrayTableCount, isArrayTable := arrayTableCounts[tablePointer]; isArrayTable {
+					// Headers that go through an array of tables refer to its last element
+					tablePointer = tablePointer + "/" + strconv.Itoa(arrayTableCount-1)
+				}
+
+				setTomlLocation(valueLocations, tablePointer, configData, keyNode)
+			}
+		case unstable.KeyValue:
+			addTomlKeyValueLocations(valueLocations, tablePointer, configData, expression)
+		}
+	}
+
+	return valueLocations
+}
+
+func addTomlKeyValueLocations(valueLocations configValueLocations, tablePointer string, configData []byte, keyValueNode *unstable.Node) {
+	keyIterator := keyValueNode.Key()
+	pointer := tablePointer
+
+	for keyIterator.Next() {
+		pointer = pointer + "/" + EscapeJsonPointerToken(string(keyIterator.Node().Data))
+		setTomlLocation(valueLocations, pointer, configData, keyIterator.Node())
+	}
+
+	addTomlValueLocations(valueLocations, pointer, configData, keyValueNode.Value())
+}
+
+func addTomlValueLocations(valueLocations configValueLocations, pointer string, configData []byte, valueNode *unstable.Node) {
+	switch valueNode.Kind {
+	case unstable.Array:
+		childIterator := valueNode.Children()
+		for i := 0; childIterator.Next(); i++ {
+			elementPointer := pointer + "/" + strconv.Itoa(i)
+			setTomlLocation(valueLocations, elementPointer, configData, childIterator.Node())
+			addTomlValueLocations(valueLocations, elementPointer, configData, childIterator.Node())
+		}
+	case unstable.InlineTable:
+		childIterator := valueNode.Children()
+		for childIterator.Next() {
+			addTomlKeyValueLocations(valueLocations, pointer, configData, childIterator.Node())
+		}
+	}
+}
+
+func setTomlLocation(valueLocations configValueLocations, pointer string, configData []byte, node *unstable.Node) {
+	if _, hasLocation := valueLocations[pointer]; hasLocation || node.Raw.Length == 0 {
+		return
+	}
+
+	line, column := getOffsetLineColumn(configData, int64(node.Raw.Offset))
+	valueLocations[pointer] = [2]int{line, column}
+}
+
+// MarshalConfigFileInFormat writes discs as a config in the current version, in any format.
+// YAML and TOML are written from the JSON, so keys are in the same order in every format.
+func MarshalConfigFileInFormat(bluRayConfigs []BluRayDiscConfig, configFormat string) ([]byte, error) {
+	return marshalConfigFileWithComments(bluRayConfigs, configFormat, nil)
+}
+
+// marshalConfigFileWithComments also writes comments before the values at the JSON pointers in
+// comments, in formats that have them
+func marshalConfigFileWithComments(bluRayConfigs []BluRayDiscConfig, configFormat string, comments map[string]string) ([]byte, error) {
+	configData, err := MarshalConfigFile(bluRayConfigs)
+	if err != nil || configFormat == ConfigFormatJson {
+		return configData, err
+	}
+
+	var documentNode yaml.Node
+	err = yaml.Unmarshal(configData, &documentNode)
+	if err != nil {
+		return nil, err
+	}
+
+	switch configFormat {
+	case ConfigFormatYaml:
+		setYamlBlockStyle(&documentNode)
+		setYamlComments(documentNode.Content[0], "", comments)
+
+		var configBuffer bytes.Buffer
+		encoder := yaml.NewEncoder(&configBuffer)
+		encoder.SetIndent(2)
+		err = encoder.Encode(&documentNode)
+		if err != nil {
+			return nil, err
+		}
+
+		err = encoder.Close()
+		return configBuffer.Bytes(), err
+	case ConfigFormatToml:
+		var configBuffer bytes.Buffer
+		err = writeTomlTable(&configBuffer, "", "", documentNode.Content[0], comments)
+		return bytes.TrimLeft(configBuffer.Bytes(), "\n"), err
+	}
+
+	return nil, errors.New("unsupported config format: " + configFormat)
+}
+
+// setYamlBlockStyle clears the flow style and quoting from JSON, so the encoder writes normal
+// YAML and only quotes strings that need it
+func setYamlBlockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, childNode := range node.Content {
+		setYamlBlockStyle(childNode)
+	}
+}
+
+// setYamlComments puts each comment on the key of a mapping value, or on the element itself in
+// a sequence, so it's written on the lines before the value
+func setYamlComments(node *yaml.Node, pointer string, comments map[string]string) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			childPointer := pointer + "/" + EscapeJsonPointerToken(node.Content[i].Value)
+			node.Content[i].HeadComment = comments[childPointer]
+			setYamlComments(node.Content[i+1], childPointer, comments)
+		}
+	case yaml.SequenceNode:
+		for i, elementNode := range node.Content {
+			elementPointer := pointer + "/" + strconv.Itoa(i)
+			elementNode.HeadComment = comments[elementPointer]
+			setYamlComments(elementNode, elementPointer, comments)
+		}
+	}
+}
+
+func writeTomlComment(configBuffer *bytes.Buffer, comment string) {
+	if comment == "" {
+		return
+	}
+
+	for _, commentLine := range strings.Split(comment, "\n") {
+		configBuffer.WriteString(strings.TrimRight("# "+commentLine, " ") + "\n")
+	}
+}
+
+// writeTomlTable writes a table's keys, then its tables and arrays of tables, since TOML doesn't
+// allow keys after a table header.
+func writeTomlTable(configBuffer *bytes.Buffer, tableName string, pointer string, mappingNode *yaml.Node, comments map[string]string) error {
+	subtableIndexes := make([]int, 0)
+
+	for i := 0; i+1 < len(mappingNode.Content); i += 2 {
+		keyNode, valueNode := mappingNode.Content[i], mappingNode.Content[i+1]
+
+		if isTomlTableNode(valueNode) || isTomlArrayTableNode(valueNode) {
+			subtableIndexes = append(subtableIndexes, i)
+			continue
+		}
+
+		if valueNode.ShortTag() == "!!null" {
+			continue
+		}
+
+		tomlValue, err := getTomlInlineValue(valueNode)
+		if err != nil {
+			return err
+		}
+
+		writeTomlComment(configBuffer, comments[pointer+"/"+EscapeJsonPointerToken(keyNode.Value)])
+		configBuffer.WriteString(getTomlKey(keyNode.Value) + " = " + tomlValue + "\n")
+	}
+
+	for _, i := range subtableIndexes {
+		keyNode, valueNode := mappingNode.Content[i], mappingNode.Content[i+1]
+		subtablePointer := pointer + "/" + EscapeJsonPointerToken(keyNode.Value)
+
+		subtableName := getTomlKey(keyNode.Value)
+		if tableName != "" {
+			subtableName = tableName + "." + subtableName
+		}
+
+		if isTomlTableNode(valueNode) {
+			configBuffer.WriteString("\n")
+			writeTomlComment(configBuffer, comments[subtablePointer])
+			configBuffer.WriteString("[" + subtableName + "]\n")
+
+			err := writeTomlTable(configBuffer, subtableName, subtablePointer, valueNode, comments)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		for elementIndex, elementNode := range valueNode.Content {
+			elementPointer := subtablePointer + "/" + strconv.Itoa(elementIndex)
+
+			configBuffer.WriteString("\n")
+			if elementIndex == 0 {
+				writeTomlComment(configBuffer, comments[subtablePointer])
+			}
+			writeTomlComment(configBuffer, comments[elementPointer])
+			configBuffer.WriteString("[[" + subtableName + "]]\n")
+
+			err := writeTomlTable(configBuffer, subtableName, elementPointer, elementNode, comments)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func isTomlTableNode(node *yaml.Node) bool {
+	return node.Kind == yaml.MappingNode
+}
+
+// isTomlArrayTableNode reports whether an array only holds tables, so it can be written as an
+// array of tables.  Empty arrays are written inline.
+func isTomlArrayTableNode(node *yaml.Node) bool {
+	if node.Kind != yaml.SequenceNode || len(node.Content) == 0 {
+		return false
+	}
+
+	for _, elementNode := range node.Content {
+		if elementNode.Kind != yaml.MappingNode {
+			return false
+		}
+	}
+
+	return true
+}
+
+func getTomlInlineValue(node *yaml.Node) (string, error) {
+	switch node.Kind {
+	case yaml.SequenceNode:
+		elementValues := make([]string, 0, len(node.Content))
+		for _, elementNode := range node.Content {
+			elementValue, err := getTomlInlineValue(elementNode)
+			if err != nil {
+				return "", err
+			}
+
+			elementValues = append(elementValues, elementValue)
+		}
+
+		return "[" + strings.Join(elementValues, ", ") + "]", nil
+	case yaml.MappingNode:
+		keyValues := make([]string, 0, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i+1].ShortTag() == "!!null" {
+				continue
+			}
+
+			tomlValue, err := getTomlInlineValue(node.Content[i+1])
+			if err != nil {
+				return "", err
+			}
+
+			keyValues = append(keyValues, getTomlKey(node.Content[i].Value)+" = "+tomlValue)
+		}
+
+		return "{" + strings.Join(keyValues, ", ") + "}", nil
+	}
+
+	switch node.ShortTag() {
+	case "!!int", "!!float", "!!bool":
+		return node.Value, nil
+	case "!!null":
+		return "", errors.New("TOML can't represent null values")
+	}
+
+	return getTomlString(node.Value), nil
+}
+
+var tomlBareKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func getTomlKey(key string) string {
+	if tomlBareKeyPattern.MatchString(key) {
+		return key
+	}
+
+	return getTomlString(key)
+}
+
+func getTomlString(value string) string {
+	var tomlString strings.Builder
+
+	tomlString.WriteByte('"')
+	for _, character := range value {
+		switch character {
+		case '"':
+			tomlString.WriteString(`\"`)
+		case '\\':
+			tomlString.WriteString(`\\`)
+		case '\n':
+			tomlString.WriteString(`\n`)
+		case '\t':
+			tomlString.WriteString(`\t`)
+		case '\r':
+			tomlString.WriteString(`\r`)
+		default:
+			if character < 0x20 || character == 0x7f {
+				tomlString.WriteString(`\u` + strings.ToUpper(strconv.FormatInt(int64(0x10000+character), 16)[1:]))
+			} else {
+				tomlString.WriteRune(character)
+			}
+		}
+	}
+	tomlString.WriteByte('"')
+
+	return tomlString.String()
+}
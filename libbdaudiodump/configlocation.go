@@ -0,0 +1,188 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// jsonValueLocation is where a value starts and ends in a JSON document, as byte offsets.
+type jsonValueLocation struct {
+	Start int64
+	End   int64
+}
+
+// jsonLocations maps JSON pointers (RFC 6901) to where their values are in a document, so
+// problems found after decoding can be reported with a line and column.
+type jsonLocations struct {
+	data            []byte
+	decoder         *json.Decoder
+	valueLocations  map[string]jsonValueLocation
+	duplicateKeys   []string
+	pointersInOrder []string
+}
+
+func getJsonLocations(data []byte) (*jsonLocations, error) {
+	locations := &jsonLocations{
+		data:           data,
+		decoder:        json.NewDecoder(bytes.NewReader(data)),
+		valueLocations: make(map[string]jsonValueLocation),
+		duplicateKeys:  make([]string, 0),
+	}
+
+	err := locations.readValue("")
+	if err != nil {
+		return nil, err
+	}
+
+	return locations, nil
+}
+
+func (locations *jsonLocations) readValue(pointer string) error {
+	start := locations.skipSeparators(locations.decoder.InputOffset())
+
+	token, err := locations.decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	locations.pointersInOrder = append(locations.pointersInOrder, pointer)
+
+	switch token {
+	case json.Delim('{'):
+		seenKeys := make(map[string]bool)
+
+		for locations.decoder.More() {
+			keyStart := locations.skipSeparators(locations.decoder.InputOffset())
+
+			keyToken, err := locations.decoder.Token()
+			if err != nil {
+				return err
+			}
+
+			key, _ := keyToken.(string)
+			keyPointer := pointer + "/" + EscapeJsonPointerToken(key)
+
+			if seenKeys[key] {
+				locations.duplicateKeys = append(locations.duplicateKeys, keyPointer)
+				locations.valueLocations[keyPointer] = jsonValueLocation{Start: keyStart, End: keyStart}
+			} else {
+				seenKeys[key] = true
+			}
+
+			err = locations.readValue(keyPointer)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Read the closing brace
+		_, err = locations.decoder.Token()
+		if err != nil {
+			return err
+		}
+	case json.Delim('['):
+		for i := 0; locations.decoder.More(); i++ {
+			err = locations.readValue(pointer + "/" + strconv.Itoa(i))
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = locations.decoder.Token()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Duplicate keys keep the location of the key, since that's where the problem is
+	if _, hasLocation := locations.valueLocations[pointer]; !hasLocation {
+		locations.valueLocations[pointer] = jsonValueLocation{Start: start, End: locations.decoder.InputOffset()}
+	}
+
+	return nil
+}
+
+// skipSeparators moves an offset past the whitespace, commas, and colons between tokens, since
+// the decoder's offset is at the end of the previous token.
+func (locations *jsonLocations) skipSeparators(offset int64) int64 {
+	for offset < int64(len(locations.data)) && strings.IndexByte(" \t\r\n,:", locations.data[offset]) != -1 {
+		offset++
+	}
+
+	return offset
+}
+
+// getPointerLocation returns where the value at pointer starts.  Pointers to values that aren't
+// in the document, such as missing fields, get the location of their closest parent that is.
+func (locations *jsonLocations) getPointerLocation(pointer string) (line int, column int) {
+	for {
+		valueLocation, hasLocation := locations.valueLocations[pointer]
+		if hasLocation {
+			return locations.getOffsetLineColumn(valueLocation.Start)
+		}
+
+		if pointer == "" {
+			return 0, 0
+		}
+
+		pointer = pointer[:strings.LastIndex(pointer, "/")]
+	}
+}
+
+// getOffsetPointer returns the pointer of the innermost value that contains offset.
+func (locations *jsonLocations) getOffsetPointer(offset int64) string {
+	innermostPointer := ""
+
+	for _, pointer := range locations.pointersInOrder {
+		valueLocation := locations.valueLocations[pointer]
+		if valueLocation.Start < offset && offset <= valueLocation.End && len(pointer) >= len(innermostPointer) {
+			innermostPointer = pointer
+		}
+	}
+
+	return innermostPointer
+}
+
+func (locations *jsonLocations) getOffsetLineColumn(offset int64) (line int, column int) {
+	return getOffsetLineColumn(locations.data, offset)
+}
+
+// getOffsetLineColumn converts a byte offset into a 1-based line and column, counting columns
+// in characters rather than bytes.
+func getOffsetLineColumn(data []byte, offset int64) (line int, column int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+
+	precedingData := data[:offset]
+	lineStart := bytes.LastIndexByte(precedingData, '\n') + 1
+
+	return bytes.Count(precedingData, []byte("\n")) + 1, utf8.RuneCount(precedingData[lineStart:]) + 1
+}
+
+// EscapeJsonPointerToken escapes a key for use in a JSON pointer, as described in RFC 6901.
+func EscapeJsonPointerToken(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
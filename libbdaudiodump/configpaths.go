@@ -0,0 +1,225 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GetConfigFilePaths expands any directories in configPaths to the config files directly in
+// them, sorted by name so files are always merged in the same order.  Hidden files and files
+// that aren't JSON, YAML, or TOML are skipped.  A file that's reached more than once, such as
+// when it's passed along with its directory or through a symlink, is only kept the first time.
+func GetConfigFilePaths(configPaths []string) ([]string, error) {
+	configFilePaths := make([]string, 0)
+	configFileInfos := make([]os.FileInfo, 0)
+
+	addConfigFilePath := func(configFilePath string, fileInfo os.FileInfo) {
+		for _, existingFileInfo := range configFileInfos {
+			if os.SameFile(existingFileInfo, fileInfo) {
+				return
+			}
+		}
+
+		configFilePaths = append(configFilePaths, configFilePath)
+		configFileInfos = append(configFileInfos, fileInfo)
+	}
+
+	for _, configPath := range configPaths {
+		fileInfo, err := os.Stat(configPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if !fileInfo.IsDir() {
+			addConfigFilePath(configPath, fileInfo)
+			continue
+		}
+
+		dirEntries, err := os.ReadDir(configPath)
+		if err != nil {
+			return nil, err
+		}
+
+		dirConfigFilePaths := make([]string, 0)
+		for _, dirEntry := range dirEntries {
+			if dirEntry.IsDir() || !IsConfigFileName(dirEntry.Name()) {
+				continue
+			}
+
+			dirConfigFilePaths = append(dirConfigFilePaths, filepath.Join(configPath, dirEntry.Name()))
+		}
+
+		sort.Strings(dirConfigFilePaths)
+		for _, dirConfigFilePath := range dirConfigFilePaths {
+			// Stat follows symlinks, so a linked file is matched with the file it points to
+			dirConfigFileInfo, err := os.Stat(dirConfigFilePath)
+			if err != nil {
+				return nil, err
+			}
+
+			if dirConfigFileInfo.IsDir() {
+				continue
+			}
+
+			addConfigFilePath(dirConfigFilePath, dirConfigFileInfo)
+		}
+	}
+
+	return configFilePaths, nil
+}
+
+// ValidateConfigPaths reads and checks config files and directories of them, in order, and
+// merges their discs.  A disc that's already in an earlier file is an error unless the later
+// entry sets override, in which case it replaces the earlier one.  The error is only for failing
+// to read a file, or if there weren't any config files.
+func ValidateConfigPaths(configPaths []string) (*[]BluRayDiscConfig, []ConfigIssue, error) {
+	configFilePaths, err := GetConfigFilePaths(configPaths)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(configFilePaths) == 0 {
+		return nil, nil, errors.New("no config files found in: " + strings.Join(configPaths, ", "))
+	}
+
+	merger := &configMerger{bluRayConfigs: make([]BluRayDiscConfig, 0), sourcesBySha1: make(map[string]configMergeSource)}
+	configIssues := make([]ConfigIssue, 0)
+
+	for _, configFilePath := range configFilePaths {
+		configData, err := os.ReadFile(configFilePath)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		bluRayConfigs, fileConfigIssues, source := validateConfigData(configData, GetConfigFormat(configFilePath))
+		if source != nil {
+			fileConfigIssues = append(fileConfigIssues, merger.addConfigs(configFilePath, *bluRayConfigs, source)...)
+		}
+
+		sortConfigIssues(fileConfigIssues)
+		for _, configIssue := range fileConfigIssues {
+			configIssue.Path = configFilePath
+			configIssues = append(configIssues, configIssue)
+		}
+	}
+
+	return merger.getConfigs(), configIssues, nil
+}
+
+// configMergeSource is where a volume key SHA1 was first seen, for reporting duplicates
+type configMergeSource struct {
+	configPath string
+	line       int
+	column     int
+	discIndex  int
+}
+
+type configMerger struct {
+	bluRayConfigs []BluRayDiscConfig
+	overridden    []bool
+	sourcesBySha1 map[string]configMergeSource
+}
+
+func (merger *configMerger) addConfigs(configPath string, bluRayConfigs []BluRayDiscConfig, source *configSource) []ConfigIssue {
+	configIssues := make([]ConfigIssue, 0)
+
+	for i, discConfig := range bluRayConfigs {
+		discPointer := "/discs/" + strconv.Itoa(i)
+
+		sha1Pointers := make(map[string]string)
+		if discConfig.DiscVolumeKeySha1 != "" {
+			sha1Pointers[discConfig.DiscVolumeKeySha1] = discPointer + "/disc_volume_key_sha1"
+		}
+		for variantIndex, variant := range discConfig.Variants {
+			if _, hasSha1 := sha1Pointers[variant.DiscVolumeKeySha1]; !hasSha1 && variant.DiscVolumeKeySha1 != "" {
+				sha1Pointers[variant.DiscVolumeKeySha1] = discPointer + "/variants/" + strconv.Itoa(variantIndex) + "/disc_volume_key_sha1"
+			}
+		}
+
+		overriddenDiscIndexes := make(map[int]bool)
+		hasDuplicate := false
+
+		for _, discVolumeKeySha1 := range GetDiscConfigVolumeKeySha1s(discConfig) {
+			earlierSource, isDuplicate := merger.sourcesBySha1[discVolumeKeySha1]
+			if !isDuplicate || earlierSource.configPath == configPath {
+				// Duplicates within a file are reported when it's checked
+				continue
+			}
+
+			if discConfig.Override {
+				overriddenDiscIndexes[earlierSource.discIndex] = true
+				continue
+			}
+
+			hasDuplicate = true
+			configIssues = append(configIssues, source.getIssue(ConfigIssueSeverityError, sha1Pointers[discVolumeKeySha1], "duplicate disc volume key SHA1 ("+discVolumeKeySha1+"), already in "+earlierSource.configPath+":"+strconv.Itoa(earlierSource.line)+":"+strconv.Itoa(earlierSource.column)+"; set override to true to replace that entry"))
+		}
+
+		if discConfig.Override && len(overriddenDiscIndexes) == 0 {
+			configIssues = append(configIssues, source.getIssue(ConfigIssueSeverityWarning, discPointer+"/override", "override is set, but no earlier config file has this disc"))
+		}
+
+		if hasDuplicate {
+			continue
+		}
+
+		for overriddenDiscIndex := range overriddenDiscIndexes {
+			merger.overridden[overriddenDiscIndex] = true
+			for discVolumeKeySha1, earlierSource := range merger.sourcesBySha1 {
+				if earlierSource.discIndex == overriddenDiscIndex {
+					delete(merger.sourcesBySha1, discVolumeKeySha1)
+				}
+			}
+		}
+
+		discIndex := len(merger.bluRayConfigs)
+		merger.bluRayConfigs = append(merger.bluRayConfigs, discConfig)
+		merger.overridden = append(merger.overridden, false)
+
+		for discVolumeKeySha1, sha1Pointer := range sha1Pointers {
+			if _, isDuplicate := merger.sourcesBySha1[discVolumeKeySha1]; isDuplicate {
+				continue
+			}
+
+			line, column := source.getLocation(sha1Pointer)
+			merger.sourcesBySha1[discVolumeKeySha1] = configMergeSource{configPath: configPath, line: line, column: column, discIndex: discIndex}
+		}
+	}
+
+	return configIssues
+}
+
+func (merger *configMerger) getConfigs() *[]BluRayDiscConfig {
+	bluRayConfigs := make([]BluRayDiscConfig, 0)
+
+	for i, discConfig := range merger.bluRayConfigs {
+		if !merger.overridden[i] {
+			bluRayConfigs = append(bluRayConfigs, discConfig)
+		}
+	}
+
+	return &bluRayConfigs
+}
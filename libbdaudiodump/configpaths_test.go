@@ -0,0 +1,103 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGetConfigFilePaths(t *testing.T) {
+	configDir := t.TempDir()
+	otherDir := t.TempDir()
+
+	for _, configFileName := range []string{"b.yaml", "a.json", ".hidden.json", "notes.txt"} {
+		createTestFile(t, filepath.Join(configDir, configFileName))
+	}
+	createTestFile(t, filepath.Join(otherDir, "other.toml"))
+
+	err := os.Mkdir(filepath.Join(configDir, "subdir.json"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	linkedConfigDir := filepath.Join(otherDir, "linked")
+	err = os.Symlink(configDir, linkedConfigDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Symlink(filepath.Join(configDir, "a.json"), filepath.Join(otherDir, "link.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name              string
+		configPaths       []string
+		expectedFilePaths []string
+	}{
+		{
+			name:              "directory",
+			configPaths:       []string{configDir},
+			expectedFilePaths: []string{filepath.Join(configDir, "a.json"), filepath.Join(configDir, "b.yaml")},
+		},
+		{
+			name:              "file and its directory",
+			configPaths:       []string{filepath.Join(configDir, "b.yaml"), configDir},
+			expectedFilePaths: []string{filepath.Join(configDir, "b.yaml"), filepath.Join(configDir, "a.json")},
+		},
+		{
+			name:              "same file written differently",
+			configPaths:       []string{filepath.Join(configDir, "a.json"), configDir + "/./a.json", filepath.Join(configDir, "..", filepath.Base(configDir), "a.json")},
+			expectedFilePaths: []string{filepath.Join(configDir, "a.json")},
+		},
+		{
+			name:              "directory and a symlink to it",
+			configPaths:       []string{configDir, linkedConfigDir},
+			expectedFilePaths: []string{filepath.Join(configDir, "a.json"), filepath.Join(configDir, "b.yaml")},
+		},
+		{
+			name:              "symlinked file in another directory",
+			configPaths:       []string{otherDir, configDir},
+			expectedFilePaths: []string{filepath.Join(otherDir, "link.json"), filepath.Join(otherDir, "other.toml"), filepath.Join(configDir, "b.yaml")},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configFilePaths, err := GetConfigFilePaths(test.configPaths)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(configFilePaths, test.expectedFilePaths) {
+				t.Errorf("got %q, expected %q", configFilePaths, test.expectedFilePaths)
+			}
+		})
+	}
+
+	_, err = GetConfigFilePaths([]string{filepath.Join(configDir, "missing.json")})
+	if err == nil {
+		t.Error("expected an error for a missing config path")
+	}
+}
@@ -0,0 +1,237 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// ConfigScaffold is a draft disc config made from a disc's MKV files, with one track for each
+// chapter of every title.  Titles holds the chapter timings the tracks were made from.
+type ConfigScaffold struct {
+	DiscConfig BluRayDiscConfig      `json:"-"`
+	Titles     []ConfigScaffoldTitle `json:"titles"`
+}
+
+type ConfigScaffoldTitle struct {
+	TitleNumber string                  `json:"title_number"`
+	MkvPath     string                  `json:"mkv_path"`
+	Chapters    []ConfigScaffoldChapter `json:"chapters"`
+}
+
+// ConfigScaffoldChapter is one chapter of a title, or the whole title if it has no chapters
+type ConfigScaffoldChapter struct {
+	ChapterNumber int     `json:"chapter_number"`
+	IsChapter     bool    `json:"is_chapter"`
+	StartS        float64 `json:"start_s"`
+	EndS          float64 `json:"end_s"`
+	DurationS     float64 `json:"duration_s"`
+}
+
+var discSha1Pattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+var makemkvTitlePathPattern = regexp.MustCompile(`^(.*)_t(\d+)\.mkv$`)
+
+// GetMakemkvPrefixFromMkvPath returns the <prefix> from a file named the way makemkvcon names
+// titles (<prefix>_t##.mkv), or an empty string if the name doesn't match.
+func GetMakemkvPrefixFromMkvPath(mkvPath string) string {
+	matches := makemkvTitlePathPattern.FindStringSubmatch(filepath.Base(mkvPath))
+	if matches == nil {
+		return ""
+	}
+
+	return matches[1]
+}
+
+// NewConfigScaffold probes each MKV file and drafts a config for the disc they were ripped from.
+// The files must all be named the way makemkvcon names titles, with the same prefix.  Fields that
+// can't be worked out from the files, such as the album artist and cover, are left empty, so
+// validating the draft lists what's left to fill in.
+func NewConfigScaffold(ctx context.Context, mkvPaths []string, discVolumeKeySha1 string, discIdentifierType string) (*ConfigScaffold, error) {
+	if len(mkvPaths) == 0 {
+		return nil, errors.New("no MKV files to draft a config from")
+	}
+
+	if !discSha1Pattern.MatchString(discVolumeKeySha1) {
+		return nil, errors.New("invalid disc SHA1, expected 40 lowercase hex characters: " + discVolumeKeySha1)
+	}
+
+	if discIdentifierType == DiscIdentifierTypeVolumeKeySha1 {
+		discIdentifierType = ""
+	} else if discIdentifierType != "" && !IsValidDiscIdentifierType(discIdentifierType) {
+		return nil, errors.New("invalid disc identifier type: " + discIdentifierType)
+	}
+
+	makemkvPrefix := ""
+	for _, mkvPath := range mkvPaths {
+		mkvPrefix := GetMakemkvPrefixFromMkvPath(mkvPath)
+		if mkvPrefix == "" {
+			return nil, errors.New("MKV file isn't named the way makemkvcon names titles (<prefix>_t##.mkv): " + mkvPath)
+		}
+
+		if makemkvPrefix != "" && mkvPrefix != makemkvPrefix {
+			return nil, errors.New("MKV files have different prefixes (" + makemkvPrefix + " and " + mkvPrefix + "), only include the files from one disc")
+		}
+
+		makemkvPrefix = mkvPrefix
+	}
+
+	sortedMkvPaths := append([]string{}, mkvPaths...)
+	sort.SliceStable(sortedMkvPaths, func(i int, j int) bool {
+		return compareTitleNumbers(GetTitleNumberFromMkvPath(sortedMkvPaths[i]), GetTitleNumberFromMkvPath(sortedMkvPaths[j])) < 0
+	})
+
+	scaffold := &ConfigScaffold{Titles: make([]ConfigScaffoldTitle, 0)}
+	tracks := make([]BluRayDiscConfigAlbumDiscTrack, 0)
+
+	for _, mkvPath := range sortedMkvPaths {
+		chapterInfos, err := GetFfprobeDataFromMkv(ctx, mkvPath)
+		if err != nil {
+			return nil, err
+		}
+
+		title := ConfigScaffoldTitle{TitleNumber: GetTitleNumberFromMkvPath(mkvPath), MkvPath: mkvPath, Chapters: make([]ConfigScaffoldChapter, 0)}
+		for _, chapterInfo := range chapterInfos {
+			title.Chapters = append(title.Chapters, ConfigScaffoldChapter{
+				ChapterNumber: chapterInfo.ChapterIndex,
+				IsChapter:     chapterInfo.IsChapter,
+				StartS:        chapterInfo.ChapterStartTime,
+				EndS:          chapterInfo.ChapterEndTime,
+				DurationS:     chapterInfo.ChapterDuration,
+			})
+
+			trackNumber := len(tracks) + 1
+			tracks = append(tracks, BluRayDiscConfigAlbumDiscTrack{
+				TrackNumber:    trackNumber,
+				TitleNumber:    title.TitleNumber,
+				ChapterNumbers: []int{chapterInfo.ChapterIndex},
+				TrackTitle:     "Track " + strconv.Itoa(trackNumber),
+			})
+		}
+
+		scaffold.Titles = append(scaffold.Titles, title)
+	}
+
+	scaffold.DiscConfig = BluRayDiscConfig{
+		DiscVolumeKeySha1:  discVolumeKeySha1,
+		DiscIdentifierType: discIdentifierType,
+		BluRayTitle:        makemkvPrefix,
+		MakemkvPrefix:      makemkvPrefix,
+		Albums: []BluRayDiscConfigAlbum{
+			{
+				AlbumNumber: 1,
+				AlbumTitle:  makemkvPrefix,
+				TotalDiscs:  1,
+				CoverType:   "url",
+				Discs: []BluRayDiscConfigAlbumDisc{
+					{DiscNumber: 1, TotalTracks: len(tracks), Tracks: tracks},
+				},
+			},
+		},
+	}
+
+	return scaffold, nil
+}
+
+// getTrackComments describes the chapter each track was made from, keyed by the track's JSON
+// pointer in the drafted config
+func (scaffold *ConfigScaffold) getTrackComments() map[string]string {
+	trackComments := make(map[string]string)
+
+	trackIndex := 0
+	for _, title := range scaffold.Titles {
+		for _, chapter := range title.Chapters {
+			trackComment := "Title " + title.TitleNumber + ", " + fmt.Sprintf("chapter %d: start %.6fs, end %.6fs, duration %.6fs", chapter.ChapterNumber, chapter.StartS, chapter.EndS, chapter.DurationS)
+			if !chapter.IsChapter {
+				trackComment = "Title " + title.TitleNumber + ", " + fmt.Sprintf("no chapters, duration %.6fs", chapter.DurationS)
+			}
+
+			trackComments["/discs/0/albums/0/discs/0/tracks/"+strconv.Itoa(trackIndex)] = trackComment
+			trackIndex++
+		}
+	}
+
+	return trackComments
+}
+
+// MarshalConfig writes the draft as a config file.  In YAML and TOML, each track has a comment
+// with the timings of its chapter.  JSON doesn't have comments, so use MarshalTitles to write
+// the timings alongside it.
+func (scaffold *ConfigScaffold) MarshalConfig(configFormat string) ([]byte, error) {
+	return marshalConfigFileWithComments([]BluRayDiscConfig{scaffold.DiscConfig}, configFormat, scaffold.getTrackComments())
+}
+
+// MarshalTitles writes the chapter timings of each title as JSON
+func (scaffold *ConfigScaffold) MarshalTitles() ([]byte, error) {
+	return json.MarshalIndent(scaffold, "", "    ")
+}
+
+// GetConfigScaffoldTitlesPath returns where the chapter timings for a draft config written to
+// configPath are kept.  They're JSON, but don't have a .json extension so they aren't read as a
+// config when the draft is in a config directory.
+func GetConfigScaffoldTitlesPath(configPath string) string {
+	return configPath + ".chapters"
+}
+
+// WriteConfigFile writes the draft to configPath, in the format of its extension.  For JSON, the
+// chapter timings are written next to it, at GetConfigScaffoldTitlesPath.  Existing files are
+// only replaced if overwrite is set.
+func (scaffold *ConfigScaffold) WriteConfigFile(configPath string, overwrite bool) error {
+	configFormat := GetConfigFormat(configPath)
+
+	configData, err := scaffold.MarshalConfig(configFormat)
+	if err != nil {
+		return err
+	}
+
+	err = checkConfigOutputPath(configPath, overwrite)
+	if err != nil {
+		return err
+	}
+
+	if configFormat != ConfigFormatJson {
+		return writeConfigFile(configPath, configData)
+	}
+
+	titlesPath := GetConfigScaffoldTitlesPath(configPath)
+	err = checkConfigOutputPath(titlesPath, overwrite)
+	if err != nil {
+		return err
+	}
+
+	titlesData, err := scaffold.MarshalTitles()
+	if err != nil {
+		return err
+	}
+
+	err = writeConfigFile(configPath, configData)
+	if err != nil {
+		return err
+	}
+
+	return writeConfigFile(titlesPath, titlesData)
+}
@@ -0,0 +1,573 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"bdaudiodump/config"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ConfigIssueSeverityError   = "error"
+	ConfigIssueSeverityWarning = "warning"
+)
+
+// ConfigIssue is one problem found in a config.  Pointer is a JSON pointer (RFC 6901) to the
+// value with the problem, or to where a missing value should be.  Line and Column are where
+// that value, or its closest parent that exists, starts in the file at Path.
+type ConfigIssue struct {
+	Severity string `json:"severity"`
+	Path     string `json:"path,omitempty"`
+	Pointer  string `json:"pointer"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Message  string `json:"message"`
+}
+
+func (configIssue ConfigIssue) String() string {
+	issueString := ""
+	if configIssue.Path != "" {
+		issueString = configIssue.Path + ":"
+	}
+
+	issueString = issueString + strconv.Itoa(configIssue.Line) + ":" + strconv.Itoa(configIssue.Column) + ": " + configIssue.Severity + ": "
+	if configIssue.Pointer != "" {
+		issueString = issueString + configIssue.Pointer + ": "
+	}
+
+	return issueString + configIssue.Message
+}
+
+// ConfigValidationError is returned when a config has errors.  It holds every issue that was
+// found, including warnings.
+type ConfigValidationError struct {
+	Issues []ConfigIssue
+}
+
+func (configValidationError *ConfigValidationError) Error() string {
+	configErrors := GetConfigIssuesBySeverity(configValidationError.Issues, ConfigIssueSeverityError)
+	if len(configErrors) == 0 {
+		return "invalid config"
+	}
+
+	message := configErrors[0].String()
+	if len(configErrors) > 1 {
+		message = message + " (and " + strconv.Itoa(len(configErrors)-1) + " more errors)"
+	}
+
+	return message
+}
+
+func (configValidationError *ConfigValidationError) Unwrap() error {
+	return ErrInvalidConfig
+}
+
+func GetConfigIssuesBySeverity(configIssues []ConfigIssue, severity string) []ConfigIssue {
+	matchingIssues := make([]ConfigIssue, 0)
+
+	for _, configIssue := range configIssues {
+		if configIssue.Severity == severity {
+			matchingIssues = append(matchingIssues, configIssue)
+		}
+	}
+
+	return matchingIssues
+}
+
+// ValidateConfigFile reads a config file and checks it, returning the configs along with every
+// issue found.  The error is only for failing to read the file.
+func ValidateConfigFile(configPath string) (*[]BluRayDiscConfig, []ConfigIssue, error) {
+	return ValidateConfigPaths([]string{configPath})
+}
+
+// ValidateConfigData checks a JSON config without stopping at the first problem.  The configs
+// are returned even if there are issues, but they should only be used if none are errors.
+func ValidateConfigData(configData []byte) (*[]BluRayDiscConfig, []ConfigIssue) {
+	return ValidateConfigDataInFormat(configData, ConfigFormatJson)
+}
+
+// ValidateConfigDataInFormat checks a config in any of the supported formats, which are all
+// checked the same way once they're decoded.
+func ValidateConfigDataInFormat(configData []byte, configFormat string) (*[]BluRayDiscConfig, []ConfigIssue) {
+	bluRayConfigs, configIssues, _ := validateConfigData(configData, configFormat)
+
+	return bluRayConfigs, configIssues
+}
+
+// validateConfigData also returns where each value is in the config, which is nil if it couldn't
+// be decoded.  Older versions are migrated first, and checked as the current version.
+func validateConfigData(configData []byte, configFormat string) (*[]BluRayDiscConfig, []ConfigIssue, *configSource) {
+	if configFormat != ConfigFormatJson {
+		document, valueLocations, duplicateKeys, configIssue := decodeFormattedConfigDocument(configData, configFormat)
+		if configIssue != nil {
+			return &[]BluRayDiscConfig{}, []ConfigIssue{*configIssue}, nil
+		}
+
+		source := &configSource{locations: valueLocations, getSourcePointer: func(pointer string) string {
+			return pointer
+		}}
+		validator := &configValidator{source: source, issues: make([]ConfigIssue, 0), reportedPointers: make(map[string]bool)}
+
+		for _, duplicateKeyPointer := range duplicateKeys {
+			validator.addWarning(duplicateKeyPointer, "duplicate key, only the last value is used")
+		}
+
+		return validator.checkConfigDocument(document), validator.issues, source
+	}
+
+	locations, err := getJsonLocations(configData)
+	if err != nil {
+		configIssue := ConfigIssue{Severity: ConfigIssueSeverityError, Message: "invalid JSON: " + err.Error()}
+
+		var syntaxError *json.SyntaxError
+		if errors.As(err, &syntaxError) {
+			configIssue.Line, configIssue.Column = getOffsetLineColumn(configData, syntaxError.Offset)
+		} else {
+			configIssue.Line, configIssue.Column = getOffsetLineColumn(configData, int64(len(configData)))
+		}
+
+		return &[]BluRayDiscConfig{}, []ConfigIssue{configIssue}, nil
+	}
+
+	source := &configSource{locations: locations, getSourcePointer: func(pointer string) string {
+		return pointer
+	}}
+	validator := &configValidator{source: source, issues: make([]ConfigIssue, 0), reportedPointers: make(map[string]bool)}
+
+	// These pointers are from the file as it's written, so they're reported before the config
+	// is migrated
+	for _, duplicateKeyPointer := range locations.duplicateKeys {
+		validator.addWarning(duplicateKeyPointer, "duplicate key, only the last value is used")
+	}
+
+	document, err := decodeConfigDocument(configData)
+	if err != nil {
+		validator.addError("", "invalid JSON: "+err.Error())
+		return &[]BluRayDiscConfig{}, validator.issues, source
+	}
+
+	return validator.checkConfigDocument(document), validator.issues, source
+}
+
+// checkConfigDocument migrates and checks a decoded config, returning its discs
+func (validator *configValidator) checkConfigDocument(document any) *[]BluRayDiscConfig {
+	bluRayConfigs := make([]BluRayDiscConfig, 0)
+
+	migratedDocument, _, getSourcePointer, err := MigrateConfigDocument(document)
+	if err != nil {
+		versionPointer := ""
+		if _, isObject := document.(map[string]any); isObject {
+			versionPointer = "/version"
+		}
+
+		validator.addError(versionPointer, err.Error())
+		return &bluRayConfigs
+	}
+
+	validator.source.getSourcePointer = getSourcePointer
+	validator.checkFormatSchema(migratedDocument)
+
+	// Decode errors only have an offset, so find which value it's in from the migrated config
+	migratedData, err := json.Marshal(migratedDocument)
+	if err != nil {
+		validator.addError("", err.Error())
+		return &bluRayConfigs
+	}
+
+	migratedLocations, err := getJsonLocations(migratedData)
+	if err != nil {
+		validator.addError("", err.Error())
+		return &bluRayConfigs
+	}
+
+	var rawConfigFile struct {
+		Discs []json.RawMessage `json:"discs"`
+	}
+	err = json.Unmarshal(migratedData, &rawConfigFile)
+	if err != nil {
+		validator.addError("/discs", "discs must be an array")
+		return &bluRayConfigs
+	}
+
+	for i, rawConfig := range rawConfigFile.Discs {
+		discPointer := "/discs/" + strconv.Itoa(i)
+
+		var bluRayConfig BluRayDiscConfig
+		err = json.Unmarshal(rawConfig, &bluRayConfig)
+		if err != nil {
+			var typeError *json.UnmarshalTypeError
+			if errors.As(err, &typeError) {
+				typeErrorPointer := migratedLocations.getOffsetPointer(migratedLocations.valueLocations[discPointer].Start + typeError.Offset)
+				validator.addError(typeErrorPointer, "invalid type ("+typeError.Value+"), expected "+typeError.Type.String())
+				validator.reportedPointers[typeErrorPointer] = true
+			} else {
+				validator.addError(discPointer, err.Error())
+			}
+		}
+
+		bluRayConfigs = append(bluRayConfigs, bluRayConfig)
+	}
+
+	validator.checkDiscConfigs(bluRayConfigs)
+	sortConfigIssues(validator.issues)
+
+	return &bluRayConfigs
+}
+
+// configLocator finds the line and column of the value at a JSON pointer in a config file
+type configLocator interface {
+	getPointerLocation(pointer string) (line int, column int)
+}
+
+// configSource finds where values in a migrated config are in the file it was read from
+type configSource struct {
+	locations        configLocator
+	getSourcePointer func(pointer string) string
+}
+
+func (source *configSource) getLocation(pointer string) (line int, column int) {
+	return source.locations.getPointerLocation(source.getSourcePointer(pointer))
+}
+
+func (source *configSource) getIssue(severity string, pointer string, message string) ConfigIssue {
+	line, column := source.getLocation(pointer)
+
+	return ConfigIssue{Severity: severity, Pointer: source.getSourcePointer(pointer), Line: line, Column: column, Message: message}
+}
+
+func sortConfigIssues(configIssues []ConfigIssue) {
+	sort.SliceStable(configIssues, func(i int, j int) bool {
+		if configIssues[i].Line != configIssues[j].Line {
+			return configIssues[i].Line < configIssues[j].Line
+		}
+
+		return configIssues[i].Column < configIssues[j].Column
+	})
+}
+
+type configValidator struct {
+	source *configSource
+	issues []ConfigIssue
+
+	// Values the schema rejected or that couldn't be decoded are only reported once, and values
+	// left empty by a decode error shouldn't also be reported as missing
+	reportedPointers map[string]bool
+}
+
+// isReported is whether any of the values, or a value containing one of them, was rejected by
+// the schema or couldn't be decoded.  Checks that compare against those values are skipped, since
+// they'd only report the same mistake again.
+func (validator *configValidator) isReported(pointers ...string) bool {
+	for _, pointer := range pointers {
+		for {
+			if validator.reportedPointers[pointer] {
+				return true
+			}
+
+			lastSlashIndex := strings.LastIndex(pointer, "/")
+			if lastSlashIndex < 0 {
+				break
+			}
+			pointer = pointer[:lastSlashIndex]
+		}
+	}
+
+	return false
+}
+
+func (validator *configValidator) addIssue(severity string, pointer string, message string) {
+	if validator.isReported(pointer) {
+		return
+	}
+
+	validator.issues = append(validator.issues, validator.source.getIssue(severity, pointer, message))
+}
+
+func (validator *configValidator) addError(pointer string, message string) {
+	validator.addIssue(ConfigIssueSeverityError, pointer, message)
+}
+
+func (validator *configValidator) addWarning(pointer string, message string) {
+	validator.addIssue(ConfigIssueSeverityWarning, pointer, message)
+}
+
+var (
+	configFormatSchema     map[string]any
+	configFormatSchemaErr  error
+	configFormatSchemaOnce sync.Once
+)
+
+func getConfigFormatSchema() (map[string]any, error) {
+	configFormatSchemaOnce.Do(func() {
+		configFormatSchemaErr = json.Unmarshal(config.FormatSchema, &configFormatSchema)
+	})
+
+	return configFormatSchema, configFormatSchemaErr
+}
+
+// checkFormatSchema validates the config against config/config_format_schema.json, so the tool
+// rejects the same configs as editors using the schema.  It runs before the other checks, which
+// don't report values the schema already rejected.
+func (validator *configValidator) checkFormatSchema(document any) {
+	formatSchema, err := getConfigFormatSchema()
+	if err != nil {
+		validator.addError("", "invalid config format schema: "+err.Error())
+		return
+	}
+
+	schemaErrorPointers := make([]string, 0)
+	validateJsonSchema(formatSchema, document, func(pointer string, message string) {
+		validator.addError(pointer, message)
+		schemaErrorPointers = append(schemaErrorPointers, pointer)
+	})
+
+	for _, schemaErrorPointer := range schemaErrorPointers {
+		validator.reportedPointers[schemaErrorPointer] = true
+	}
+}
+
+func (validator *configValidator) checkDiscConfigs(bluRayConfigs []BluRayDiscConfig) {
+	discVolumeSha1s := make(map[string]bool)
+
+	for i := range bluRayConfigs {
+		discConfig := &bluRayConfigs[i]
+		discPointer := "/discs/" + strconv.Itoa(i)
+
+		discDescription := discConfig.BluRayTitle
+		if discDescription == "" {
+			discDescription = "index " + strconv.Itoa(i)
+		}
+
+		if discConfig.DiscVolumeKeySha1 == "" && len(discConfig.Variants) == 0 {
+			validator.addError(discPointer+"/disc_volume_key_sha1", "missing disc volume key SHA1 for disc: "+discDescription)
+		}
+
+		if discConfig.DiscVolumeKeySha1 != "" {
+			if discVolumeSha1s[discConfig.DiscVolumeKeySha1] {
+				validator.addError(discPointer+"/disc_volume_key_sha1", "duplicate disc volume key SHA1: "+discConfig.DiscVolumeKeySha1)
+			} else {
+				discVolumeSha1s[discConfig.DiscVolumeKeySha1] = true
+			}
+		}
+
+		if discConfig.DiscIdentifierType != "" && !IsValidDiscIdentifierType(discConfig.DiscIdentifierType) {
+			validator.addError(discPointer+"/disc_identifier_type", "invalid disc identifier type ("+discConfig.DiscIdentifierType+") for disc: "+discDescription)
+		}
+
+		variantNames := make(map[string]bool)
+
+		for variantIndex, variant := range discConfig.Variants {
+			variantPointer := discPointer + "/variants/" + strconv.Itoa(variantIndex)
+
+			if variant.VariantName == "" {
+				validator.addError(variantPointer+"/variant_name", "missing variant name for variant index "+strconv.Itoa(variantIndex)+" for disc: "+discDescription)
+			} else if variantNames[variant.VariantName] {
+				validator.addError(variantPointer+"/variant_name", "duplicate variant name ("+variant.VariantName+") for disc: "+discDescription)
+			} else {
+				variantNames[variant.VariantName] = true
+			}
+
+			if variant.DiscVolumeKeySha1 == "" {
+				validator.addError(variantPointer+"/disc_volume_key_sha1", "missing disc volume key SHA1 for variant "+variant.VariantName+" for disc: "+discDescription)
+			} else if discVolumeSha1s[variant.DiscVolumeKeySha1] {
+				validator.addError(variantPointer+"/disc_volume_key_sha1", "duplicate disc volume key SHA1: "+variant.DiscVolumeKeySha1)
+			} else {
+				discVolumeSha1s[variant.DiscVolumeKeySha1] = true
+			}
+
+			if variant.DiscIdentifierType != "" && !IsValidDiscIdentifierType(variant.DiscIdentifierType) {
+				validator.addError(variantPointer+"/disc_identifier_type", "invalid disc identifier type ("+variant.DiscIdentifierType+") for variant "+variant.VariantName+" for disc: "+discDescription)
+			}
+
+			for overrideIndex, trackOverride := range variant.TrackOverrides {
+				overridePointer := variantPointer + "/track_overrides/" + strconv.Itoa(overrideIndex)
+
+				_, err := GetTrack(trackOverride.AlbumNumber, trackOverride.DiscNumber, trackOverride.TrackNumber, *discConfig)
+				if err != nil && !validator.isReported(overridePointer+"/album_number", overridePointer+"/disc_number", overridePointer+"/track_number") {
+					validator.addError(overridePointer, "track override for variant "+variant.VariantName+" doesn't match a track (album "+strconv.Itoa(trackOverride.AlbumNumber)+", disc "+strconv.Itoa(trackOverride.DiscNumber)+", track "+strconv.Itoa(trackOverride.TrackNumber)+") for disc: "+discDescription)
+				}
+				if trackOverride.TrimStartS != nil && *trackOverride.TrimStartS < 0 {
+					validator.addError(overridePointer+"/trim_start_s", "negative trim in track override for variant "+variant.VariantName+" for track "+strconv.Itoa(trackOverride.TrackNumber)+" for disc: "+discDescription)
+				}
+				if trackOverride.TrimEndS != nil && *trackOverride.TrimEndS < 0 {
+					validator.addError(overridePointer+"/trim_end_s", "negative trim in track override for variant "+variant.VariantName+" for track "+strconv.Itoa(trackOverride.TrackNumber)+" for disc: "+discDescription)
+				}
+			}
+		}
+
+		if discConfig.BluRayTitle == "" {
+			validator.addError(discPointer+"/bluray_title", "missing Blu-ray title for disc: "+discDescription)
+		}
+		if discConfig.MakemkvPrefix == "" {
+			validator.addError(discPointer+"/makemkv_prefix", "missing MakeMKV prefix for disc: "+discDescription)
+		}
+		if len(discConfig.Albums) == 0 {
+			validator.addError(discPointer+"/albums", "missing album for disc: "+discDescription)
+		}
+
+		validator.checkAlbums(discPointer, discConfig, discDescription)
+	}
+}
+
+func (validator *configValidator) checkAlbums(discPointer string, discConfig *BluRayDiscConfig, discDescription string) {
+	albumNums := make(map[int]bool)
+	albumTitles := make(map[string]bool)
+
+	for albumIndex := range discConfig.Albums {
+		album := &discConfig.Albums[albumIndex]
+		albumPointer := discPointer + "/albums/" + strconv.Itoa(albumIndex)
+
+		albumDescription := album.AlbumTitle
+		if albumDescription == "" {
+			albumDescription = "index " + strconv.Itoa(albumIndex)
+		}
+
+		if album.AlbumNumber < 1 {
+			validator.addError(albumPointer+"/album_number", "missing album number for album index "+strconv.Itoa(albumIndex)+" for disc: "+discDescription)
+		} else if albumNums[album.AlbumNumber] {
+			validator.addError(albumPointer+"/album_number", "duplicate album number for album "+albumDescription+" for disc: "+discDescription)
+		} else {
+			albumNums[album.AlbumNumber] = true
+		}
+
+		if album.AlbumTitle == "" {
+			validator.addError(albumPointer+"/album_title", "missing album title for album index "+strconv.Itoa(albumIndex)+" for disc: "+discDescription)
+		} else if albumTitles[album.AlbumTitle] {
+			validator.addError(albumPointer+"/album_title", "duplicate album title for album number "+strconv.Itoa(album.AlbumNumber)+" for disc: "+discDescription)
+		} else {
+			albumTitles[album.AlbumTitle] = true
+		}
+
+		if album.AlbumArtist == "" {
+			validator.addError(albumPointer+"/album_artist", "missing album artist for album "+albumDescription+" for disc: "+discDescription)
+		}
+		if album.Genre == "" {
+			validator.addError(albumPointer+"/genre", "missing genre for album "+albumDescription+" for disc: "+discDescription)
+		}
+		if album.ReleaseDate == "" {
+			validator.addError(albumPointer+"/release_date", "missing release date for album "+albumDescription+" for disc: "+discDescription)
+		} else if _, err := time.Parse(time.DateOnly, album.ReleaseDate); err != nil {
+			validator.addError(albumPointer+"/release_date", "invalid date (must be YYYY-MM-DD format) for release date for album "+albumDescription+" for disc: "+discDescription)
+		}
+		if album.TotalDiscs < 1 {
+			validator.addError(albumPointer+"/total_discs", "invalid total number of discs ("+strconv.Itoa(album.TotalDiscs)+") for album "+albumDescription+" for disc: "+discDescription)
+		}
+		if album.CoverUrl != "" {
+			parsedUrl, err := url.Parse(album.CoverUrl)
+			if err != nil || (parsedUrl.Scheme != "http" && parsedUrl.Scheme != "https") {
+				validator.addError(albumPointer+"/cover_url", "invalid URL (must be HTTP or HTTPS) for cover image for album "+albumDescription+" for disc: "+discDescription)
+			}
+		}
+		if album.CoverType == "" {
+			validator.addError(albumPointer+"/cover_type", "missing cover type for album "+albumDescription+" for disc: "+discDescription)
+		}
+
+		// These are documented as unused for some cover types, so they're probably mistakes.  A
+		// cover type that isn't valid is already an error, and says nothing about the other fields.
+		coverTypeReported := validator.isReported(albumPointer + "/cover_type")
+		if album.CoverUrl != "" && album.CoverType != "" && album.CoverType != "url" && !coverTypeReported {
+			validator.addWarning(albumPointer+"/cover_url", "cover URL is unused when the cover type is "+album.CoverType+" for album "+albumDescription+" for disc: "+discDescription)
+		}
+		if album.CoverRelativePath != "" && album.CoverType == "url" && !coverTypeReported {
+			validator.addWarning(albumPointer+"/cover_relative_path", "cover relative path is unused when the cover type is url for album "+albumDescription+" for disc: "+discDescription)
+		}
+
+		album.CoverContainerRelativePath = strings.ReplaceAll(album.CoverContainerRelativePath, "/", string(os.PathSeparator))
+		album.CoverRelativePath = strings.ReplaceAll(album.CoverRelativePath, "/", string(os.PathSeparator))
+
+		if len(album.Discs) == 0 {
+			validator.addError(albumPointer+"/discs", "no discs found for album "+albumDescription+" for disc: "+discDescription)
+		}
+
+		validator.checkAlbumDiscs(albumPointer, *album, albumDescription, discDescription)
+	}
+}
+
+func (validator *configValidator) checkAlbumDiscs(albumPointer string, album BluRayDiscConfigAlbum, albumDescription string, discDescription string) {
+	discNums := make(map[int]bool)
+
+	for discIndex, disc := range album.Discs {
+		albumDiscPointer := albumPointer + "/discs/" + strconv.Itoa(discIndex)
+
+		if disc.DiscNumber < 1 {
+			validator.addError(albumDiscPointer+"/disc_number", "invalid disc number ("+strconv.Itoa(disc.DiscNumber)+") for album "+albumDescription+" for disc: "+discDescription)
+		} else if disc.DiscNumber > album.TotalDiscs && !validator.isReported(albumPointer+"/total_discs") {
+			validator.addError(albumDiscPointer+"/disc_number", "disc number is greater than total discs for disc number "+strconv.Itoa(disc.DiscNumber)+" for album "+albumDescription+" for disc: "+discDescription)
+		} else if discNums[disc.DiscNumber] {
+			validator.addError(albumDiscPointer+"/disc_number", "duplicate disc number ("+strconv.Itoa(disc.DiscNumber)+") for album "+albumDescription+" for disc: "+discDescription)
+		} else {
+			discNums[disc.DiscNumber] = true
+		}
+
+		totalTracksReported := validator.isReported(albumDiscPointer + "/total_tracks")
+		if disc.TotalTracks != len(disc.Tracks) && !totalTracksReported && !validator.isReported(albumDiscPointer+"/tracks") {
+			validator.addError(albumDiscPointer+"/total_tracks", "number of tracks does not match total track value for disc number "+strconv.Itoa(disc.DiscNumber)+" for album "+albumDescription+" for disc: "+discDescription)
+		}
+
+		trackNums := make(map[int]bool)
+		trackSuffix := " for disc number " + strconv.Itoa(disc.DiscNumber) + " for album " + albumDescription + " for disc: " + discDescription
+
+		for trackIndex, track := range disc.Tracks {
+			trackPointer := albumDiscPointer + "/tracks/" + strconv.Itoa(trackIndex)
+			trackDescription := "track " + strconv.Itoa(track.TrackNumber)
+
+			if track.TrackNumber < 1 || (track.TrackNumber > disc.TotalTracks && !totalTracksReported) {
+				validator.addError(trackPointer+"/track_number", "invalid track number ("+strconv.Itoa(track.TrackNumber)+")"+trackSuffix)
+			} else if trackNums[track.TrackNumber] {
+				validator.addError(trackPointer+"/track_number", "duplicate track number ("+strconv.Itoa(track.TrackNumber)+")"+trackSuffix)
+			} else {
+				trackNums[track.TrackNumber] = true
+			}
+
+			if track.TitleNumber == "" {
+				validator.addError(trackPointer+"/title_number", "missing title number for "+trackDescription+trackSuffix)
+			}
+			if len(track.ChapterNumbers) == 0 {
+				validator.addError(trackPointer+"/chapter_numbers", "missing chapters for "+trackDescription+trackSuffix)
+			}
+			for chapterIndex, chapter := range track.ChapterNumbers {
+				if chapter < 0 {
+					validator.addError(trackPointer+"/chapter_numbers/"+strconv.Itoa(chapterIndex), "invalid chapter number ("+strconv.Itoa(chapter)+") for "+trackDescription+trackSuffix)
+				}
+			}
+			for streamIndex, audioStream := range track.AudioStreams {
+				if audioStream.ChannelType != "best" && audioStream.ChannelType != "surround71" && audioStream.ChannelType != "surround51" && audioStream.ChannelType != "stereo21" && audioStream.ChannelType != "stereo20" {
+					validator.addError(trackPointer+"/audio_streams/"+strconv.Itoa(streamIndex)+"/channel_type", "invalid audio stream type ("+audioStream.ChannelType+") for "+trackDescription+trackSuffix)
+				}
+			}
+			if track.TrackTitle == "" {
+				validator.addError(trackPointer+"/track_title", "missing track title for "+trackDescription+trackSuffix)
+			}
+			for artistIndex, artist := range track.Artists {
+				if artist == "" {
+					validator.addError(trackPointer+"/artists/"+strconv.Itoa(artistIndex), "empty artist string for "+trackDescription+trackSuffix)
+				}
+			}
+		}
+	}
+}
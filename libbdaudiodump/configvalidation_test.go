@@ -0,0 +1,282 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testValidationTomlConfig = `version = 2
+
+[[discs]]
+disc_volume_key_sha1 = "0123456789abcdef0123456789abcdef01234567"
+bluray_title = "Test Disc"
+makemkv_prefix = "TEST_DISC"
+
+[[discs.variants]]
+variant_name = "Reissue"
+disc_volume_key_sha1 = "89abcdef0123456789abcdef0123456789abcdef"
+
+[[discs.variants.track_overrides]]
+album_number = 1
+disc_number = 1
+track_number = 2
+trim_start_s = 0.5
+
+[[discs.albums]]
+album_number = 1
+album_title = "Test Album"
+album_artist = "Test Artist"
+genre = "Game"
+release_date = "2014-03-26"
+total_discs = 1
+cover_url = "https://example.com/cover.jpg"
+cover_type = "url"
+
+[[discs.albums.discs]]
+disc_number = 1
+total_tracks = 2
+
+[[discs.albums.discs.tracks]]
+track_number = 1
+title_number = "00"
+chapter_numbers = [0]
+track_title = "First"
+
+[[discs.albums.discs.tracks]]
+track_number = 2
+title_number = "00"
+chapter_numbers = [1, 2]
+track_title = "Second"
+`
+
+type expectedConfigIssue struct {
+	severity string
+	pointer  string
+	message  string
+}
+
+func checkConfigIssues(t *testing.T, configIssues []ConfigIssue, expectedIssues []expectedConfigIssue) {
+	t.Helper()
+
+	if len(configIssues) != len(expectedIssues) {
+		t.Fatalf("got issues %v, expected %d", configIssues, len(expectedIssues))
+	}
+
+	for i, expectedIssue := range expectedIssues {
+		configIssue := configIssues[i]
+		if configIssue.Severity != expectedIssue.severity || configIssue.Pointer != expectedIssue.pointer || !strings.HasPrefix(configIssue.Message, expectedIssue.message) {
+			t.Errorf("got issue %s, expected %s: %s: %s...", configIssue, expectedIssue.severity, expectedIssue.pointer, expectedIssue.message)
+		}
+	}
+}
+
+func TestValidateConfigReportsEachMistakeOnce(t *testing.T) {
+	albumPointer := "/discs/0/albums/0"
+
+	tests := []struct {
+		name           string
+		oldLine        string
+		newLine        string
+		expectedIssues []expectedConfigIssue
+	}{
+		{
+			name:           "valid config",
+			expectedIssues: []expectedConfigIssue{},
+		},
+		{
+			name:    "total discs that isn't a number",
+			oldLine: "total_discs = 1",
+			newLine: `total_discs = "x"`,
+			expectedIssues: []expectedConfigIssue{
+				{severity: ConfigIssueSeverityError, pointer: albumPointer + "/total_discs", message: "invalid type (string), expected integer"},
+			},
+		},
+		{
+			name:    "disc number greater than a valid total discs",
+			oldLine: "disc_number = 1\ntotal_tracks",
+			newLine: "disc_number = 2\ntotal_tracks",
+			expectedIssues: []expectedConfigIssue{
+				{severity: ConfigIssueSeverityError, pointer: "/discs/0/variants/0/track_overrides/0", message: "track override for variant Reissue doesn't match a track"},
+				{severity: ConfigIssueSeverityError, pointer: albumPointer + "/discs/0/disc_number", message: "disc number is greater than total discs"},
+			},
+		},
+		{
+			name:    "unknown cover type",
+			oldLine: `cover_type = "url"`,
+			newLine: `cover_type = "jpeg"`,
+			expectedIssues: []expectedConfigIssue{
+				{severity: ConfigIssueSeverityError, pointer: albumPointer + "/cover_type", message: "invalid value (\"jpeg\"), must be one of"},
+			},
+		},
+		{
+			name:    "cover URL with another cover type",
+			oldLine: `cover_type = "url"`,
+			newLine: "cover_type = \"plain\"\ncover_relative_path = \"cover.jpg\"",
+			expectedIssues: []expectedConfigIssue{
+				{severity: ConfigIssueSeverityWarning, pointer: albumPointer + "/cover_url", message: "cover URL is unused when the cover type is plain"},
+			},
+		},
+		{
+			name:    "total tracks that isn't a number",
+			oldLine: "total_tracks = 2",
+			newLine: `total_tracks = "two"`,
+			expectedIssues: []expectedConfigIssue{
+				{severity: ConfigIssueSeverityError, pointer: albumPointer + "/discs/0/total_tracks", message: "invalid type (string), expected integer"},
+			},
+		},
+		{
+			name:    "track override with a track number that isn't a number",
+			oldLine: "track_number = 2\ntrim_start_s",
+			newLine: "track_number = \"2\"\ntrim_start_s",
+			expectedIssues: []expectedConfigIssue{
+				{severity: ConfigIssueSeverityError, pointer: "/discs/0/variants/0/track_overrides/0/track_number", message: "invalid type (string), expected integer"},
+			},
+		},
+		{
+			name:    "track override for a missing track",
+			oldLine: "track_number = 2\ntrim_start_s",
+			newLine: "track_number = 3\ntrim_start_s",
+			expectedIssues: []expectedConfigIssue{
+				{severity: ConfigIssueSeverityError, pointer: "/discs/0/variants/0/track_overrides/0", message: "track override for variant Reissue doesn't match a track"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configData := testValidationTomlConfig
+			if test.oldLine != "" {
+				if !strings.Contains(configData, test.oldLine) {
+					t.Fatalf("test config doesn't contain: %s", test.oldLine)
+				}
+				configData = strings.Replace(configData, test.oldLine, test.newLine, 1)
+			}
+
+			_, configIssues := ValidateConfigDataInFormat([]byte(configData), ConfigFormatToml)
+			checkConfigIssues(t, configIssues, test.expectedIssues)
+		})
+	}
+}
+
+func TestValidateConfigReportsLocations(t *testing.T) {
+	configData := `{
+    "version": 2,
+    "discs": [
+        {
+            "disc_volume_key_sha1": "NOT A SHA1",
+            "bluray_title": "Test Disc",
+            "makemkv_prefix": "TEST_DISC",
+            "albums": [
+                {
+                    "album_number": 1,
+                    "album_title": "Test Album",
+                    "album_artist": "Test Artist",
+                    "genre": "Game",
+                    "release_date": "2014-03-26",
+                    "total_discs": 1,
+                    "cover_url": "https://example.com/cover.jpg",
+                    "cover_type": "url",
+                    "colour": "blue",
+                    "discs": [
+                        {
+                            "disc_number": 1,
+                            "total_tracks": 1,
+                            "tracks": [
+                                {"track_number": 1, "title_number": 0, "chapter_numbers": [0], "track_title": "First"}
+                            ]
+                        }
+                    ]
+                }
+            ]
+        }
+    ]
+}
+`
+
+	_, configIssues := ValidateConfigData([]byte(configData))
+
+	expectedIssues := []ConfigIssue{
+		{Severity: ConfigIssueSeverityError, Pointer: "/discs/0/disc_volume_key_sha1", Line: 5, Column: 37, Message: `invalid value ("NOT A SHA1"), must match pattern: ^[0-9a-f]{40}$`},
+		{Severity: ConfigIssueSeverityError, Pointer: "/discs/0/albums/0/colour", Line: 18, Column: 31, Message: "unknown field: colour"},
+		{Severity: ConfigIssueSeverityError, Pointer: "/discs/0/albums/0/discs/0/tracks/0/title_number", Line: 24, Column: 69, Message: "invalid type (integer), expected string"},
+	}
+
+	if !reflect.DeepEqual(configIssues, expectedIssues) {
+		t.Errorf("got issues:\n%v\nexpected:\n%v", configIssues, expectedIssues)
+	}
+
+	// A v1 config is migrated before it's checked, but issues still point into the file as written
+	legacyConfigData := "[\n    {\"bluray_title\": \"\"}\n]\n"
+	_, configIssues = ValidateConfigData([]byte(legacyConfigData))
+
+	expectedPointers := map[string]bool{"/0/bluray_title": false, "/0/makemkv_prefix": false, "/0/albums": false}
+	for _, configIssue := range configIssues {
+		if _, isExpected := expectedPointers[configIssue.Pointer]; isExpected && configIssue.Line == 2 {
+			expectedPointers[configIssue.Pointer] = true
+		}
+	}
+
+	for pointer, found := range expectedPointers {
+		if !found {
+			t.Errorf("no issue on line 2 for %s: %v", pointer, configIssues)
+		}
+	}
+
+	// Syntax errors are reported where the JSON stops making sense
+	_, configIssues = ValidateConfigData([]byte("{\n    \"version\": 2,\n    \"discs\": [,]\n}\n"))
+	if len(configIssues) != 1 || configIssues[0].Line != 3 || configIssues[0].Column != 16 || configIssues[0].Severity != ConfigIssueSeverityError {
+		t.Errorf("unexpected issues for invalid JSON: %v", configIssues)
+	}
+}
+
+// The bundled config is what editors check against the schema, so it has to be in the version
+// the schema describes
+func TestBundledConfigIsValid(t *testing.T) {
+	configPath := filepath.Join("..", "config", "bdaudiodump_config.json")
+
+	configData, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	document, err := decodeConfigDocument(configData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := GetConfigDocumentVersion(document)
+	if err != nil || version != CurrentConfigVersion {
+		t.Errorf("bundled config is version %d, expected %d: %v", version, CurrentConfigVersion, err)
+	}
+
+	_, configIssues, err := ValidateConfigFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(configIssues) != 0 {
+		t.Errorf("unexpected issues in the bundled config: %v", configIssues)
+	}
+}
@@ -0,0 +1,171 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const (
+	ProcCdromInfoPath = "/proc/sys/dev/cdrom/info"
+	DiskByLabelPath   = "/dev/disk/by-label"
+)
+
+// OpticalDevice is an optical drive.  MountPoint and DiscLabel are empty if there's no disc
+// mounted from it.
+type OpticalDevice struct {
+	DevicePath string
+	MountPoint string
+	DiscLabel  string
+}
+
+// GetMountPointForDevice finds where the disc in a drive is mounted from the drive's device path,
+// such as /dev/sr0, without going through makemkvcon.  On Windows, the device path is the drive
+// letter (e.g., "D:"), which is also where the disc is mounted.
+func GetMountPointForDevice(ctx context.Context, devicePath string) (string, error) {
+	if runtime.GOOS == "windows" {
+		return strings.TrimRight(devicePath, string(os.PathSeparator)) + string(os.PathSeparator), nil
+	}
+
+	_, err := os.Stat(devicePath)
+	if err != nil {
+		return "", errors.New("unable to find device: " + devicePath)
+	}
+
+	return GetMountPointForDevicePath(ctx, devicePath)
+}
+
+// GetOpticalDevices lists the optical drives, along with where their discs are mounted.  On Linux,
+// the drives are read from the kernel, and on other platforms, makemkvcon is asked for them.
+func GetOpticalDevices(ctx context.Context) ([]OpticalDevice, error) {
+	opticalDevices := make([]OpticalDevice, 0)
+
+	if runtime.GOOS == "linux" || runtime.GOOS == "android" {
+		cdromInfo, err := os.ReadFile(ProcCdromInfoPath)
+		if errors.Is(err, os.ErrNotExist) {
+			return opticalDevices, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		for _, driveName := range ParseCdromInfoDriveNames(string(cdromInfo)) {
+			devicePath := "/dev/" + driveName
+
+			opticalDevice := OpticalDevice{DevicePath: devicePath}
+
+			// Drives without a mounted disc are still listed
+			opticalDevice.MountPoint, _ = GetMountPointForDevice(ctx, devicePath)
+			if opticalDevice.MountPoint != "" {
+				opticalDevice.DiscLabel = GetDiscLabelForDevice(devicePath)
+				if opticalDevice.DiscLabel == "" {
+					opticalDevice.DiscLabel = filepath.Base(opticalDevice.MountPoint)
+				}
+			}
+
+			opticalDevices = append(opticalDevices, opticalDevice)
+		}
+
+		return opticalDevices, nil
+	}
+
+	drives, err := GetMakemkvconDrives(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, drive := range drives {
+		if drive.DevicePath == "" {
+			continue
+		}
+
+		opticalDevice := OpticalDevice{DevicePath: drive.DevicePath}
+
+		if drive.HasDisc() {
+			opticalDevice.MountPoint, _ = GetMountPointForDevice(ctx, drive.DevicePath)
+			opticalDevice.DiscLabel = drive.DiscName
+		}
+
+		opticalDevices = append(opticalDevices, opticalDevice)
+	}
+
+	return opticalDevices, nil
+}
+
+// ParseCdromInfoDriveNames returns the drive names, such as sr0, from the contents of
+// /proc/sys/dev/cdrom/info.
+func ParseCdromInfoDriveNames(cdromInfo string) []string {
+	for _, line := range strings.Split(cdromInfo, "\n") {
+		driveNames, found := strings.CutPrefix(line, "drive name:")
+		if found {
+			return strings.Fields(driveNames)
+		}
+	}
+
+	return make([]string, 0)
+}
+
+// GetDiscLabelForDevice looks up the label of the disc in a drive from udev's /dev/disk/by-label
+// links.  It returns an empty string if the label can't be found.
+func GetDiscLabelForDevice(devicePath string) string {
+	labelEntries, err := os.ReadDir(DiskByLabelPath)
+	if err != nil {
+		return ""
+	}
+
+	resolvedDevicePath := resolveDevicePath(devicePath)
+
+	for _, labelEntry := range labelEntries {
+		if resolveDevicePath(filepath.Join(DiskByLabelPath, labelEntry.Name())) == resolvedDevicePath {
+			return DecodeUdevEscapes(labelEntry.Name())
+		}
+	}
+
+	return ""
+}
+
+// DecodeUdevEscapes decodes the \xNN escapes udev uses in link names, such as \x20 for a space.
+func DecodeUdevEscapes(name string) string {
+	if !strings.Contains(name, `\x`) {
+		return name
+	}
+
+	var decodedName strings.Builder
+
+	for i := 0; i < len(name); i++ {
+		if strings.HasPrefix(name[i:], `\x`) && i+4 <= len(name) {
+			hexValue, err := strconv.ParseUint(name[i+2:i+4], 16, 8)
+			if err == nil {
+				decodedName.WriteByte(byte(hexValue))
+				i += 3
+				continue
+			}
+		}
+
+		decodedName.WriteByte(name[i])
+	}
+
+	return decodedName.String()
+}
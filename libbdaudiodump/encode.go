@@ -20,18 +20,21 @@
 package libbdaudiodump
 
 import (
+	"context"
 	"errors"
-	"os/exec"
+	"io"
+	"os"
 	"strconv"
+	"time"
 )
 
-func CompressFlac(flacPath string) error {
-	flacExecPath, err := exec.LookPath("flac")
-	if err != nil {
-		return err
-	}
+func CompressFlac(ctx context.Context, flacPath string, albumNumber int, discNumber int, trackNumber int) (err error) {
+	ctx = WithLogAttrs(ctx, LogKeyStage, StageCompress)
 
-	_, err = exec.Command(flacExecPath, "-8f", flacPath).CombinedOutput()
+	finishStage := observeStage(ctx, StageCompress, TrackJob{AlbumNumber: albumNumber, DiscNumber: discNumber, TrackNumber: trackNumber})
+	defer func() { finishStage(err) }()
+
+	_, err = runTool(ctx, "flac", GetCompressFlacArgs(flacPath)...)
 	if err != nil {
 		return err
 	}
@@ -39,104 +42,177 @@ func CompressFlac(flacPath string) error {
 	return nil
 }
 
-func TagFlac(basePath string, albumNumber int, discNumber int, trackNumber int, coverPath string, discConfig BluRayDiscConfig, replaceSpaceWithUnderscore bool) error {
-	track, err := GetTrack(albumNumber, discNumber, trackNumber, discConfig)
-	if err != nil {
-		return err
-	}
+func TagFlac(ctx context.Context, basePath string, albumNumber int, discNumber int, trackNumber int, coverPath string, discConfig BluRayDiscConfig, replaceSpaceWithUnderscore bool) (err error) {
+	ctx = WithLogAttrs(ctx, LogKeyStage, StageTag)
+
+	trackCompletedEvent := TrackCompletedEvent{Track: TrackJob{AlbumNumber: albumNumber, DiscNumber: discNumber, TrackNumber: trackNumber}}
+	finishStage := observeStage(ctx, StageTag, trackCompletedEvent.Track)
+	defer func() {
+		finishStage(err)
+		if err == nil {
+			notifyObservers(ctx, trackCompletedEvent)
+		}
+	}()
 
 	flacPath, err := GetFlacPathByTrackNumber(basePath, albumNumber, discNumber, trackNumber, discConfig, replaceSpaceWithUnderscore)
 	if err != nil {
 		return err
 	}
 
-	err = RemoveFlacTags(flacPath)
+	metaflacArgs, err := GetTagFlacArgs(basePath, albumNumber, discNumber, trackNumber, coverPath, discConfig, replaceSpaceWithUnderscore)
 	if err != nil {
 		return err
 	}
 
-	err = ApplyFlacTag(albumNumber, discNumber, trackNumber, flacPath, "ALBUM", discConfig)
-	if err != nil {
-		return err
+	for _, args := range metaflacArgs {
+		_, err = runTool(ctx, "metaflac", args...)
+		if err != nil {
+			return err
+		}
 	}
 
-	err = ApplyFlacTag(albumNumber, discNumber, trackNumber, flacPath, "ALBUMARTIST", discConfig)
-	if err != nil {
-		return err
+	trackCompletedEvent.FlacPath = flacPath
+	flacDuration, durationErr := GetFlacDuration(flacPath)
+	if durationErr != nil {
+		GetLogger(ctx).Debug("Unable to read FLAC duration", "path", flacPath, LogKeyError, durationErr.Error())
+	} else {
+		trackCompletedEvent.Duration = flacDuration
 	}
 
-	err = ApplyFlacTag(albumNumber, discNumber, trackNumber, flacPath, "GENRE", discConfig)
+	return nil
+}
+
+// GetFlacDuration reads the length of the audio in a FLAC file from its STREAMINFO block.
+func GetFlacDuration(flacPath string) (time.Duration, error) {
+	flacFile, err := os.Open(flacPath)
 	if err != nil {
-		return err
+		return 0, err
 	}
+	defer flacFile.Close()
 
-	err = ApplyFlacTag(albumNumber, discNumber, trackNumber, flacPath, "DATE", discConfig)
-	if err != nil {
-		return err
+	// The "fLaC" marker, then the STREAMINFO block header, then the STREAMINFO block itself
+	flacHeader := make([]byte, 4+4+34)
+	_, err = io.ReadFull(flacFile, flacHeader)
+	if err != nil || string(flacHeader[0:4]) != "fLaC" || flacHeader[4]&0x7f != 0 {
+		return 0, errors.New("not a FLAC file: " + flacPath)
 	}
 
-	err = ApplyFlacTag(albumNumber, discNumber, trackNumber, flacPath, "TRACKNUMBER", discConfig)
-	if err != nil {
-		return err
+	streamInfo := flacHeader[8:]
+	sampleRate := uint64(streamInfo[10])<<12 | uint64(streamInfo[11])<<4 | uint64(streamInfo[12])>>4
+	totalSamples := uint64(streamInfo[13]&0x0f)<<32 | uint64(streamInfo[14])<<24 | uint64(streamInfo[15])<<16 | uint64(streamInfo[16])<<8 | uint64(streamInfo[17])
+	if sampleRate == 0 {
+		return 0, errors.New("invalid sample rate in FLAC file: " + flacPath)
 	}
 
-	err = ApplyFlacTag(albumNumber, discNumber, trackNumber, flacPath, "DISCNUMBER", discConfig)
+	return time.Duration(totalSamples * uint64(time.Second) / sampleRate), nil
+}
+
+func RemoveFlacTags(ctx context.Context, flacPath string) error {
+	_, err := runTool(ctx, "metaflac", GetRemoveFlacTagsArgs(flacPath)...)
 	if err != nil {
 		return err
 	}
 
-	err = ApplyFlacTag(albumNumber, discNumber, trackNumber, flacPath, "TOTALDISCS", discConfig)
+	return nil
+}
+
+func ApplyFlacTag(ctx context.Context, albumNumber int, discNumber int, trackNumber int, flacPath string, tagType string, discConfig BluRayDiscConfig) error {
+	metaflacArgs, err := GetApplyFlacTagArgs(albumNumber, discNumber, trackNumber, flacPath, tagType, discConfig)
 	if err != nil {
 		return err
 	}
 
-	err = ApplyFlacTag(albumNumber, discNumber, trackNumber, flacPath, "TOTALTRACKS", discConfig)
-	if err != nil {
-		return err
+	for _, args := range metaflacArgs {
+		_, err = runTool(ctx, "metaflac", args...)
+		if err != nil {
+			return err
+		}
 	}
 
-	err = ApplyFlacTag(albumNumber, discNumber, trackNumber, flacPath, "TITLE", discConfig)
+	return nil
+}
+
+func ApplyFlacCoverArt(ctx context.Context, flacPath string, coverPath string) error {
+	_, err := runTool(ctx, "metaflac", GetApplyFlacCoverArtArgs(flacPath, coverPath)...)
 	if err != nil {
 		return err
 	}
 
+	return nil
+}
+
+func GetCompressFlacArgs(flacPath string) []string {
+	return []string{"-8f", flacPath}
+}
+
+func GetFlacTagTypes(track BluRayDiscConfigAlbumDiscTrack) []string {
+	tagTypes := []string{"ALBUM", "ALBUMARTIST", "GENRE", "DATE", "TRACKNUMBER", "DISCNUMBER", "TOTALDISCS", "TOTALTRACKS", "TITLE"}
+
 	if len(track.Artists) != 0 {
-		err = ApplyFlacTag(albumNumber, discNumber, trackNumber, flacPath, "ARTIST", discConfig)
-		if err != nil {
-			return err
-		}
+		tagTypes = append(tagTypes, "ARTIST")
 	}
 
-	if coverPath != "" {
-		err = ApplyFlacCoverArt(flacPath, coverPath)
-		if err != nil {
-			return err
-		}
+	return tagTypes
+}
+
+// GetFlacVariantTagTypes returns the tags describing which pressing of a disc was ripped, if the
+// disc config was resolved to a variant.
+func GetFlacVariantTagTypes(discConfig BluRayDiscConfig) []string {
+	tagTypes := make([]string, 0)
+
+	if discConfig.VariantName != "" {
+		tagTypes = append(tagTypes, "VERSION")
 	}
 
-	return nil
+	if discConfig.CatalogNumber != "" {
+		tagTypes = append(tagTypes, "CATALOGNUMBER")
+	}
+
+	return tagTypes
 }
 
-func RemoveFlacTags(flacPath string) error {
-	metaflacExecPath, err := exec.LookPath("metaflac")
+// GetTagFlacArgs returns the metaflac arguments for every invocation TagFlac runs, in order.
+func GetTagFlacArgs(basePath string, albumNumber int, discNumber int, trackNumber int, coverPath string, discConfig BluRayDiscConfig, replaceSpaceWithUnderscore bool) ([][]string, error) {
+	track, err := GetTrack(albumNumber, discNumber, trackNumber, discConfig)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = exec.Command(metaflacExecPath, "--remove-all-tags", flacPath).CombinedOutput()
+	flacPath, err := GetFlacPathByTrackNumber(basePath, albumNumber, discNumber, trackNumber, discConfig, replaceSpaceWithUnderscore)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	metaflacArgs := [][]string{GetRemoveFlacTagsArgs(flacPath)}
+
+	for _, tagType := range append(GetFlacTagTypes(*track), GetFlacVariantTagTypes(discConfig)...) {
+		tagArgs, err := GetApplyFlacTagArgs(albumNumber, discNumber, trackNumber, flacPath, tagType, discConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		metaflacArgs = append(metaflacArgs, tagArgs...)
+	}
+
+	if coverPath != "" {
+		metaflacArgs = append(metaflacArgs, GetApplyFlacCoverArtArgs(flacPath, coverPath))
+	}
+
+	return metaflacArgs, nil
 }
 
-func ApplyFlacTag(albumNumber int, discNumber int, trackNumber int, flacPath string, tagType string, discConfig BluRayDiscConfig) error {
+func GetRemoveFlacTagsArgs(flacPath string) []string {
+	return []string{"--remove-all-tags", flacPath}
+}
+
+// GetApplyFlacTagArgs returns one set of metaflac arguments per invocation needed
+// for the tag, since ARTIST is set once for each artist on the track.
+func GetApplyFlacTagArgs(albumNumber int, discNumber int, trackNumber int, flacPath string, tagType string, discConfig BluRayDiscConfig) ([][]string, error) {
 	tagContents := ""
 
 	album, disc, track, err := GetAlbumDiscTrack(albumNumber, discNumber, trackNumber, discConfig)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	switch tagType {
@@ -159,43 +235,28 @@ func ApplyFlacTag(albumNumber int, discNumber int, trackNumber int, flacPath str
 		tagContents = strconv.Itoa(disc.TotalTracks)
 	case "TITLE":
 		tagContents = track.TrackTitle
+	case "VERSION":
+		tagContents = discConfig.VariantName
+	case "CATALOGNUMBER":
+		tagContents = discConfig.CatalogNumber
 	case "ARTIST":
 	default:
-		return errors.New("unsupported tag type: " + tagType)
+		return nil, errors.New("unsupported tag type: " + tagType)
 	}
 
-	metaflacExecPath, err := exec.LookPath("metaflac")
-	if err != nil {
-		return err
-	}
+	metaflacArgs := make([][]string, 0)
 
 	if tagType == "ARTIST" {
 		for _, artist := range track.Artists {
-			_, err = exec.Command(metaflacExecPath, "--set-tag=ARTIST="+artist, flacPath).CombinedOutput()
-			if err != nil {
-				return err
-			}
+			metaflacArgs = append(metaflacArgs, []string{"--set-tag=ARTIST=" + artist, flacPath})
 		}
 	} else {
-		_, err = exec.Command(metaflacExecPath, "--set-tag="+tagType+"="+tagContents, flacPath).CombinedOutput()
-		if err != nil {
-			return err
-		}
+		metaflacArgs = append(metaflacArgs, []string{"--set-tag=" + tagType + "=" + tagContents, flacPath})
 	}
 
-	return nil
+	return metaflacArgs, nil
 }
 
-func ApplyFlacCoverArt(flacPath string, coverPath string) error {
-	metaflacExecPath, err := exec.LookPath("metaflac")
-	if err != nil {
-		return err
-	}
-
-	_, err = exec.Command(metaflacExecPath, "--import-picture-from="+coverPath, flacPath).CombinedOutput()
-	if err != nil {
-		return err
-	}
-
-	return nil
+func GetApplyFlacCoverArtArgs(flacPath string, coverPath string) []string {
+	return []string{"--import-picture-from=" + coverPath, flacPath}
 }
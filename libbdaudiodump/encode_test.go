@@ -0,0 +1,139 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestCompressFlacReportsTrack(t *testing.T) {
+	tests := []struct {
+		name     string
+		exitCode int
+	}{
+		{name: "success", exitCode: 0},
+		{name: "failure", exitCode: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fakeCommandRunner := &FakeCommandRunner{Commands: []FakeCommand{{Name: "flac", ExitCode: test.exitCode}}}
+			ctx := WithCommandRunner(context.Background(), fakeCommandRunner)
+
+			// No WithTrackLogAttrs, so the events can only get the track from the arguments
+			events := make([]Event, 0)
+			var eventsMutex sync.Mutex
+			ctx = WithObserver(ctx, ObserverFunc(func(event Event) {
+				eventsMutex.Lock()
+				defer eventsMutex.Unlock()
+				events = append(events, event)
+			}))
+
+			err := CompressFlac(ctx, "/music/01 - First.flac", 1, 2, 3)
+
+			var toolError *ToolError
+			if test.exitCode != 0 && !errors.As(err, &toolError) {
+				t.Errorf("expected a ToolError, got %v", err)
+			} else if test.exitCode == 0 && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			expectedCalls := []RecordedCommand{{Name: "flac", Args: []string{"-8f", "/music/01 - First.flac"}}}
+			if !reflect.DeepEqual(fakeCommandRunner.GetCalls(), expectedCalls) {
+				t.Errorf("got calls %v, expected %v", fakeCommandRunner.GetCalls(), expectedCalls)
+			}
+
+			expectedTrack := TrackJob{AlbumNumber: 1, DiscNumber: 2, TrackNumber: 3}
+			if len(events) != 2 {
+				t.Fatalf("expected 2 events, got %v", events)
+			}
+
+			startedEvent, isStarted := events[0].(StageStartedEvent)
+			if !isStarted || startedEvent.Stage != StageCompress || startedEvent.Track != expectedTrack {
+				t.Errorf("unexpected started event: %+v", events[0])
+			}
+
+			finishedEvent, isFinished := events[1].(StageFinishedEvent)
+			if !isFinished || finishedEvent.Stage != StageCompress || finishedEvent.Track != expectedTrack || (finishedEvent.Err != nil) != (test.exitCode != 0) {
+				t.Errorf("unexpected finished event: %+v", events[1])
+			}
+		})
+	}
+}
+
+func TestGetTagFlacArgs(t *testing.T) {
+	discConfig := newTestDiscConfig()
+	discConfig.VariantName = "Reissue"
+	discConfig.CatalogNumber = "SQEX-10001"
+
+	flacPath, err := GetFlacPathByTrackNumber("/music", 1, 1, 1, discConfig, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metaflacArgs, err := GetTagFlacArgs("/music", 1, 1, 1, "/music/cover.jpg", discConfig, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedMetaflacArgs := [][]string{
+		{"--remove-all-tags", flacPath},
+		{"--set-tag=ALBUM=Test Album", flacPath},
+		{"--set-tag=ALBUMARTIST=Test Artist", flacPath},
+		{"--set-tag=GENRE=Game", flacPath},
+		{"--set-tag=DATE=2014-03-26", flacPath},
+		{"--set-tag=TRACKNUMBER=1", flacPath},
+		{"--set-tag=DISCNUMBER=1", flacPath},
+		{"--set-tag=TOTALDISCS=1", flacPath},
+		{"--set-tag=TOTALTRACKS=3", flacPath},
+		{"--set-tag=TITLE=First", flacPath},
+		{"--set-tag=ARTIST=Composer A", flacPath},
+		{"--set-tag=ARTIST=Composer B", flacPath},
+		{"--set-tag=VERSION=Reissue", flacPath},
+		{"--set-tag=CATALOGNUMBER=SQEX-10001", flacPath},
+		{"--import-picture-from=/music/cover.jpg", flacPath},
+	}
+	if !reflect.DeepEqual(metaflacArgs, expectedMetaflacArgs) {
+		t.Errorf("got %q, expected %q", metaflacArgs, expectedMetaflacArgs)
+	}
+}
+
+func TestGetTagFlacArgsWithoutArtistsOrCover(t *testing.T) {
+	discConfig := newTestDiscConfig()
+
+	metaflacArgs, err := GetTagFlacArgs("/music", 1, 1, 2, "", discConfig, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Removing the old tags, then one invocation for each of the nine basic tags
+	if len(metaflacArgs) != 10 {
+		t.Errorf("got %d metaflac invocations, expected 10: %q", len(metaflacArgs), metaflacArgs)
+	}
+
+	_, err = GetTagFlacArgs("/music", 1, 1, 9, "", discConfig, false)
+	if err == nil {
+		t.Errorf("expected an error for a track that isn't in the config")
+	}
+}
@@ -20,13 +20,14 @@
 package libbdaudiodump
 
 import (
+	"context"
 	"crypto/sha1"
 	"encoding/csv"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"regexp"
 	"runtime"
 	"strconv"
@@ -153,8 +154,8 @@ func GetAlbumDiscTrack(albumNumber int, discNumber int, trackNumber int, discCon
 	return album, disc, track, nil
 }
 
-func GetDevicePathFromMakemkvconDiscId(makemkvconDiscId int) (string, error) {
-	makemkvconInfoLine, err := GetMakemkvconInfoForDiscId(makemkvconDiscId)
+func GetDevicePathFromMakemkvconDiscId(ctx context.Context, makemkvconDiscId int) (string, error) {
+	makemkvconInfoLine, err := GetMakemkvconInfoForDiscId(ctx, makemkvconDiscId)
 	if err != nil {
 		return "", err
 	}
@@ -172,22 +173,27 @@ func GetDevicePathFromMakemkvconDiscId(makemkvconDiscId int) (string, error) {
 	return csvFields[6], nil
 }
 
-func GetMakemkvconInfo() ([]string, error) {
-	makemkvconExecPath, err := exec.LookPath("makemkvcon")
+func GetMakemkvconInfo(ctx context.Context) ([]string, error) {
+	// This format of the command skips a lot of unnecessary disc activity, but does
+	// result in a non-zero exit code, so we'll ignore the exit status from it.
+	output, err := runTool(ctx, "makemkvcon", GetMakemkvconInfoArgs()...)
 	if err != nil {
-		return nil, err
+		var toolError *ToolError
+		if !errors.As(err, &toolError) || toolError.ExitCode < 0 {
+			return nil, err
+		}
 	}
 
-	// This format of the command skips a lot of unnecessary disc activity, but does
-	// result in a non-zero exit code, so we'll ignore the error from it.
-	output, _ := exec.Command(makemkvconExecPath, "-r", "info").CombinedOutput()
-
 	outputString := string(output)
 	return strings.Split(outputString, "\n"), nil
 }
 
-func GetMakemkvconInfoForDiscId(makemkvconDiscId int) (string, error) {
-	makemkvconInfoLines, err := GetMakemkvconInfo()
+func GetMakemkvconInfoArgs() []string {
+	return []string{"-r", "info"}
+}
+
+func GetMakemkvconInfoForDiscId(ctx context.Context, makemkvconDiscId int) (string, error) {
+	makemkvconInfoLines, err := GetMakemkvconInfo(ctx)
 	if err != nil {
 		return "", err
 	}
@@ -201,105 +207,102 @@ func GetMakemkvconInfoForDiscId(makemkvconDiscId int) (string, error) {
 	return "", errors.New("makemkvcon info not found for disc:" + strconv.Itoa(makemkvconDiscId))
 }
 
-func GetMountPointForDevicePath(devicePath string) (string, error) {
+func GetMountPointForDevicePath(ctx context.Context, devicePath string) (string, error) {
 	if devicePath == "" {
 		return "", errors.New("no device path specified.  check whether a disc is in the drive.")
 	}
 	switch runtime.GOOS {
 	case
 		"android",
+		"linux":
+		return GetMountPointFromProcMountinfo(devicePath)
+
+	case
 		"darwin",
 		"dragonfly",
 		"freebsd",
-		"linux",
 		"netbsd",
 		"openbsd":
-		mountExecPath, err := exec.LookPath("mount")
+		mountOutput, err := runTool(ctx, "mount")
 		if err != nil {
-			panic(err)
+			return "", err
 		}
 
-		mountOutput, err := exec.Command(mountExecPath).CombinedOutput()
-		if err != nil {
-			panic(err)
-		}
+		return GetMountPointFromMountOutput(string(mountOutput), devicePath, runtime.GOOS)
 
-		mountOutputLines := strings.Split(string(mountOutput), "\n")
+	default:
+	}
 
-		switch runtime.GOOS {
-		case
-			"darwin",
-			"dragonfly",
-			"freebsd",
-			"netbsd",
-			"openbsd":
-			fixedDevicePath := devicePath
-
-			if runtime.GOOS == "darwin" {
-				devicePathFixRegex := regexp.MustCompile(`/dev/rdisk`)
-				fixedDevicePath = devicePathFixRegex.ReplaceAllString(fixedDevicePath, `/dev/disk`)
-			}
+	return "", errors.New("mount point lookup unimplemented for platform: " + runtime.GOOS)
+}
 
-			for _, line := range mountOutputLines {
-				if strings.HasPrefix(line, fixedDevicePath) {
-					parsedLine, prefixFound := strings.CutPrefix(line, fixedDevicePath+" on ")
-					if !prefixFound {
-						return "", errors.New("unable to find mount point for device: " + devicePath)
-					}
+// GetMountPointFromMountOutput finds the mount point for a device in the output of mount,
+// which is formatted differently depending on the platform given in goos.
+func GetMountPointFromMountOutput(mountOutput string, devicePath string, goos string) (string, error) {
+	mountOutputLines := strings.Split(mountOutput, "\n")
 
-					regEx := regexp.MustCompile(`\s\(([a-z\-0-9=]+(,\s)?)*\)$`)
+	switch goos {
+	case
+		"darwin",
+		"dragonfly",
+		"freebsd",
+		"netbsd",
+		"openbsd":
+		fixedDevicePath := devicePath
 
-					parsedLine = regEx.ReplaceAllString(parsedLine, ``)
+		if goos == "darwin" {
+			devicePathFixRegex := regexp.MustCompile(`/dev/rdisk`)
+			fixedDevicePath = devicePathFixRegex.ReplaceAllString(fixedDevicePath, `/dev/disk`)
+		}
 
-					return parsedLine, nil
+		for _, line := range mountOutputLines {
+			if strings.HasPrefix(line, fixedDevicePath) {
+				parsedLine, prefixFound := strings.CutPrefix(line, fixedDevicePath+" on ")
+				if !prefixFound {
+					return "", errors.New("unable to find mount point for device: " + devicePath)
 				}
-			}
-			return "", errors.New("unable to find mount point for device: " + devicePath)
 
-		case
-			"android",
-			"linux":
-			for _, line := range mountOutputLines {
-				if strings.HasPrefix(line, devicePath) {
-					parsedLine, prefixFound := strings.CutPrefix(line, devicePath+" on ")
-					if !prefixFound {
-						return "", errors.New("unable to find mount point for device: " + devicePath)
-					}
+				regEx := regexp.MustCompile(`\s\(([a-z\-0-9=]+(,\s)?)*\)$`)
 
-					regEx := regexp.MustCompile(`\stype\s\w+\s\(([a-z\-0-9=]+,?)*\)$`)
+				parsedLine = regEx.ReplaceAllString(parsedLine, ``)
 
-					parsedLine = regEx.ReplaceAllString(parsedLine, ``)
+				return parsedLine, nil
+			}
+		}
+		return "", errors.New("unable to find mount point for device: " + devicePath)
 
-					return parsedLine, nil
+	case
+		"android",
+		"linux":
+		for _, line := range mountOutputLines {
+			if strings.HasPrefix(line, devicePath) {
+				parsedLine, prefixFound := strings.CutPrefix(line, devicePath+" on ")
+				if !prefixFound {
+					return "", errors.New("unable to find mount point for device: " + devicePath)
 				}
-			}
-			return "", errors.New("unable to find mount point for device: " + devicePath)
 
-		default:
+				regEx := regexp.MustCompile(`\stype\s\w+\s\(([a-z\-0-9=]+,?)*\)$`)
+
+				parsedLine = regEx.ReplaceAllString(parsedLine, ``)
+
+				return parsedLine, nil
+			}
 		}
+		return "", errors.New("unable to find mount point for device: " + devicePath)
 
 	default:
 	}
 
-	return "", errors.New("mount point lookup unimplemented for platform: " + runtime.GOOS)
+	return "", errors.New("mount point lookup unimplemented for platform: " + goos)
 }
 
-func GetMountPointForMakemkvconDiscId(makemkvconDiscId int) (string, error) {
-	devicePath, err := GetDevicePathFromMakemkvconDiscId(makemkvconDiscId)
+func GetMountPointForMakemkvconDiscId(ctx context.Context, makemkvconDiscId int) (string, error) {
+	devicePath, err := GetDevicePathFromMakemkvconDiscId(ctx, makemkvconDiscId)
 	if err != nil {
 		return "", err
 	}
 
-	if runtime.GOOS != "windows" {
-		mountPoint, err := GetMountPointForDevicePath(devicePath)
-		if err != nil {
-			return "", err
-		}
-
-		return mountPoint, nil
-	} else { // The Windows version just returns the drive letter (e.g., "D:")
-		return devicePath + string(os.PathSeparator), nil
-	}
+	return GetMountPointForDevice(ctx, devicePath)
 }
 
 func GetDiscVolumeKeySha1Hash(basePath string) (string, error) {
@@ -326,38 +329,54 @@ func GetFileSha1Hash(filePath string) (string, error) {
 	return hex.EncodeToString(sha1HashBytes), nil
 }
 
-func GetDiscConfigByVolumeKeySha1Hash(discVolumeKeySha1Hash string, discConfigs *[]BluRayDiscConfig) (*BluRayDiscConfig, error) {
-	for _, discConfig := range *discConfigs {
-		if discConfig.DiscVolumeKeySha1 == discVolumeKeySha1Hash {
-			return &discConfig, nil
-		}
+// GetDiscConfigByVolumeKeySha1Hash finds the disc config with the given hash, whatever identifier
+// type it's for.  If the hash belongs to one of its variants, the config is returned as that
+// variant.
+func GetDiscConfigByVolumeKeySha1Hash(ctx context.Context, discVolumeKeySha1Hash string, discConfigs *[]BluRayDiscConfig) (*BluRayDiscConfig, error) {
+	discConfig := getDiscConfigByIdentifier(ctx, DiscIdentifier{Value: discVolumeKeySha1Hash}, discConfigs)
+	if discConfig == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDiscHash, discVolumeKeySha1Hash)
 	}
 
-	return nil, errors.New("unknown disc key hash: " + discVolumeKeySha1Hash)
+	return discConfig, nil
 }
 
-func GetDiscConfigByVolumeKeySha1HashFromKeyFile(basePath string, discConfigs *[]BluRayDiscConfig) (*BluRayDiscConfig, error) {
+func GetDiscConfigByVolumeKeySha1HashFromKeyFile(ctx context.Context, basePath string, discConfigs *[]BluRayDiscConfig) (*BluRayDiscConfig, error) {
 	discVolumeKeySha1Hash, err := GetDiscVolumeKeySha1Hash(basePath)
 	if err != nil {
 		return nil, err
 	}
 
-	return GetDiscConfigByVolumeKeySha1Hash(discVolumeKeySha1Hash, discConfigs)
+	return GetDiscConfigByVolumeKeySha1Hash(ctx, discVolumeKeySha1Hash, discConfigs)
 }
 
-func GetFfprobeDataFromAllMkvs(basePath string, discConfig BluRayDiscConfig) (map[string][]*FfprobeChapterInfo, error) {
-	allMkvProbeData := make(map[string][]*FfprobeChapterInfo)
+func GetFfprobeDataFromAllMkvs(ctx context.Context, basePath string, discConfig BluRayDiscConfig) (map[string][]*FfprobeChapterInfo, error) {
+	return GetFfprobeDataFromSelectedMkvs(ctx, basePath, discConfig, TrackSelection{})
+}
+
+// GetFfprobeDataFromSelectedMkvs only probes the titles that selected tracks are extracted from.
+func GetFfprobeDataFromSelectedMkvs(ctx context.Context, basePath string, discConfig BluRayDiscConfig, trackSelection TrackSelection) (allMkvProbeData map[string][]*FfprobeChapterInfo, err error) {
+	ctx = WithLogAttrs(ctx, LogKeyStage, StageProbe)
+
+	finishStage := observeStage(ctx, StageProbe, TrackJob{})
+	defer func() { finishStage(err) }()
+
+	allMkvProbeData = make(map[string][]*FfprobeChapterInfo)
 
 	for _, album := range discConfig.Albums {
 		for _, disc := range album.Discs {
 			for _, track := range disc.Tracks {
+				if !trackSelection.Includes(album.AlbumNumber, disc.DiscNumber, track.TrackNumber) {
+					continue
+				}
+
 				_, ok := allMkvProbeData[track.TitleNumber]
 				if !ok {
 					mkvPath, err := GetMkvPathByTrackNumber(basePath, album.AlbumNumber, disc.DiscNumber, track.TrackNumber, discConfig)
 					if err != nil {
 						return nil, err
 					}
-					mkvProbeData, err := GetFfprobeDataFromMkv(mkvPath)
+					mkvProbeData, err := GetFfprobeDataFromMkv(ctx, mkvPath)
 					if err != nil {
 						return nil, err
 					}
@@ -370,64 +389,97 @@ func GetFfprobeDataFromAllMkvs(basePath string, discConfig BluRayDiscConfig) (ma
 	return allMkvProbeData, nil
 }
 
-func GetFfprobeDataFromMkv(mkvPath string) ([]*FfprobeChapterInfo, error) {
+func GetFfprobeDataFromMkv(ctx context.Context, mkvPath string) ([]*FfprobeChapterInfo, error) {
 	if _, err := os.Stat(mkvPath); err != nil {
-		return nil, errors.New("Unable to open file: " + mkvPath)
+		return nil, fmt.Errorf("%w: unable to open file: %s", ErrMissingTitleMkv, mkvPath)
 	}
 
-	ffprobeExecPath, err := exec.LookPath("ffprobe")
-	if err != nil {
-		return nil, err
-	}
-	output, err := exec.Command(ffprobeExecPath, "-v", "quiet", "-print_format", "flat", "-show_chapters", mkvPath).CombinedOutput()
+	GetLogger(ctx).Debug("Probing MKV", "path", mkvPath)
+
+	output, err := runTool(ctx, "ffprobe", GetFfprobeChaptersArgs(mkvPath)...)
 	if err != nil {
 		return nil, err
 	}
 
-	outputString := string(output)
-	outputLines := strings.Split(outputString, "\n")
+	outputLines := strings.Split(string(output), "\n")
 
 	if len(outputLines) == 0 || outputLines[0] == "" {
-		output, err = exec.Command(ffprobeExecPath, "-v", "quiet", "-show_entries", "format=duration", mkvPath).CombinedOutput()
+		output, err = runTool(ctx, "ffprobe", GetFfprobeDurationArgs(mkvPath)...)
 		if err != nil {
 			return nil, err
 		}
-		chapterInfos := make([]*FfprobeChapterInfo, 1)
-		currentChapter := &FfprobeChapterInfo{}
-		currentChapter.ChapterStartTime = 0
-		currentChapter.IsChapter = false
-		outputString = string(output)
-
-		outputLines = strings.Split(outputString, "\n")
-		if len(outputLines) == 0 || outputLines[0] == "" {
-			return nil, errors.New("error analyzing MKV file for duration: " + mkvPath)
+
+		chapterInfos, err := ParseFfprobeDurationOutput(string(output))
+		if err != nil {
+			return nil, errors.New("error analyzing MKV file for duration: " + mkvPath + ": " + err.Error())
 		}
-		for _, line := range outputLines {
-			if line != "" {
-				splitLine := strings.Split(line, "=")
-				if splitLine[0] == "duration" {
-					duration, err := strconv.ParseFloat(splitLine[1], 64)
-					if err != nil {
-						return nil, err
-					}
-					currentChapter.ChapterDuration = duration
-					currentChapter.ChapterEndTime = duration
+
+		return chapterInfos, nil
+	}
+
+	return ParseFfprobeChaptersOutput(string(output))
+}
+
+func GetFfprobeChaptersArgs(mkvPath string) []string {
+	return []string{"-v", "quiet", "-print_format", "flat", "-show_chapters", mkvPath}
+}
+
+func GetFfprobeDurationArgs(mkvPath string) []string {
+	return []string{"-v", "quiet", "-show_entries", "format=duration", mkvPath}
+}
+
+// ParseFfprobeDurationOutput turns the format duration of a title without chapters into a
+// single pseudo-chapter covering the whole title.
+func ParseFfprobeDurationOutput(output string) ([]*FfprobeChapterInfo, error) {
+	chapterInfos := make([]*FfprobeChapterInfo, 1)
+	currentChapter := &FfprobeChapterInfo{}
+	currentChapter.ChapterStartTime = 0
+	currentChapter.IsChapter = false
+
+	outputLines := strings.Split(output, "\n")
+	if len(outputLines) == 0 || outputLines[0] == "" {
+		return nil, errors.New("no duration found in ffprobe output")
+	}
+	durationFound := false
+	for _, line := range outputLines {
+		if line != "" {
+			splitLine := strings.SplitN(line, "=", 2)
+			if splitLine[0] == "duration" && len(splitLine) == 2 {
+				duration, err := strconv.ParseFloat(strings.TrimSpace(splitLine[1]), 64)
+				if err != nil {
+					return nil, errors.New("invalid duration in ffprobe output: " + line)
 				}
+				currentChapter.ChapterDuration = duration
+				currentChapter.ChapterEndTime = duration
+				durationFound = true
 			}
 		}
+	}
 
-		chapterInfos[0] = currentChapter
-		return chapterInfos, nil
+	if !durationFound {
+		return nil, errors.New("no duration found in ffprobe output")
 	}
 
+	chapterInfos[0] = currentChapter
+	return chapterInfos, nil
+}
+
+func ParseFfprobeChaptersOutput(output string) ([]*FfprobeChapterInfo, error) {
+	var err error
+
+	outputLines := strings.Split(output, "\n")
+
 	chapterInfos := make([]*FfprobeChapterInfo, 0)
 	currentChapter := &FfprobeChapterInfo{}
 	currentChapter.IsChapter = true
 
 	for _, line := range outputLines {
 		if line != "" {
-			splitLine := strings.Split(line, "=")
+			splitLine := strings.SplitN(line, "=", 2)
 			dataTypes := strings.Split(splitLine[0], ".")
+			if len(splitLine) != 2 || len(dataTypes) < 4 || dataTypes[0] != "chapters" || dataTypes[1] != "chapter" {
+				return nil, errors.New("unexpected line in ffprobe output: " + line)
+			}
 
 			if dataTypes[2] != strconv.Itoa(currentChapter.ChapterIndex) {
 				currentChapter.ChapterDuration = currentChapter.ChapterEndTime - currentChapter.ChapterStartTime
@@ -489,41 +541,40 @@ func GetFlacPathByTrackNumber(basePath string, albumNumber int, discNumber int,
 }
 
 func GetAudioStreamNumberFromStringForTrack(track BluRayDiscConfigAlbumDiscTrack, audioStreamType string) int {
+	audioStreamNumber, _ := GetAudioStreamSelectionForTrack(track, audioStreamType)
+	return audioStreamNumber
+}
+
+// GetAudioStreamSelectionForTrack returns the audio stream number to extract for a track, along with
+// a short description of why it was chosen.
+func GetAudioStreamSelectionForTrack(track BluRayDiscConfigAlbumDiscTrack, audioStreamType string) (int, string) {
 	if audioStreamType == "" {
-		return 0
+		return 0, "no audio stream type requested, using default stream"
 	}
 
-	if track.AudioStreams != nil && len(track.AudioStreams) > 0 {
-		if audioStreamType == "best" {
-			for _, audioStream := range track.AudioStreams {
-				if audioStream.ChannelType == "surround71" {
-					return audioStream.ChannelNumber
-				}
-			}
-			for _, audioStream := range track.AudioStreams {
-				if audioStream.ChannelType == "surround51" {
-					return audioStream.ChannelNumber
-				}
-			}
-			for _, audioStream := range track.AudioStreams {
-				if audioStream.ChannelType == "stereo21" {
-					return audioStream.ChannelNumber
-				}
-			}
-			for _, audioStream := range track.AudioStreams {
-				if audioStream.ChannelType == "stereo20" {
-					return audioStream.ChannelNumber
-				}
-			}
-		} else {
+	if track.AudioStreams == nil || len(track.AudioStreams) == 0 {
+		return 0, "no audio streams configured for track, using default stream"
+	}
+
+	if audioStreamType == "best" {
+		for _, channelType := range []string{"surround71", "surround51", "stereo21", "stereo20"} {
 			for _, audioStream := range track.AudioStreams {
-				if audioStream.ChannelType == audioStreamType {
-					return audioStream.ChannelNumber
+				if audioStream.ChannelType == channelType {
+					return audioStream.ChannelNumber, "best available stream type is " + channelType
 				}
 			}
 		}
+
+		return 0, "no known stream types configured for track, using default stream"
+	}
+
+	for _, audioStream := range track.AudioStreams {
+		if audioStream.ChannelType == audioStreamType {
+			return audioStream.ChannelNumber, "matched requested stream type " + audioStreamType
+		}
 	}
-	return 0
+
+	return 0, "no " + audioStreamType + " stream configured for track, using default stream"
 }
 
 func GetCoverArtDestinationPath(basePath string, discConfig BluRayDiscConfig, album BluRayDiscConfigAlbum, replaceSpaceWithUnderscore bool) string {
@@ -539,14 +590,16 @@ func GetExpandedCoverArtSourcePath(basePath string, album BluRayDiscConfigAlbum)
 }
 
 func GetMkvPathByTrackNumber(basePath string, albumNumber int, discNumber int, trackNumber int, discConfig BluRayDiscConfig) (string, error) {
-	mkvPath := strings.TrimRight(basePath, string(os.PathSeparator)) + string(os.PathSeparator) + discConfig.MakemkvPrefix + "_t"
-
 	track, err := GetTrack(albumNumber, discNumber, trackNumber, discConfig)
 	if err != nil {
 		return "", err
 	}
 
-	return mkvPath + track.TitleNumber + ".mkv", nil
+	return GetMkvPathByTitleNumber(basePath, track.TitleNumber, discConfig), nil
+}
+
+func GetMkvPathByTitleNumber(basePath string, titleNumber string, discConfig BluRayDiscConfig) string {
+	return strings.TrimRight(basePath, string(os.PathSeparator)) + string(os.PathSeparator) + discConfig.MakemkvPrefix + "_t" + titleNumber + ".mkv"
 }
 
 func SanitizePathSegment(pathSegment string, replaceSpaceWithUnderscore bool) string {
@@ -581,3 +634,32 @@ func PathIsDirectory(fullPath string) (bool, error) {
 
 	return fileInfo.IsDir(), nil
 }
+
+// GetMkvPathsInDirectory returns the MKV files in a directory, sorted by name.
+func GetMkvPathsInDirectory(directory string) ([]string, error) {
+	dirEntries, err := os.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	mkvPaths := make([]string, 0)
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() && strings.HasSuffix(strings.ToLower(dirEntry.Name()), ".mkv") {
+			mkvPaths = append(mkvPaths, strings.TrimRight(directory, string(os.PathSeparator))+string(os.PathSeparator)+dirEntry.Name())
+		}
+	}
+
+	return mkvPaths, nil
+}
+
+// GetTitleNumberFromMkvPath returns the ## from a file named the way makemkvcon names titles
+// (<prefix>_t##.mkv), or an empty string if the name doesn't match.
+func GetTitleNumberFromMkvPath(mkvPath string) string {
+	regEx := regexp.MustCompile(`_t(\d+)\.mkv$`)
+	matches := regEx.FindStringSubmatch(mkvPath)
+	if matches == nil {
+		return ""
+	}
+
+	return matches[1]
+}
@@ -0,0 +1,283 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testFfprobeChaptersOutput = `chapters.chapter.0.id=0
+chapters.chapter.0.time_base="1/1000000000"
+chapters.chapter.0.start=0
+chapters.chapter.0.start_time="0.000000"
+chapters.chapter.0.end=95500000000
+chapters.chapter.0.end_time="95.500000"
+chapters.chapter.0.tags.title="Chapter 01"
+chapters.chapter.1.id=1
+chapters.chapter.1.time_base="1/1000000000"
+chapters.chapter.1.start=95500000000
+chapters.chapter.1.start_time="95.500000"
+chapters.chapter.1.end=250250000000
+chapters.chapter.1.end_time="250.250000"
+chapters.chapter.1.tags.title="Chapter 02"
+`
+
+func TestParseFfprobeChaptersOutput(t *testing.T) {
+	chapterInfos, err := ParseFfprobeChaptersOutput(testFfprobeChaptersOutput)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedChapterInfos := []FfprobeChapterInfo{
+		{IsChapter: true, ChapterIndex: 0, ChapterStartTime: 0, ChapterEndTime: 95.5, ChapterDuration: 95.5},
+		{IsChapter: true, ChapterIndex: 1, ChapterStartTime: 95.5, ChapterEndTime: 250.25, ChapterDuration: 154.75},
+	}
+
+	if len(chapterInfos) != len(expectedChapterInfos) {
+		t.Fatalf("got %d chapters, expected %d", len(chapterInfos), len(expectedChapterInfos))
+	}
+
+	for i, expectedChapterInfo := range expectedChapterInfos {
+		if *chapterInfos[i] != expectedChapterInfo {
+			t.Errorf("chapter %d: got %+v, expected %+v", i, *chapterInfos[i], expectedChapterInfo)
+		}
+	}
+}
+
+func TestParseFfprobeChaptersOutputMalformed(t *testing.T) {
+	malformedOutputs := map[string]string{
+		"not flat output":    "[CHAPTER]\nid=0\n[/CHAPTER]\n",
+		"missing value":      "chapters.chapter.0.start_time\n",
+		"invalid start time": "chapters.chapter.0.start_time=\"soon\"\n",
+		"invalid end time":   "chapters.chapter.0.end_time=\"later\"\n",
+		"invalid index":      "chapters.chapter.0.id=0\nchapters.chapter.x.id=1\n",
+	}
+
+	for name, output := range malformedOutputs {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseFfprobeChaptersOutput(output)
+			if err == nil {
+				t.Errorf("expected an error for output %q", output)
+			}
+		})
+	}
+}
+
+func TestParseFfprobeDurationOutput(t *testing.T) {
+	chapterInfos, err := ParseFfprobeDurationOutput("[FORMAT]\nduration=321.250000\n[/FORMAT]\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedChapterInfo := FfprobeChapterInfo{IsChapter: false, ChapterIndex: 0, ChapterStartTime: 0, ChapterEndTime: 321.25, ChapterDuration: 321.25}
+	if len(chapterInfos) != 1 || *chapterInfos[0] != expectedChapterInfo {
+		t.Errorf("got %+v, expected a single %+v", chapterInfos, expectedChapterInfo)
+	}
+}
+
+func TestParseFfprobeDurationOutputMalformed(t *testing.T) {
+	malformedOutputs := map[string]string{
+		"empty":            "",
+		"no duration":      "[FORMAT]\n[/FORMAT]\n",
+		"invalid duration": "[FORMAT]\nduration=N/A\n[/FORMAT]\n",
+	}
+
+	for name, output := range malformedOutputs {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseFfprobeDurationOutput(output)
+			if err == nil {
+				t.Errorf("expected an error for output %q", output)
+			}
+		})
+	}
+}
+
+func TestGetMountPointFromMountOutput(t *testing.T) {
+	testCases := []struct {
+		name               string
+		mountOutput        string
+		devicePath         string
+		goos               string
+		expectedMountPoint string
+		expectError        bool
+	}{
+		{
+			name:               "linux",
+			mountOutput:        "/dev/sda1 on / type ext4 (rw,relatime)\n/dev/sr0 on /media/user/MY DISC type udf (ro,nosuid,nodev,relatime,uid=1000)\n",
+			devicePath:         "/dev/sr0",
+			goos:               "linux",
+			expectedMountPoint: "/media/user/MY DISC",
+		},
+		{
+			name:               "darwin raw disk",
+			mountOutput:        "/dev/disk1s1 on / (apfs, local, journaled)\n/dev/disk4 on /Volumes/MY_DISC (udf, local, nodev, nosuid, read-only, noowners)\n",
+			devicePath:         "/dev/rdisk4",
+			goos:               "darwin",
+			expectedMountPoint: "/Volumes/MY_DISC",
+		},
+		{
+			name:               "freebsd",
+			mountOutput:        "/dev/ada0p2 on / (ufs, local, soft-updates)\n/dev/cd0 on /mnt/cdrom (udf, local, read-only)\n",
+			devicePath:         "/dev/cd0",
+			goos:               "freebsd",
+			expectedMountPoint: "/mnt/cdrom",
+		},
+		{
+			name:        "not mounted",
+			mountOutput: "/dev/sda1 on / type ext4 (rw,relatime)\n",
+			devicePath:  "/dev/sr0",
+			goos:        "linux",
+			expectError: true,
+		},
+		{
+			name:        "unsupported platform",
+			mountOutput: "/dev/sr0 on /mnt/cdrom type udf (ro)\n",
+			devicePath:  "/dev/sr0",
+			goos:        "plan9",
+			expectError: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			mountPoint, err := GetMountPointFromMountOutput(testCase.mountOutput, testCase.devicePath, testCase.goos)
+			if testCase.expectError {
+				if err == nil {
+					t.Errorf("expected an error, got mount point %q", mountPoint)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if mountPoint != testCase.expectedMountPoint {
+				t.Errorf("got mount point %q, expected %q", mountPoint, testCase.expectedMountPoint)
+			}
+		})
+	}
+}
+
+func createTestFile(t *testing.T, filePath string) {
+	t.Helper()
+
+	err := os.MkdirAll(filepath.Dir(filePath), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filePath, []byte{}, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetFfprobeDataFromMkvWithChapters(t *testing.T) {
+	mkvPath := filepath.Join(t.TempDir(), "MY_DISC_t00.mkv")
+	createTestFile(t, mkvPath)
+
+	commandRunner := &FakeCommandRunner{Commands: []FakeCommand{
+		{Name: "ffprobe", Args: GetFfprobeChaptersArgs(mkvPath), Output: testFfprobeChaptersOutput},
+	}}
+	ctx := WithCommandRunner(context.Background(), commandRunner)
+
+	chapterInfos, err := GetFfprobeDataFromMkv(ctx, mkvPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(chapterInfos) != 2 {
+		t.Errorf("got %d chapters, expected 2", len(chapterInfos))
+	}
+
+	expectedCalls := []RecordedCommand{{Name: "ffprobe", Args: GetFfprobeChaptersArgs(mkvPath)}}
+	if !reflect.DeepEqual(commandRunner.GetCalls(), expectedCalls) {
+		t.Errorf("got calls %+v, expected %+v", commandRunner.GetCalls(), expectedCalls)
+	}
+}
+
+func TestGetFfprobeDataFromMkvWithoutChapters(t *testing.T) {
+	mkvPath := filepath.Join(t.TempDir(), "MY_DISC_t01.mkv")
+	createTestFile(t, mkvPath)
+
+	commandRunner := &FakeCommandRunner{Commands: []FakeCommand{
+		{Name: "ffprobe", Args: GetFfprobeChaptersArgs(mkvPath), Output: ""},
+		{Name: "ffprobe", Args: GetFfprobeDurationArgs(mkvPath), Output: "[FORMAT]\nduration=60.000000\n[/FORMAT]\n"},
+	}}
+	ctx := WithCommandRunner(context.Background(), commandRunner)
+
+	chapterInfos, err := GetFfprobeDataFromMkv(ctx, mkvPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(chapterInfos) != 1 || chapterInfos[0].IsChapter || chapterInfos[0].ChapterDuration != 60 {
+		t.Errorf("expected a single 60 second pseudo-chapter, got %+v", chapterInfos)
+	}
+
+	expectedCalls := []RecordedCommand{
+		{Name: "ffprobe", Args: GetFfprobeChaptersArgs(mkvPath)},
+		{Name: "ffprobe", Args: GetFfprobeDurationArgs(mkvPath)},
+	}
+	if !reflect.DeepEqual(commandRunner.GetCalls(), expectedCalls) {
+		t.Errorf("got calls %+v, expected %+v", commandRunner.GetCalls(), expectedCalls)
+	}
+}
+
+func TestGetFfprobeDataFromMkvToolError(t *testing.T) {
+	mkvPath := filepath.Join(t.TempDir(), "MY_DISC_t00.mkv")
+	createTestFile(t, mkvPath)
+
+	commandRunner := &FakeCommandRunner{Commands: []FakeCommand{
+		{Name: "ffprobe", Output: "Invalid data found when processing input\n", ExitCode: 1},
+	}}
+	ctx := WithCommandRunner(context.Background(), commandRunner)
+
+	_, err := GetFfprobeDataFromMkv(ctx, mkvPath)
+
+	var toolError *ToolError
+	if !errors.As(err, &toolError) {
+		t.Fatalf("expected a *ToolError, got %v", err)
+	}
+
+	if toolError.Tool != "ffprobe" || toolError.ExitCode != 1 || toolError.LastOutputLine() != "Invalid data found when processing input" {
+		t.Errorf("unexpected tool error: %+v", toolError)
+	}
+}
+
+func TestGetFfprobeDataFromMkvMissingFile(t *testing.T) {
+	commandRunner := &FakeCommandRunner{}
+	ctx := WithCommandRunner(context.Background(), commandRunner)
+
+	_, err := GetFfprobeDataFromMkv(ctx, filepath.Join(t.TempDir(), "missing_t00.mkv"))
+	if !errors.Is(err, ErrMissingTitleMkv) {
+		t.Errorf("expected ErrMissingTitleMkv, got %v", err)
+	}
+
+	if len(commandRunner.GetCalls()) != 0 {
+		t.Errorf("expected no commands to be run, got %+v", commandRunner.GetCalls())
+	}
+}
@@ -0,0 +1,170 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnknownDiscHash = errors.New("unknown disc key hash")
+	ErrMissingTitleMkv = errors.New("missing title MKV")
+	ErrMissingChapter  = errors.New("missing chapter")
+	ErrInvalidConfig   = errors.New("invalid config")
+)
+
+// How much of the end of a failed tool's output is kept in a ToolError
+const toolErrorOutputLimit = 4096
+
+// ToolError is returned when an external tool can't be found, fails to start, or exits
+// with a non-zero status.  ExitCode is -1 if the tool never exited on its own.
+type ToolError struct {
+	Tool     string
+	Args     []string
+	ExitCode int
+	Output   string
+	Err      error
+}
+
+func (toolError *ToolError) Error() string {
+	errorString := toolError.Tool
+	if toolError.ExitCode >= 0 {
+		errorString = errorString + " exited with status " + strconv.Itoa(toolError.ExitCode)
+	} else {
+		errorString = errorString + ": " + toolError.Err.Error()
+	}
+
+	lastLine := toolError.LastOutputLine()
+	if lastLine != "" {
+		errorString = errorString + ": " + lastLine
+	}
+
+	return errorString
+}
+
+func (toolError *ToolError) Unwrap() error {
+	return toolError.Err
+}
+
+func (toolError *ToolError) CommandLine() string {
+	return FormatCommandLine(toolError.Tool, toolError.Args)
+}
+
+func (toolError *ToolError) LastOutputLine() string {
+	outputLines := strings.Split(strings.TrimSpace(toolError.Output), "\n")
+	return strings.TrimSpace(outputLines[len(outputLines)-1])
+}
+
+func newToolError(tool string, args []string, output []byte, err error) *ToolError {
+	toolError := &ToolError{
+		Tool:     tool,
+		Args:     args,
+		ExitCode: -1,
+		Output:   getTrailingOutput(output),
+		Err:      err,
+	}
+
+	var exitCoder interface{ ExitCode() int }
+	if errors.As(err, &exitCoder) && exitCoder.ExitCode() >= 0 {
+		toolError.ExitCode = exitCoder.ExitCode()
+	}
+
+	return toolError
+}
+
+func getTrailingOutput(output []byte) string {
+	if len(output) <= toolErrorOutputLimit {
+		return string(output)
+	}
+
+	trailingOutput := string(output[len(output)-toolErrorOutputLimit:])
+
+	// Don't start partway through a line
+	newlineIndex := strings.Index(trailingOutput, "\n")
+	if newlineIndex >= 0 {
+		trailingOutput = trailingOutput[newlineIndex+1:]
+	}
+
+	return trailingOutput
+}
+
+// runTool finds a tool with the context's CommandRunner and runs it, returning its combined
+// output.  Any failure is returned as a *ToolError.
+func runTool(ctx context.Context, tool string, args ...string) ([]byte, error) {
+	commandRunner := GetCommandRunner(ctx)
+	logger := GetLogger(ctx).With(LogKeyTool, tool)
+
+	toolExecPath, err := commandRunner.LookPath(tool)
+	if err != nil {
+		return nil, newToolError(tool, args, nil, err)
+	}
+
+	logger.Debug("Running command", LogKeyCommand, FormatCommandLine(tool, args))
+	startTime := time.Now()
+
+	output, err := commandRunner.CombinedOutput(ctx, toolExecPath, args...)
+	if err != nil {
+		toolError := newToolError(tool, args, output, err)
+		logger.Debug("Command failed", LogKeyExitStatus, toolError.ExitCode, LogKeyDuration, time.Since(startTime).Seconds())
+		return output, toolError
+	}
+
+	logger.Debug("Command finished", LogKeyDuration, time.Since(startTime).Seconds())
+
+	return output, nil
+}
+
+// runToolWithOutputLines works like runTool, but passes each line of output to onLine while the
+// tool is running.  Only the end of the output is kept for a *ToolError.
+func runToolWithOutputLines(ctx context.Context, tool string, onLine func(line string), args ...string) error {
+	commandRunner := GetCommandRunner(ctx)
+	logger := GetLogger(ctx).With(LogKeyTool, tool)
+
+	toolExecPath, err := commandRunner.LookPath(tool)
+	if err != nil {
+		return newToolError(tool, args, nil, err)
+	}
+
+	logger.Debug("Running command", LogKeyCommand, FormatCommandLine(tool, args))
+	startTime := time.Now()
+
+	trailingOutput := make([]byte, 0)
+	err = commandRunner.StreamOutputLines(ctx, toolExecPath, func(line string) {
+		trailingOutput = append(trailingOutput, line+"\n"...)
+		if len(trailingOutput) > 2*toolErrorOutputLimit {
+			trailingOutput = append(make([]byte, 0), getTrailingOutput(trailingOutput)...)
+		}
+
+		onLine(line)
+	}, args...)
+	if err != nil {
+		toolError := newToolError(tool, args, trailingOutput, err)
+		logger.Debug("Command failed", LogKeyExitStatus, toolError.ExitCode, LogKeyDuration, time.Since(startTime).Seconds())
+		return toolError
+	}
+
+	logger.Debug("Command finished", LogKeyDuration, time.Since(startTime).Seconds())
+
+	return nil
+}
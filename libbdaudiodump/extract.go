@@ -23,33 +23,54 @@ import (
 	"archive/zip"
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/dhowden/tag"
 	"io"
 	"net/http"
 	"os"
-	"os/exec"
 	"path"
 	"strconv"
 	"strings"
 )
 
-func ExtractDiscToMkv(makemkvconDiscId int, destinationDir string) error {
-	_, err := os.ReadDir(destinationDir)
-	if err != nil {
-		err := os.MkdirAll(destinationDir, 0755)
+// ExtractDiscToMkv remuxes the titles the selected tracks come from into MKV files named the way
+// GetMkvPathByTrackNumber expects.  makemkvconSource is a disc: or dev: source, from
+// GetMakemkvconDiscSource or GetMakemkvconDeviceSource.
+func ExtractDiscToMkv(ctx context.Context, makemkvconSource string, discConfig BluRayDiscConfig, trackSelection TrackSelection, destinationDir string) (err error) {
+	ctx = WithLogAttrs(ctx, LogKeyStage, StageMkv)
+
+	finishStage := observeStage(ctx, StageMkv, TrackJob{})
+	defer func() { finishStage(err) }()
+
+	for _, titleNumber := range GetSelectedTitleNumbers(discConfig, trackSelection) {
+		err := extractMkvTitle(ctx, titleNumber, discConfig, destinationDir, func(makemkvconTitleId string, titleDir string) []string {
+			return GetExtractDiscToMkvArgs(makemkvconSource, makemkvconTitleId, titleDir)
+		})
 		if err != nil {
 			return err
 		}
 	}
 
-	makemkvconExecPath, err := exec.LookPath("makemkvcon")
+	return nil
+}
+
+func BackupDisc(ctx context.Context, makemkvconSource string, destinationDir string) (err error) {
+	ctx = WithLogAttrs(ctx, LogKeyStage, StageBackup)
+
+	finishStage := observeStage(ctx, StageBackup, TrackJob{})
+	defer func() { finishStage(err) }()
+
+	_, err = os.ReadDir(destinationDir)
 	if err != nil {
-		return err
+		err := os.MkdirAll(destinationDir, 0755)
+		if err != nil {
+			return err
+		}
 	}
 
-	_, err = exec.Command(makemkvconExecPath, "mkv", "--minlength=0", "disc:"+strconv.Itoa(makemkvconDiscId), "all", destinationDir).CombinedOutput()
+	_, err = runMakemkvcon(ctx, StageBackup, GetBackupDiscArgs(makemkvconSource, destinationDir)...)
 	if err != nil {
 		return err
 	}
@@ -57,51 +78,79 @@ func ExtractDiscToMkv(makemkvconDiscId int, destinationDir string) error {
 	return nil
 }
 
-func BackupDisc(makemkvconDiscId int, destinationDir string) error {
-	_, err := os.ReadDir(destinationDir)
-	if err != nil {
-		err := os.MkdirAll(destinationDir, 0755)
+// ExtractMkvFromBackup remuxes the titles the selected tracks come from out of a disc backup into
+// MKV files named the way GetMkvPathByTrackNumber expects.
+func ExtractMkvFromBackup(ctx context.Context, basePath string, discConfig BluRayDiscConfig, trackSelection TrackSelection, destinationDir string) (err error) {
+	ctx = WithLogAttrs(ctx, LogKeyStage, StageMkv)
+
+	finishStage := observeStage(ctx, StageMkv, TrackJob{})
+	defer func() { finishStage(err) }()
+
+	for _, titleNumber := range GetSelectedTitleNumbers(discConfig, trackSelection) {
+		err := extractMkvTitle(ctx, titleNumber, discConfig, destinationDir, func(makemkvconTitleId string, titleDir string) []string {
+			return GetExtractMkvFromBackupArgs(basePath, makemkvconTitleId, titleDir)
+		})
 		if err != nil {
 			return err
 		}
 	}
 
-	makemkvconExecPath, err := exec.LookPath("makemkvcon")
+	return nil
+}
+
+// extractMkvTitle has makemkvcon rip one title into its own directory, then moves the result to
+// the config's MakeMKV prefix naming.  makemkvcon names files after the disc, which doesn't
+// always match the prefix in the config.
+func extractMkvTitle(ctx context.Context, titleNumber string, discConfig BluRayDiscConfig, destinationDir string, getMakemkvconArgs func(makemkvconTitleId string, titleDir string) []string) error {
+	makemkvconTitleId, err := GetMakemkvconTitleId(titleNumber)
 	if err != nil {
 		return err
 	}
 
-	_, err = exec.Command(makemkvconExecPath, "backup", "disc:"+strconv.Itoa(makemkvconDiscId), destinationDir).CombinedOutput()
+	err = os.MkdirAll(destinationDir, 0755)
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
-
-func ExtractMkvFromBackup(basePath string, destinationDir string) error {
-	_, err := os.ReadDir(destinationDir)
+	titleDir, err := os.MkdirTemp(destinationDir, GetMkvTitleDirPattern(titleNumber))
 	if err != nil {
-		err := os.MkdirAll(destinationDir, 0755)
-		if err != nil {
-			return err
-		}
+		return err
 	}
+	defer os.RemoveAll(titleDir)
 
-	makemkvconExecPath, err := exec.LookPath("makemkvcon")
+	GetLogger(ctx).Info("Ripping title", "title_number", titleNumber)
+
+	reportedMessageError, err := runMakemkvcon(ctx, StageMkv, getMakemkvconArgs(makemkvconTitleId, titleDir)...)
 	if err != nil {
 		return err
 	}
 
-	_, err = exec.Command(makemkvconExecPath, "mkv", "--minlength=0", "file:"+strings.TrimRight(basePath, "/")+"/BDMV/index.bdmv", "all", destinationDir).CombinedOutput()
+	mkvPaths, err := GetMkvPathsInDirectory(titleDir)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	if len(mkvPaths) == 0 && reportedMessageError != nil {
+		return fmt.Errorf("%w for title %s: %w", ErrMissingTitleMkv, titleNumber, reportedMessageError)
+	}
+
+	if len(mkvPaths) == 0 {
+		return fmt.Errorf("%w: makemkvcon didn't create an MKV file for title %s", ErrMissingTitleMkv, titleNumber)
+	}
+
+	if len(mkvPaths) > 1 {
+		return errors.New("makemkvcon created " + strconv.Itoa(len(mkvPaths)) + " MKV files for title " + titleNumber)
+	}
+
+	return os.Rename(mkvPaths[0], GetMkvPathByTitleNumber(destinationDir, titleNumber, discConfig))
 }
 
-func ExtractFlacFromMkv(mkvBasePath string, flacBasePath string, albumNumber int, discNumber int, trackNumber int, ffProbeData map[string][]*FfprobeChapterInfo, discConfig BluRayDiscConfig, audioStreamType string, replaceSpaceWithUnderscore bool) error {
+func ExtractFlacFromMkv(ctx context.Context, mkvBasePath string, flacBasePath string, albumNumber int, discNumber int, trackNumber int, ffProbeData map[string][]*FfprobeChapterInfo, discConfig BluRayDiscConfig, audioStreamType string, replaceSpaceWithUnderscore bool) (err error) {
+	ctx = WithLogAttrs(ctx, LogKeyStage, StageExtract)
+
+	finishStage := observeStage(ctx, StageExtract, TrackJob{AlbumNumber: albumNumber, DiscNumber: discNumber, TrackNumber: trackNumber})
+	defer func() { finishStage(err) }()
+
 	track, err := GetTrack(albumNumber, discNumber, trackNumber, discConfig)
 	if err != nil {
 		return err
@@ -125,65 +174,48 @@ func ExtractFlacFromMkv(mkvBasePath string, flacBasePath string, albumNumber int
 		return err
 	}
 
-	ffmpegExecPath, err := exec.LookPath("ffmpeg")
-	if err != nil {
-		return err
+	if _, err := os.Stat(mkvPath); err != nil {
+		return fmt.Errorf("%w: unable to open file: %s", ErrMissingTitleMkv, mkvPath)
 	}
 
-	var trackDuration float64
-	trackDuration = 0
+	chapterInfos := GetChapterInfosForTrack(*track, ffProbeData)
+	if len(chapterInfos) != len(track.ChapterNumbers) {
+		return fmt.Errorf("%w: only %d of %d chapters were found in title %s for track %d", ErrMissingChapter, len(chapterInfos), len(track.ChapterNumbers), track.TitleNumber, trackNumber)
+	}
 
-	flacPieces := 0
-	ffmpegParametersForMkv := ffProbeData[track.TitleNumber]
+	// Don't leave a partial FLAC file behind if extraction fails or is cancelled partway through
+	extractionFinished := false
+	defer func() {
+		if !extractionFinished {
+			os.Remove(GetFlacConcatListPath(flacPath, trackNumber))
+			os.Remove(GetTrimmedFlacPath(flacPath))
+			os.Remove(flacPath)
+		}
+	}()
+
+	trackDuration := GetChapterInfosDuration(chapterInfos)
 	audioStreamNumber := GetAudioStreamNumberFromStringForTrack(*track, audioStreamType)
-	for _, chapterNumber := range track.ChapterNumbers {
-		for _, title := range ffmpegParametersForMkv {
-			if title.ChapterIndex == chapterNumber {
-				trackDuration = trackDuration + title.ChapterDuration
-				if len(track.ChapterNumbers) == 1 {
-					if title.IsChapter {
-						_, err := exec.Command(ffmpegExecPath, "-y", "-ss", fmt.Sprintf("%.6f", title.ChapterStartTime), "-t", fmt.Sprintf("%.6f", title.ChapterDuration), "-i", mkvPath, "-c:a", "flac", "-map", "0:a:"+strconv.Itoa(audioStreamNumber), flacPath).CombinedOutput()
-						if err != nil {
-							return err
-						}
-					} else {
-						_, err := exec.Command(ffmpegExecPath, "-y", "-i", mkvPath, "-c:a", "flac", "-map", "0:a:"+strconv.Itoa(audioStreamNumber), flacPath).CombinedOutput()
-						if err != nil {
-							return err
-						}
-					}
-				} else {
-					if title.IsChapter {
-						_, err := exec.Command(ffmpegExecPath, "-y", "-ss", fmt.Sprintf("%.6f", title.ChapterStartTime), "-t", fmt.Sprintf("%.6f", title.ChapterDuration), "-i", mkvPath, "-c:a", "flac", "-map", "0:a:"+strconv.Itoa(audioStreamNumber), strings.TrimRight(path.Dir(flacPath), string(os.PathSeparator))+string(os.PathSeparator)+strconv.Itoa(trackNumber)+"_piece_"+strconv.Itoa(flacPieces)+".flac").CombinedOutput()
-						if err != nil {
-							return err
-						}
-
-						defer os.Remove(strings.TrimRight(path.Dir(flacPath), string(os.PathSeparator)) + string(os.PathSeparator) + strconv.Itoa(trackNumber) + "_piece_" + strconv.Itoa(flacPieces) + ".flac")
-
-						flacPieces = flacPieces + 1
-					} else {
-						_, err := exec.Command(ffmpegExecPath, "-y", "-i", mkvPath, "-c:a", "flac", "-map", "0:a:"+strconv.Itoa(audioStreamNumber), strings.TrimRight(path.Dir(flacPath), string(os.PathSeparator))+string(os.PathSeparator)+strconv.Itoa(trackNumber)+"_piece_"+strconv.Itoa(flacPieces)+".flac").CombinedOutput()
-						if err != nil {
-							return err
-						}
-
-						defer os.Remove(strings.TrimRight(path.Dir(flacPath), string(os.PathSeparator)) + string(os.PathSeparator) + strconv.Itoa(trackNumber) + "_piece_" + strconv.Itoa(flacPieces) + ".flac")
-
-						flacPieces = flacPieces + 1
-					}
-				}
+
+	if len(track.ChapterNumbers) == 1 {
+		for _, chapterInfo := range chapterInfos {
+			_, err := runTool(ctx, "ffmpeg", GetFfmpegExtractArgs(mkvPath, chapterInfo, audioStreamNumber, flacPath)...)
+			if err != nil {
+				return err
 			}
 		}
-	}
+	} else if len(chapterInfos) > 0 {
+		for flacPiece, chapterInfo := range chapterInfos {
+			flacPiecePath := GetFlacPiecePath(flacPath, trackNumber, flacPiece)
+
+			_, err := runTool(ctx, "ffmpeg", GetFfmpegExtractArgs(mkvPath, chapterInfo, audioStreamNumber, flacPiecePath)...)
+			if err != nil {
+				return err
+			}
 
-	if flacPieces > 0 {
-		flacConcatFileContents := ""
-		for i := 0; i < flacPieces; i++ {
-			flacConcatFileContents = flacConcatFileContents + "file '" + strings.TrimRight(path.Dir(flacPath), string(os.PathSeparator)) + string(os.PathSeparator) + strconv.Itoa(trackNumber) + "_piece_" + strconv.Itoa(i) + ".flac'" + "\n"
+			defer os.Remove(flacPiecePath)
 		}
 
-		concatPath := strings.TrimRight(path.Dir(flacPath), string(os.PathSeparator)) + string(os.PathSeparator) + "concatList.txt"
+		concatPath := GetFlacConcatListPath(flacPath, trackNumber)
 
 		var concatFile *os.File
 		concatFile, err = os.Create(concatPath)
@@ -192,7 +224,7 @@ func ExtractFlacFromMkv(mkvBasePath string, flacBasePath string, albumNumber int
 		}
 
 		concatFileWriter := bufio.NewWriter(concatFile)
-		_, err := concatFileWriter.WriteString(flacConcatFileContents)
+		_, err := concatFileWriter.WriteString(GetFlacConcatListContents(flacPath, trackNumber, len(chapterInfos)))
 		if err != nil {
 			return err
 		}
@@ -200,7 +232,7 @@ func ExtractFlacFromMkv(mkvBasePath string, flacBasePath string, albumNumber int
 		concatFileWriter.Flush()
 		concatFile.Close()
 
-		_, err = exec.Command(ffmpegExecPath, "-f", "concat", "-safe", "0", "-i", concatPath, "-c:a", "flac", flacPath).CombinedOutput()
+		_, err = runTool(ctx, "ffmpeg", GetFfmpegConcatArgs(concatPath, flacPath)...)
 		if err != nil {
 			return err
 		}
@@ -212,8 +244,8 @@ func ExtractFlacFromMkv(mkvBasePath string, flacBasePath string, albumNumber int
 		if track.TrimStartS > trackDuration {
 			return errors.New("data error - trim duration longer than track duration for track " + strconv.Itoa(track.TrackNumber))
 		}
-		trimmedFlacPath := path.Dir(flacPath) + string(os.PathSeparator) + "Trimmed" + path.Base(flacPath)
-		_, err := exec.Command(ffmpegExecPath, "-ss", fmt.Sprintf("%.6f", track.TrimStartS), "-i", flacPath, "-c:a", "copy", trimmedFlacPath).CombinedOutput()
+		trimmedFlacPath := GetTrimmedFlacPath(flacPath)
+		_, err := runTool(ctx, "ffmpeg", GetFfmpegTrimStartArgs(flacPath, fmt.Sprintf("%.6f", track.TrimStartS), trimmedFlacPath)...)
 		if err != nil {
 			return err
 		}
@@ -229,9 +261,9 @@ func ExtractFlacFromMkv(mkvBasePath string, flacBasePath string, albumNumber int
 		if track.TrimEndS > trackDuration {
 			return errors.New("data error - trim duration longer than track duration for track " + strconv.Itoa(track.TrackNumber))
 		}
-		trimmedFlacPath := path.Dir(flacPath) + string(os.PathSeparator) + "Trimmed" + path.Base(flacPath)
+		trimmedFlacPath := GetTrimmedFlacPath(flacPath)
 		trimmedDuration := trackDuration - track.TrimEndS
-		_, err := exec.Command(ffmpegExecPath, "-ss", "0", "-to", fmt.Sprintf("%.6f", trimmedDuration), "-i", flacPath, "-c:a", "copy", trimmedFlacPath).CombinedOutput()
+		_, err := runTool(ctx, "ffmpeg", GetFfmpegTrimEndArgs(flacPath, fmt.Sprintf("%.6f", trimmedDuration), trimmedFlacPath)...)
 		if err != nil {
 			return err
 		}
@@ -241,9 +273,119 @@ func ExtractFlacFromMkv(mkvBasePath string, flacBasePath string, albumNumber int
 		os.Rename(trimmedFlacPath, flacPath)
 	}
 
+	extractionFinished = true
+
 	return nil
 }
 
+// GetMakemkvconDiscSource returns the makemkvcon source for a drive by its makemkvcon disc ID.
+func GetMakemkvconDiscSource(makemkvconDiscId int) string {
+	return "disc:" + strconv.Itoa(makemkvconDiscId)
+}
+
+// GetMakemkvconDeviceSource returns the makemkvcon source for a drive by its device path, such as
+// /dev/sr0, so the drive doesn't need to be looked up by its disc ID first.
+func GetMakemkvconDeviceSource(devicePath string) string {
+	return "dev:" + devicePath
+}
+
+func GetExtractDiscToMkvArgs(makemkvconSource string, makemkvconTitleId string, destinationDir string) []string {
+	return []string{"-r", "--progress=-same", "mkv", "--minlength=0", makemkvconSource, makemkvconTitleId, destinationDir}
+}
+
+func GetBackupDiscArgs(makemkvconSource string, destinationDir string) []string {
+	return []string{"-r", "--progress=-same", "backup", makemkvconSource, destinationDir}
+}
+
+func GetExtractMkvFromBackupArgs(basePath string, makemkvconTitleId string, destinationDir string) []string {
+	return []string{"-r", "--progress=-same", "mkv", "--minlength=0", "file:" + strings.TrimRight(basePath, "/") + "/BDMV/index.bdmv", makemkvconTitleId, destinationDir}
+}
+
+// GetMakemkvconTitleId turns a config title number like 03 into the title ID makemkvcon expects.
+func GetMakemkvconTitleId(titleNumber string) (string, error) {
+	titleId, err := strconv.Atoi(titleNumber)
+	if err != nil || titleId < 0 {
+		return "", errors.New("invalid title number: " + titleNumber)
+	}
+
+	return strconv.Itoa(titleId), nil
+}
+
+// GetMkvTitleDirPattern is the os.MkdirTemp pattern for the directory a single title is ripped into.
+func GetMkvTitleDirPattern(titleNumber string) string {
+	return "title" + titleNumber + "_"
+}
+
+func GetChapterInfosForTrack(track BluRayDiscConfigAlbumDiscTrack, ffProbeData map[string][]*FfprobeChapterInfo) []*FfprobeChapterInfo {
+	chapterInfos := make([]*FfprobeChapterInfo, 0)
+
+	for _, chapterNumber := range track.ChapterNumbers {
+		for _, chapterInfo := range ffProbeData[track.TitleNumber] {
+			if chapterInfo.ChapterIndex == chapterNumber {
+				chapterInfos = append(chapterInfos, chapterInfo)
+			}
+		}
+	}
+
+	return chapterInfos
+}
+
+func GetChapterInfosDuration(chapterInfos []*FfprobeChapterInfo) float64 {
+	var duration float64
+	duration = 0
+
+	for _, chapterInfo := range chapterInfos {
+		duration = duration + chapterInfo.ChapterDuration
+	}
+
+	return duration
+}
+
+func GetFfmpegExtractArgs(mkvPath string, chapterInfo *FfprobeChapterInfo, audioStreamNumber int, outputPath string) []string {
+	if chapterInfo.IsChapter {
+		return GetFfmpegExtractChapterArgs(mkvPath, fmt.Sprintf("%.6f", chapterInfo.ChapterStartTime), fmt.Sprintf("%.6f", chapterInfo.ChapterDuration), audioStreamNumber, outputPath)
+	}
+
+	return []string{"-y", "-i", mkvPath, "-c:a", "flac", "-map", "0:a:" + strconv.Itoa(audioStreamNumber), outputPath}
+}
+
+func GetFfmpegExtractChapterArgs(mkvPath string, chapterStartTime string, chapterDuration string, audioStreamNumber int, outputPath string) []string {
+	return []string{"-y", "-ss", chapterStartTime, "-t", chapterDuration, "-i", mkvPath, "-c:a", "flac", "-map", "0:a:" + strconv.Itoa(audioStreamNumber), outputPath}
+}
+
+func GetFfmpegConcatArgs(concatPath string, flacPath string) []string {
+	return []string{"-f", "concat", "-safe", "0", "-i", concatPath, "-c:a", "flac", flacPath}
+}
+
+func GetFfmpegTrimStartArgs(flacPath string, trimStart string, trimmedFlacPath string) []string {
+	return []string{"-ss", trimStart, "-i", flacPath, "-c:a", "copy", trimmedFlacPath}
+}
+
+func GetFfmpegTrimEndArgs(flacPath string, trimmedDuration string, trimmedFlacPath string) []string {
+	return []string{"-ss", "0", "-to", trimmedDuration, "-i", flacPath, "-c:a", "copy", trimmedFlacPath}
+}
+
+func GetFlacPiecePath(flacPath string, trackNumber int, flacPiece int) string {
+	return strings.TrimRight(path.Dir(flacPath), string(os.PathSeparator)) + string(os.PathSeparator) + strconv.Itoa(trackNumber) + "_piece_" + strconv.Itoa(flacPiece) + ".flac"
+}
+
+func GetFlacConcatListPath(flacPath string, trackNumber int) string {
+	return strings.TrimRight(path.Dir(flacPath), string(os.PathSeparator)) + string(os.PathSeparator) + strconv.Itoa(trackNumber) + "_concatList.txt"
+}
+
+func GetFlacConcatListContents(flacPath string, trackNumber int, flacPieces int) string {
+	flacConcatFileContents := ""
+	for i := 0; i < flacPieces; i++ {
+		flacConcatFileContents = flacConcatFileContents + "file '" + GetFlacPiecePath(flacPath, trackNumber, i) + "'" + "\n"
+	}
+
+	return flacConcatFileContents
+}
+
+func GetTrimmedFlacPath(flacPath string) string {
+	return path.Dir(flacPath) + string(os.PathSeparator) + "Trimmed" + path.Base(flacPath)
+}
+
 func GetImageFileExtensionFromBytes(imageBytes []byte) (string, error) {
 	mimeType := http.DetectContentType(imageBytes)
 	switch mimeType {
@@ -327,8 +469,13 @@ func ExtractCoverImageFromMp3File(basePath string, album BluRayDiscConfigAlbum)
 	return ExtractCoverImageFromMp3Bytes(mp3Bytes)
 }
 
-func ExtractCoverImageFromUrl(coverUrl string) ([]byte, string, error) {
-	coverResponse, err := http.Get(coverUrl)
+func ExtractCoverImageFromUrl(ctx context.Context, coverUrl string) ([]byte, string, error) {
+	coverRequest, err := http.NewRequestWithContext(ctx, http.MethodGet, coverUrl, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	coverResponse, err := http.DefaultClient.Do(coverRequest)
 	if err != nil {
 		return nil, "", err
 	}
@@ -511,7 +658,7 @@ func CopyCoverImageFromZippedMp3FileToDestinationDirectory(basePath string, albu
 	return fullCoverArtPath, nil
 }
 
-func CopyCoverImageFromUrlToDestinationDirectory(coverUrl string, destinationDir string) (string, error) {
+func CopyCoverImageFromUrlToDestinationDirectory(ctx context.Context, coverUrl string, destinationDir string) (string, error) {
 	_, err := os.ReadDir(destinationDir)
 	if err != nil {
 		err := os.MkdirAll(destinationDir, 0755)
@@ -530,7 +677,7 @@ func CopyCoverImageFromUrlToDestinationDirectory(coverUrl string, destinationDir
 		validatedDestinationDir = path.Dir(destinationDir)
 	}
 
-	imageBytes, coverExtension, err := ExtractCoverImageFromUrl(coverUrl)
+	imageBytes, coverExtension, err := ExtractCoverImageFromUrl(ctx, coverUrl)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,263 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func newTestDiscConfig() BluRayDiscConfig {
+	return BluRayDiscConfig{
+		DiscVolumeKeySha1: "0123456789abcdef0123456789abcdef01234567",
+		BluRayTitle:       "Test Disc",
+		MakemkvPrefix:     "TEST_DISC",
+		Albums: []BluRayDiscConfigAlbum{
+			{
+				AlbumNumber: 1,
+				AlbumTitle:  "Test Album",
+				AlbumArtist: "Test Artist",
+				Genre:       "Game",
+				ReleaseDate: "2014-03-26",
+				TotalDiscs:  1,
+				CoverType:   "url",
+				CoverUrl:    "https://example.com/cover.jpg",
+				Discs: []BluRayDiscConfigAlbumDisc{
+					{
+						DiscNumber:  1,
+						TotalTracks: 3,
+						Tracks: []BluRayDiscConfigAlbumDiscTrack{
+							{TrackNumber: 1, TitleNumber: "00", ChapterNumbers: []int{0}, TrackTitle: "First", Artists: []string{"Composer A", "Composer B"}},
+							{TrackNumber: 2, TitleNumber: "00", ChapterNumbers: []int{1, 2}, TrackTitle: "Second"},
+							{TrackNumber: 3, TitleNumber: "00", ChapterNumbers: []int{0}, TrackTitle: "Third", TrimStartS: 1.5, TrimEndS: 2},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func newTestFfprobeData() map[string][]*FfprobeChapterInfo {
+	return map[string][]*FfprobeChapterInfo{
+		"00": {
+			{IsChapter: true, ChapterIndex: 0, ChapterStartTime: 0, ChapterEndTime: 100, ChapterDuration: 100},
+			{IsChapter: true, ChapterIndex: 1, ChapterStartTime: 100, ChapterEndTime: 150, ChapterDuration: 50},
+			{IsChapter: true, ChapterIndex: 2, ChapterStartTime: 150, ChapterEndTime: 175.5, ChapterDuration: 25.5},
+		},
+	}
+}
+
+func TestGetExtractDiscToMkvArgs(t *testing.T) {
+	args := GetExtractDiscToMkvArgs(GetMakemkvconDiscSource(0), "3", "/tmp/out")
+	expectedArgs := []string{"-r", "--progress=-same", "mkv", "--minlength=0", "disc:0", "3", "/tmp/out"}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("got %q, expected %q", args, expectedArgs)
+	}
+
+	args = GetExtractDiscToMkvArgs(GetMakemkvconDeviceSource("/dev/sr0"), "12", "/tmp/out")
+	expectedArgs = []string{"-r", "--progress=-same", "mkv", "--minlength=0", "dev:/dev/sr0", "12", "/tmp/out"}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("got %q, expected %q", args, expectedArgs)
+	}
+}
+
+func TestGetFfmpegArgs(t *testing.T) {
+	testCases := []struct {
+		name         string
+		args         []string
+		expectedArgs []string
+	}{
+		{
+			name:         "chapter",
+			args:         GetFfmpegExtractArgs("in.mkv", &FfprobeChapterInfo{IsChapter: true, ChapterStartTime: 100, ChapterDuration: 25.5}, 2, "out.flac"),
+			expectedArgs: []string{"-y", "-ss", "100.000000", "-t", "25.500000", "-i", "in.mkv", "-c:a", "flac", "-map", "0:a:2", "out.flac"},
+		},
+		{
+			name:         "whole title",
+			args:         GetFfmpegExtractArgs("in.mkv", &FfprobeChapterInfo{IsChapter: false, ChapterDuration: 60}, 0, "out.flac"),
+			expectedArgs: []string{"-y", "-i", "in.mkv", "-c:a", "flac", "-map", "0:a:0", "out.flac"},
+		},
+		{
+			name:         "concat",
+			args:         GetFfmpegConcatArgs("list.txt", "out.flac"),
+			expectedArgs: []string{"-f", "concat", "-safe", "0", "-i", "list.txt", "-c:a", "flac", "out.flac"},
+		},
+		{
+			name:         "trim start",
+			args:         GetFfmpegTrimStartArgs("out.flac", "1.500000", "Trimmedout.flac"),
+			expectedArgs: []string{"-ss", "1.500000", "-i", "out.flac", "-c:a", "copy", "Trimmedout.flac"},
+		},
+		{
+			name:         "trim end",
+			args:         GetFfmpegTrimEndArgs("out.flac", "96.500000", "Trimmedout.flac"),
+			expectedArgs: []string{"-ss", "0", "-to", "96.500000", "-i", "out.flac", "-c:a", "copy", "Trimmedout.flac"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if !reflect.DeepEqual(testCase.args, testCase.expectedArgs) {
+				t.Errorf("got %q, expected %q", testCase.args, testCase.expectedArgs)
+			}
+		})
+	}
+}
+
+func getTestExtractPaths(t *testing.T, discConfig BluRayDiscConfig, trackNumber int) (string, string, string, string) {
+	t.Helper()
+
+	mkvBasePath := t.TempDir()
+	flacBasePath := t.TempDir()
+
+	mkvPath, err := GetMkvPathByTrackNumber(mkvBasePath, 1, 1, trackNumber, discConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	createTestFile(t, mkvPath)
+
+	flacPath, err := GetFlacPathByTrackNumber(flacBasePath, 1, 1, trackNumber, discConfig, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return mkvBasePath, flacBasePath, mkvPath, flacPath
+}
+
+func TestExtractFlacFromMkvSingleChapter(t *testing.T) {
+	discConfig := newTestDiscConfig()
+	mkvBasePath, flacBasePath, mkvPath, flacPath := getTestExtractPaths(t, discConfig, 1)
+
+	commandRunner := &FakeCommandRunner{Commands: []FakeCommand{{Name: "ffmpeg"}}}
+	ctx := WithCommandRunner(context.Background(), commandRunner)
+
+	err := ExtractFlacFromMkv(ctx, mkvBasePath, flacBasePath, 1, 1, 1, newTestFfprobeData(), discConfig, "", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedCalls := []RecordedCommand{
+		{Name: "ffmpeg", Args: []string{"-y", "-ss", "0.000000", "-t", "100.000000", "-i", mkvPath, "-c:a", "flac", "-map", "0:a:0", flacPath}},
+	}
+	if !reflect.DeepEqual(commandRunner.GetCalls(), expectedCalls) {
+		t.Errorf("got calls %+v, expected %+v", commandRunner.GetCalls(), expectedCalls)
+	}
+}
+
+func TestExtractFlacFromMkvMultipleChapters(t *testing.T) {
+	discConfig := newTestDiscConfig()
+	mkvBasePath, flacBasePath, mkvPath, flacPath := getTestExtractPaths(t, discConfig, 2)
+
+	commandRunner := &FakeCommandRunner{Commands: []FakeCommand{{Name: "ffmpeg"}}}
+	ctx := WithCommandRunner(context.Background(), commandRunner)
+
+	err := ExtractFlacFromMkv(ctx, mkvBasePath, flacBasePath, 1, 1, 2, newTestFfprobeData(), discConfig, "", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedCalls := []RecordedCommand{
+		{Name: "ffmpeg", Args: []string{"-y", "-ss", "100.000000", "-t", "50.000000", "-i", mkvPath, "-c:a", "flac", "-map", "0:a:0", GetFlacPiecePath(flacPath, 2, 0)}},
+		{Name: "ffmpeg", Args: []string{"-y", "-ss", "150.000000", "-t", "25.500000", "-i", mkvPath, "-c:a", "flac", "-map", "0:a:0", GetFlacPiecePath(flacPath, 2, 1)}},
+		{Name: "ffmpeg", Args: GetFfmpegConcatArgs(GetFlacConcatListPath(flacPath, 2), flacPath)},
+	}
+	if !reflect.DeepEqual(commandRunner.GetCalls(), expectedCalls) {
+		t.Errorf("got calls %+v, expected %+v", commandRunner.GetCalls(), expectedCalls)
+	}
+
+	if _, err := os.Stat(GetFlacConcatListPath(flacPath, 2)); !os.IsNotExist(err) {
+		t.Errorf("expected the concat list to be removed")
+	}
+}
+
+func TestExtractFlacFromMkvTrims(t *testing.T) {
+	discConfig := newTestDiscConfig()
+	mkvBasePath, flacBasePath, mkvPath, flacPath := getTestExtractPaths(t, discConfig, 3)
+
+	commandRunner := &FakeCommandRunner{Commands: []FakeCommand{{Name: "ffmpeg"}}}
+	ctx := WithCommandRunner(context.Background(), commandRunner)
+
+	err := ExtractFlacFromMkv(ctx, mkvBasePath, flacBasePath, 1, 1, 3, newTestFfprobeData(), discConfig, "", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	trimmedFlacPath := GetTrimmedFlacPath(flacPath)
+	expectedCalls := []RecordedCommand{
+		{Name: "ffmpeg", Args: []string{"-y", "-ss", "0.000000", "-t", "100.000000", "-i", mkvPath, "-c:a", "flac", "-map", "0:a:0", flacPath}},
+		{Name: "ffmpeg", Args: GetFfmpegTrimStartArgs(flacPath, "1.500000", trimmedFlacPath)},
+		{Name: "ffmpeg", Args: GetFfmpegTrimEndArgs(flacPath, "96.500000", trimmedFlacPath)},
+	}
+	if !reflect.DeepEqual(commandRunner.GetCalls(), expectedCalls) {
+		t.Errorf("got calls %+v, expected %+v", commandRunner.GetCalls(), expectedCalls)
+	}
+}
+
+func TestExtractFlacFromMkvToolError(t *testing.T) {
+	discConfig := newTestDiscConfig()
+	mkvBasePath, flacBasePath, _, flacPath := getTestExtractPaths(t, discConfig, 1)
+	createTestFile(t, flacPath)
+
+	commandRunner := &FakeCommandRunner{Commands: []FakeCommand{
+		{Name: "ffmpeg", Output: "Stream map '0:a:0' matches no streams.\n", ExitCode: 1},
+	}}
+	ctx := WithCommandRunner(context.Background(), commandRunner)
+
+	err := ExtractFlacFromMkv(ctx, mkvBasePath, flacBasePath, 1, 1, 1, newTestFfprobeData(), discConfig, "", false)
+
+	var toolError *ToolError
+	if !errors.As(err, &toolError) {
+		t.Fatalf("expected a *ToolError, got %v", err)
+	}
+
+	if toolError.Tool != "ffmpeg" || toolError.ExitCode != 1 || toolError.LastOutputLine() != "Stream map '0:a:0' matches no streams." {
+		t.Errorf("unexpected tool error: %+v", toolError)
+	}
+
+	if len(commandRunner.GetCalls()) != 1 {
+		t.Errorf("expected extraction to stop after the failed command, got %+v", commandRunner.GetCalls())
+	}
+
+	if _, err := os.Stat(flacPath); !os.IsNotExist(err) {
+		t.Errorf("expected the partial FLAC file to be removed")
+	}
+}
+
+func TestExtractFlacFromMkvMissingTool(t *testing.T) {
+	discConfig := newTestDiscConfig()
+	mkvBasePath, flacBasePath, _, _ := getTestExtractPaths(t, discConfig, 1)
+
+	commandRunner := &FakeCommandRunner{MissingTools: []string{"ffmpeg"}}
+	ctx := WithCommandRunner(context.Background(), commandRunner)
+
+	err := ExtractFlacFromMkv(ctx, mkvBasePath, flacBasePath, 1, 1, 1, newTestFfprobeData(), discConfig, "", false)
+
+	var toolError *ToolError
+	if !errors.As(err, &toolError) || toolError.ExitCode != -1 {
+		t.Fatalf("expected a *ToolError without an exit code, got %v", err)
+	}
+
+	if len(commandRunner.GetCalls()) != 0 {
+		t.Errorf("expected no commands to be run, got %+v", commandRunner.GetCalls())
+	}
+}
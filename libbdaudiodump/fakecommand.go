@@ -0,0 +1,150 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FakeCommand is a canned result for FakeCommandRunner.  A nil Args matches any arguments.  If
+// Wait is set, the command doesn't finish until Wait is closed or its context is cancelled, so a
+// test can hold a command in progress.
+type FakeCommand struct {
+	Name     string
+	Args     []string
+	Output   string
+	ExitCode int
+	Wait     <-chan struct{}
+}
+
+type RecordedCommand struct {
+	Name string
+	Args []string
+}
+
+// FakeCommandRunner is a CommandRunner that never starts a process.  It records every command
+// it's asked to run and replays the output and exit code of the first matching FakeCommand.
+// Tools are "found" under their own name unless they're listed in MissingTools.
+type FakeCommandRunner struct {
+	Commands     []FakeCommand
+	MissingTools []string
+	Calls        []RecordedCommand
+	callsMutex   sync.Mutex
+}
+
+type FakeExitError struct {
+	Code int
+}
+
+func (fakeExitError *FakeExitError) Error() string {
+	return "exit status " + strconv.Itoa(fakeExitError.Code)
+}
+
+func (fakeExitError *FakeExitError) ExitCode() int {
+	return fakeExitError.Code
+}
+
+func (fakeCommandRunner *FakeCommandRunner) LookPath(file string) (string, error) {
+	for _, missingTool := range fakeCommandRunner.MissingTools {
+		if missingTool == file {
+			return "", &exec.Error{Name: file, Err: exec.ErrNotFound}
+		}
+	}
+
+	return file, nil
+}
+
+func (fakeCommandRunner *FakeCommandRunner) CombinedOutput(ctx context.Context, name string, args ...string) ([]byte, error) {
+	fakeCommandRunner.callsMutex.Lock()
+	fakeCommandRunner.Calls = append(fakeCommandRunner.Calls, RecordedCommand{Name: name, Args: append([]string{}, args...)})
+	fakeCommandRunner.callsMutex.Unlock()
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	for _, fakeCommand := range fakeCommandRunner.Commands {
+		if fakeCommand.Name != name || !fakeCommandArgsMatch(fakeCommand.Args, args) {
+			continue
+		}
+
+		if fakeCommand.Wait != nil {
+			select {
+			case <-fakeCommand.Wait:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		if fakeCommand.ExitCode != 0 {
+			return []byte(fakeCommand.Output), &FakeExitError{Code: fakeCommand.ExitCode}
+		}
+
+		return []byte(fakeCommand.Output), nil
+	}
+
+	return nil, errors.New("no fake result for command: " + FormatCommandLine(name, args))
+}
+
+// StreamOutputLines replays the matching FakeCommand's output one line at a time.
+func (fakeCommandRunner *FakeCommandRunner) StreamOutputLines(ctx context.Context, name string, onLine func(line string), args ...string) error {
+	output, err := fakeCommandRunner.CombinedOutput(ctx, name, args...)
+
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			onLine(line)
+		}
+	}
+
+	return err
+}
+
+// GetCalls returns a copy of the commands run so far, which is safe to use while other
+// goroutines are still running commands.
+func (fakeCommandRunner *FakeCommandRunner) GetCalls() []RecordedCommand {
+	fakeCommandRunner.callsMutex.Lock()
+	defer fakeCommandRunner.callsMutex.Unlock()
+
+	return append([]RecordedCommand{}, fakeCommandRunner.Calls...)
+}
+
+func fakeCommandArgsMatch(expectedArgs []string, args []string) bool {
+	if expectedArgs == nil {
+		return true
+	}
+
+	if len(expectedArgs) != len(args) {
+		return false
+	}
+
+	for i := range expectedArgs {
+		if expectedArgs[i] != args[i] {
+			return false
+		}
+	}
+
+	return true
+}
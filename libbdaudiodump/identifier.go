@@ -0,0 +1,170 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	DiscIdentifierTypeVolumeKeySha1   = "volume_key_sha1"
+	DiscIdentifierTypeBdmvContentSha1 = "bdmv_content_sha1"
+)
+
+// DiscIdentifier is one way of identifying a disc, such as the SHA1 of /AACS/Unit_Key_RO.inf.
+type DiscIdentifier struct {
+	Type  string
+	Value string
+}
+
+func IsValidDiscIdentifierType(discIdentifierType string) bool {
+	return discIdentifierType == DiscIdentifierTypeVolumeKeySha1 || discIdentifierType == DiscIdentifierTypeBdmvContentSha1
+}
+
+// GetDiscConfigIdentifierType returns the identifier type a disc config's hash is for, which is
+// the volume key SHA1 unless the config says otherwise.
+func GetDiscConfigIdentifierType(discConfig BluRayDiscConfig) string {
+	if discConfig.DiscIdentifierType == "" {
+		return DiscIdentifierTypeVolumeKeySha1
+	}
+
+	return discConfig.DiscIdentifierType
+}
+
+// GetDiscConfigVariantIdentifierType returns the identifier type a variant's hash is for, which
+// is the disc config's unless the variant says otherwise.
+func GetDiscConfigVariantIdentifierType(discConfig BluRayDiscConfig, variant BluRayDiscConfigVariant) string {
+	if variant.DiscIdentifierType == "" {
+		return GetDiscConfigIdentifierType(discConfig)
+	}
+
+	return variant.DiscIdentifierType
+}
+
+// GetDiscIdentifiers identifies the disc mounted at basePath in every way it can, in the order
+// they should be looked up in: the volume key SHA1 first, then the BDMV content SHA1 for discs
+// without AACS/Unit_Key_RO.inf.  An error is only returned if none of them work.
+func GetDiscIdentifiers(basePath string) ([]DiscIdentifier, error) {
+	discIdentifiers := make([]DiscIdentifier, 0)
+
+	discVolumeKeySha1Hash, volumeKeyErr := GetDiscVolumeKeySha1Hash(basePath)
+	if volumeKeyErr == nil {
+		discIdentifiers = append(discIdentifiers, DiscIdentifier{Type: DiscIdentifierTypeVolumeKeySha1, Value: discVolumeKeySha1Hash})
+	}
+
+	discBdmvContentSha1Hash, bdmvContentErr := GetDiscBdmvContentSha1Hash(basePath)
+	if bdmvContentErr == nil {
+		discIdentifiers = append(discIdentifiers, DiscIdentifier{Type: DiscIdentifierTypeBdmvContentSha1, Value: discBdmvContentSha1Hash})
+	}
+
+	if len(discIdentifiers) == 0 {
+		return nil, errors.New("unable to identify disc at " + basePath + ": " + volumeKeyErr.Error() + ", " + bdmvContentErr.Error())
+	}
+
+	return discIdentifiers, nil
+}
+
+// GetDiscBdmvContentSha1Hash hashes BDMV/index.bdmv, BDMV/MovieObject.bdmv, and the names and
+// sizes of the files in BDMV/PLAYLIST.  This identifies discs without AACS/Unit_Key_RO.inf, such
+// as unencrypted discs and decrypted backups, and stays the same for a backup of the disc.
+func GetDiscBdmvContentSha1Hash(basePath string) (string, error) {
+	bdmvPath := filepath.Join(basePath, "BDMV")
+
+	sha1Hash := sha1.New()
+
+	for _, fileName := range []string{"index.bdmv", "MovieObject.bdmv"} {
+		fileData, err := os.ReadFile(filepath.Join(bdmvPath, fileName))
+		if err != nil {
+			return "", err
+		}
+
+		// Lengths keep one file's contents from running into the next
+		io.WriteString(sha1Hash, fileName+"\n"+strconv.Itoa(len(fileData))+"\n")
+		sha1Hash.Write(fileData)
+	}
+
+	playlistEntries, err := os.ReadDir(filepath.Join(bdmvPath, "PLAYLIST"))
+	if err != nil {
+		return "", err
+	}
+
+	playlistListing := make([]string, 0)
+	for _, playlistEntry := range playlistEntries {
+		playlistInfo, err := playlistEntry.Info()
+		if err != nil {
+			return "", err
+		}
+
+		playlistListing = append(playlistListing, playlistEntry.Name()+" "+strconv.FormatInt(playlistInfo.Size(), 10))
+	}
+	sort.Strings(playlistListing)
+
+	io.WriteString(sha1Hash, "PLAYLIST\n"+strings.Join(playlistListing, "\n"))
+
+	return hex.EncodeToString(sha1Hash.Sum(nil)), nil
+}
+
+// GetDiscConfigByIdentifiers looks up each identifier in order, and returns the first disc config
+// that has a matching hash of the same identifier type, along with the identifier that matched.
+func GetDiscConfigByIdentifiers(ctx context.Context, discIdentifiers []DiscIdentifier, discConfigs *[]BluRayDiscConfig) (*BluRayDiscConfig, *DiscIdentifier, error) {
+	identifierDescriptions := make([]string, 0)
+
+	for i := range discIdentifiers {
+		discConfig := getDiscConfigByIdentifier(ctx, discIdentifiers[i], discConfigs)
+		if discConfig != nil {
+			return discConfig, &discIdentifiers[i], nil
+		}
+
+		identifierDescriptions = append(identifierDescriptions, discIdentifiers[i].Type+" "+discIdentifiers[i].Value)
+	}
+
+	return nil, nil, fmt.Errorf("%w: %s", ErrUnknownDiscHash, strings.Join(identifierDescriptions, ", "))
+}
+
+// getDiscConfigByIdentifier finds the disc config or variant with the identifier's hash.  An
+// empty identifier type matches a hash of any type.
+func getDiscConfigByIdentifier(ctx context.Context, discIdentifier DiscIdentifier, discConfigs *[]BluRayDiscConfig) *BluRayDiscConfig {
+	for _, discConfig := range *discConfigs {
+		if discConfig.DiscVolumeKeySha1 == discIdentifier.Value && (discIdentifier.Type == "" || discIdentifier.Type == GetDiscConfigIdentifierType(discConfig)) {
+			notifyObservers(ctx, DiscIdentifiedEvent{DiscVolumeKeySha1: discConfig.DiscVolumeKeySha1, BluRayTitle: discConfig.BluRayTitle})
+			return &discConfig
+		}
+
+		for _, variant := range discConfig.Variants {
+			if variant.DiscVolumeKeySha1 == discIdentifier.Value && (discIdentifier.Type == "" || discIdentifier.Type == GetDiscConfigVariantIdentifierType(discConfig, variant)) {
+				resolvedDiscConfig := ResolveDiscConfigVariant(discConfig, variant)
+				notifyObservers(ctx, DiscIdentifiedEvent{DiscVolumeKeySha1: resolvedDiscConfig.DiscVolumeKeySha1, BluRayTitle: resolvedDiscConfig.BluRayTitle, VariantName: resolvedDiscConfig.VariantName})
+				return &resolvedDiscConfig
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,383 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// jsonSchemaValidator checks a value against the parts of JSON Schema (draft-07) the config
+// format schema uses.  Keywords it doesn't support are ignored, like any unknown keyword.
+// Values must be decoded with UseNumber so integers can be told apart from other numbers.
+type jsonSchemaValidator struct {
+	rootSchema map[string]any
+	patterns   map[string]*regexp.Regexp
+}
+
+func validateJsonSchema(rootSchema map[string]any, value any, reportError func(pointer string, message string)) {
+	validator := &jsonSchemaValidator{rootSchema: rootSchema, patterns: make(map[string]*regexp.Regexp)}
+	validator.validate(rootSchema, value, "", reportError)
+}
+
+// matches checks a value without reporting anything, for keywords like if and anyOf.
+func (validator *jsonSchemaValidator) matches(schema map[string]any, value any) bool {
+	matched := true
+	validator.validate(schema, value, "", func(string, string) {
+		matched = false
+	})
+
+	return matched
+}
+
+func (validator *jsonSchemaValidator) validate(schema map[string]any, value any, pointer string, reportError func(pointer string, message string)) {
+	if ref, hasRef := schema["$ref"].(string); hasRef {
+		refSchema, err := validator.resolveRef(ref)
+		if err != nil {
+			reportError(pointer, err.Error())
+			return
+		}
+
+		validator.validate(refSchema, value, pointer, reportError)
+	}
+
+	if schemaType, hasType := schema["type"]; hasType && !jsonValueHasSchemaType(value, schemaType) {
+		// The other keywords would only repeat the same problem
+		reportError(pointer, "invalid type ("+getJsonValueTypeName(value)+"), expected "+strings.Join(getSchemaTypeNames(schemaType), " or "))
+		return
+	}
+
+	if enumValues, hasEnum := schema["enum"].([]any); hasEnum {
+		isInEnum := false
+		enumStrings := make([]string, 0)
+		for _, enumValue := range enumValues {
+			isInEnum = isInEnum || jsonValuesEqual(value, enumValue)
+			enumStrings = append(enumStrings, formatJsonValue(enumValue))
+		}
+
+		if !isInEnum {
+			reportError(pointer, "invalid value ("+formatJsonValue(value)+"), must be one of: "+strings.Join(enumStrings, ", "))
+		}
+	}
+	if constValue, hasConst := schema["const"]; hasConst && !jsonValuesEqual(value, constValue) {
+		reportError(pointer, "invalid value ("+formatJsonValue(value)+"), must be "+formatJsonValue(constValue))
+	}
+
+	switch typedValue := value.(type) {
+	case map[string]any:
+		validator.validateObject(schema, typedValue, pointer, reportError)
+	case []any:
+		validator.validateArray(schema, typedValue, pointer, reportError)
+	case string:
+		validator.validateString(schema, typedValue, pointer, reportError)
+	case json.Number:
+		validator.validateNumber(schema, typedValue, pointer, reportError)
+	}
+
+	for _, subschema := range getSubschemas(schema["allOf"]) {
+		validator.validate(subschema, value, pointer, reportError)
+	}
+	if anyOfSchemas := getSubschemas(schema["anyOf"]); len(anyOfSchemas) > 0 {
+		matchedAny := false
+		for _, subschema := range anyOfSchemas {
+			matchedAny = matchedAny || validator.matches(subschema, value)
+		}
+
+		if !matchedAny {
+			reportError(pointer, "doesn't match any of the allowed forms")
+		}
+	}
+	if oneOfSchemas := getSubschemas(schema["oneOf"]); len(oneOfSchemas) > 0 {
+		matchedCount := 0
+		for _, subschema := range oneOfSchemas {
+			if validator.matches(subschema, value) {
+				matchedCount++
+			}
+		}
+
+		if matchedCount != 1 {
+			reportError(pointer, "must match exactly one of the allowed forms, but matches "+strconv.Itoa(matchedCount))
+		}
+	}
+	if notSchema, hasNot := schema["not"].(map[string]any); hasNot && validator.matches(notSchema, value) {
+		reportError(pointer, "matches a form that isn't allowed")
+	}
+	if ifSchema, hasIf := schema["if"].(map[string]any); hasIf {
+		if validator.matches(ifSchema, value) {
+			if thenSchema, hasThen := schema["then"].(map[string]any); hasThen {
+				validator.validate(thenSchema, value, pointer, reportError)
+			}
+		} else if elseSchema, hasElse := schema["else"].(map[string]any); hasElse {
+			validator.validate(elseSchema, value, pointer, reportError)
+		}
+	}
+}
+
+func (validator *jsonSchemaValidator) validateObject(schema map[string]any, value map[string]any, pointer string, reportError func(pointer string, message string)) {
+	if requiredKeys, hasRequired := schema["required"].([]any); hasRequired {
+		for _, requiredKey := range requiredKeys {
+			requiredKeyString, _ := requiredKey.(string)
+			if _, hasKey := value[requiredKeyString]; !hasKey {
+				reportError(pointer+"/"+EscapeJsonPointerToken(requiredKeyString), "missing required field: "+requiredKeyString)
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	properties, _ := schema["properties"].(map[string]any)
+	for _, key := range keys {
+		keyPointer := pointer + "/" + EscapeJsonPointerToken(key)
+
+		if propertySchema, isProperty := properties[key].(map[string]any); isProperty {
+			validator.validate(propertySchema, value[key], keyPointer, reportError)
+			continue
+		}
+
+		switch additionalProperties := schema["additionalProperties"].(type) {
+		case bool:
+			if !additionalProperties {
+				reportError(keyPointer, "unknown field: "+key)
+			}
+		case map[string]any:
+			validator.validate(additionalProperties, value[key], keyPointer, reportError)
+		}
+	}
+}
+
+func (validator *jsonSchemaValidator) validateArray(schema map[string]any, value []any, pointer string, reportError func(pointer string, message string)) {
+	if minItems, hasMinItems := schema["minItems"].(float64); hasMinItems && float64(len(value)) < minItems {
+		if minItems == 1 {
+			reportError(pointer, "must not be empty")
+		} else {
+			reportError(pointer, "must have at least "+formatJsonValue(minItems)+" items")
+		}
+	}
+
+	if itemSchema, hasItems := schema["items"].(map[string]any); hasItems {
+		for i, item := range value {
+			validator.validate(itemSchema, item, pointer+"/"+strconv.Itoa(i), reportError)
+		}
+	}
+}
+
+func (validator *jsonSchemaValidator) validateString(schema map[string]any, value string, pointer string, reportError func(pointer string, message string)) {
+	if minLength, hasMinLength := schema["minLength"].(float64); hasMinLength && float64(utf8.RuneCountInString(value)) < minLength {
+		if minLength == 1 {
+			reportError(pointer, "must not be empty")
+		} else {
+			reportError(pointer, "must be at least "+formatJsonValue(minLength)+" characters")
+		}
+	}
+
+	if pattern, hasPattern := schema["pattern"].(string); hasPattern {
+		patternRegexp, err := validator.getPattern(pattern)
+		if err != nil {
+			reportError(pointer, "invalid pattern in schema ("+pattern+"): "+err.Error())
+		} else if !patternRegexp.MatchString(value) {
+			reportError(pointer, "invalid value ("+formatJsonValue(value)+"), must match pattern: "+pattern)
+		}
+	}
+}
+
+func (validator *jsonSchemaValidator) validateNumber(schema map[string]any, value json.Number, pointer string, reportError func(pointer string, message string)) {
+	numberValue, err := value.Float64()
+	if err != nil {
+		return
+	}
+
+	if minimum, hasMinimum := schema["minimum"].(float64); hasMinimum && numberValue < minimum {
+		reportError(pointer, "invalid value ("+value.String()+"), must be at least "+formatJsonValue(minimum))
+	}
+	if maximum, hasMaximum := schema["maximum"].(float64); hasMaximum && numberValue > maximum {
+		reportError(pointer, "invalid value ("+value.String()+"), must be at most "+formatJsonValue(maximum))
+	}
+}
+
+func (validator *jsonSchemaValidator) getPattern(pattern string) (*regexp.Regexp, error) {
+	if patternRegexp, isCompiled := validator.patterns[pattern]; isCompiled {
+		return patternRegexp, nil
+	}
+
+	patternRegexp, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	validator.patterns[pattern] = patternRegexp
+
+	return patternRegexp, nil
+}
+
+// resolveRef only supports references within the schema, such as #/definitions/album
+func (validator *jsonSchemaValidator) resolveRef(ref string) (map[string]any, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, errors.New("unsupported schema reference: " + ref)
+	}
+
+	var refValue any = validator.rootSchema
+	for _, refToken := range strings.Split(strings.TrimPrefix(ref, "#"), "/")[1:] {
+		refToken = strings.ReplaceAll(strings.ReplaceAll(refToken, "~1", "/"), "~0", "~")
+
+		refObject, isObject := refValue.(map[string]any)
+		if !isObject {
+			return nil, errors.New("invalid schema reference: " + ref)
+		}
+
+		refValue = refObject[refToken]
+	}
+
+	refSchema, isSchema := refValue.(map[string]any)
+	if !isSchema {
+		return nil, errors.New("invalid schema reference: " + ref)
+	}
+
+	return refSchema, nil
+}
+
+func getSubschemas(subschemasValue any) []map[string]any {
+	subschemas := make([]map[string]any, 0)
+
+	subschemaValues, _ := subschemasValue.([]any)
+	for _, subschemaValue := range subschemaValues {
+		if subschema, isSchema := subschemaValue.(map[string]any); isSchema {
+			subschemas = append(subschemas, subschema)
+		}
+	}
+
+	return subschemas
+}
+
+func getSchemaTypeNames(schemaType any) []string {
+	switch typedSchemaType := schemaType.(type) {
+	case string:
+		return []string{typedSchemaType}
+	case []any:
+		typeNames := make([]string, 0)
+		for _, typeName := range typedSchemaType {
+			if typeNameString, isString := typeName.(string); isString {
+				typeNames = append(typeNames, typeNameString)
+			}
+		}
+
+		return typeNames
+	}
+
+	return []string{}
+}
+
+func jsonValueHasSchemaType(value any, schemaType any) bool {
+	for _, typeName := range getSchemaTypeNames(schemaType) {
+		if typeName == getJsonValueTypeName(value) {
+			return true
+		}
+
+		// Integers are numbers too, and numbers like 1.0 are integers
+		if numberValue, isNumber := value.(json.Number); isNumber {
+			floatValue, err := numberValue.Float64()
+			if typeName == "number" || (typeName == "integer" && err == nil && floatValue == math.Trunc(floatValue)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func getJsonValueTypeName(value any) string {
+	switch typedValue := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := typedValue.Int64(); err == nil {
+			return "integer"
+		}
+
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+
+	return "unknown"
+}
+
+// jsonValuesEqual compares a decoded value with one from the schema, where numbers are float64
+// rather than json.Number, including numbers inside objects and arrays.
+func jsonValuesEqual(valueA any, valueB any) bool {
+	return reflect.DeepEqual(normalizeJsonNumbers(valueA), normalizeJsonNumbers(valueB))
+}
+
+func normalizeJsonNumbers(value any) any {
+	switch typedValue := value.(type) {
+	case json.Number:
+		floatValue, err := typedValue.Float64()
+		if err != nil {
+			return typedValue.String()
+		}
+
+		return floatValue
+	case []any:
+		normalizedValues := make([]any, len(typedValue))
+		for i, item := range typedValue {
+			normalizedValues[i] = normalizeJsonNumbers(item)
+		}
+
+		return normalizedValues
+	case map[string]any:
+		normalizedValues := make(map[string]any, len(typedValue))
+		for key, item := range typedValue {
+			normalizedValues[key] = normalizeJsonNumbers(item)
+		}
+
+		return normalizedValues
+	}
+
+	return value
+}
+
+func formatJsonValue(value any) string {
+	if floatValue, isFloat := value.(float64); isFloat {
+		return strconv.FormatFloat(floatValue, 'f', -1, 64)
+	}
+
+	formattedValue, err := json.Marshal(value)
+	if err != nil {
+		return "?"
+	}
+
+	return string(formattedValue)
+}
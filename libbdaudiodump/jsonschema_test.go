@@ -0,0 +1,146 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestValidateJsonSchema(t *testing.T) {
+	tests := []struct {
+		name           string
+		schema         string
+		value          string
+		expectedErrors []string
+	}{
+		{name: "type", schema: `{"type": "string"}`, value: `"a"`, expectedErrors: []string{}},
+		{name: "wrong type", schema: `{"type": "string"}`, value: `1`, expectedErrors: []string{": invalid type (integer), expected string"}},
+		{name: "several types", schema: `{"type": ["string", "null"]}`, value: `null`, expectedErrors: []string{}},
+		{name: "wrong type of several", schema: `{"type": ["string", "null"]}`, value: `true`, expectedErrors: []string{": invalid type (boolean), expected string or null"}},
+		{name: "integer", schema: `{"type": "integer"}`, value: `3`, expectedErrors: []string{}},
+		{name: "integer written as a decimal", schema: `{"type": "integer"}`, value: `3.0`, expectedErrors: []string{}},
+		{name: "decimal for an integer", schema: `{"type": "integer"}`, value: `3.5`, expectedErrors: []string{": invalid type (number), expected integer"}},
+		{name: "integer for a number", schema: `{"type": "number"}`, value: `3`, expectedErrors: []string{}},
+		{name: "wrong type skips other keywords", schema: `{"type": "string", "minLength": 5}`, value: `1`, expectedErrors: []string{": invalid type (integer), expected string"}},
+		{name: "enum", schema: `{"enum": ["a", "b"]}`, value: `"b"`, expectedErrors: []string{}},
+		{name: "value not in enum", schema: `{"enum": ["a", "b"]}`, value: `"c"`, expectedErrors: []string{`: invalid value ("c"), must be one of: "a", "b"`}},
+		{name: "number in enum", schema: `{"enum": [1, 2]}`, value: `2`, expectedErrors: []string{}},
+		{name: "object with numbers in enum", schema: `{"enum": [{"a": [1, 2.5]}]}`, value: `{"a": [1, 2.5]}`, expectedErrors: []string{}},
+		{name: "object not in enum", schema: `{"enum": [{"a": [1, 2.5]}]}`, value: `{"a": [1, 2]}`, expectedErrors: []string{`: invalid value ({"a":[1,2]}), must be one of: {"a":[1,2.5]}`}},
+		{name: "const", schema: `{"const": 2}`, value: `2`, expectedErrors: []string{}},
+		{name: "wrong const", schema: `{"const": 2}`, value: `1`, expectedErrors: []string{": invalid value (1), must be 2"}},
+		{name: "array with numbers as const", schema: `{"const": [1, {"b": 2}]}`, value: `[1, {"b": 2}]`, expectedErrors: []string{}},
+		{
+			name:           "required",
+			schema:         `{"required": ["a", "b/c"]}`,
+			value:          `{"a": 1}`,
+			expectedErrors: []string{"/b~1c: missing required field: b/c"},
+		},
+		{
+			name:           "properties",
+			schema:         `{"properties": {"a": {"type": "string"}, "b": {"minimum": 1}}}`,
+			value:          `{"a": 1, "b": 0, "c": true}`,
+			expectedErrors: []string{"/a: invalid type (integer), expected string", "/b: invalid value (0), must be at least 1"},
+		},
+		{
+			name:           "no additional properties",
+			schema:         `{"properties": {"a": {}}, "additionalProperties": false}`,
+			value:          `{"a": 1, "c": 2, "b": 3}`,
+			expectedErrors: []string{"/b: unknown field: b", "/c: unknown field: c"},
+		},
+		{
+			name:           "additional properties schema",
+			schema:         `{"additionalProperties": {"type": "integer"}}`,
+			value:          `{"a": 1, "b": "2"}`,
+			expectedErrors: []string{"/b: invalid type (string), expected integer"},
+		},
+		{name: "items", schema: `{"items": {"minimum": 0}}`, value: `[0, -1, 2, -3]`, expectedErrors: []string{"/1: invalid value (-1), must be at least 0", "/3: invalid value (-3), must be at least 0"}},
+		{name: "empty array", schema: `{"minItems": 1}`, value: `[]`, expectedErrors: []string{": must not be empty"}},
+		{name: "too few items", schema: `{"minItems": 2}`, value: `[1]`, expectedErrors: []string{": must have at least 2 items"}},
+		{name: "empty string", schema: `{"minLength": 1}`, value: `""`, expectedErrors: []string{": must not be empty"}},
+		{name: "string length counts characters", schema: `{"minLength": 2}`, value: `"é"`, expectedErrors: []string{": must be at least 2 characters"}},
+		{name: "pattern", schema: `{"pattern": "^[0-9]+$"}`, value: `"12"`, expectedErrors: []string{}},
+		{name: "pattern mismatch", schema: `{"pattern": "^[0-9]+$"}`, value: `"1a"`, expectedErrors: []string{`: invalid value ("1a"), must match pattern: ^[0-9]+$`}},
+		{name: "invalid pattern", schema: `{"pattern": "("}`, value: `"a"`, expectedErrors: []string{": invalid pattern in schema ((): error parsing regexp: missing closing ): `(`"}},
+		{name: "minimum and maximum", schema: `{"items": {"minimum": 1, "maximum": 2.5}}`, value: `[1, 2.5]`, expectedErrors: []string{}},
+		{name: "below minimum", schema: `{"minimum": 1.5}`, value: `1`, expectedErrors: []string{": invalid value (1), must be at least 1.5"}},
+		{name: "above maximum", schema: `{"maximum": 2}`, value: `2.5`, expectedErrors: []string{": invalid value (2.5), must be at most 2"}},
+		{
+			name:           "ref",
+			schema:         `{"properties": {"a": {"$ref": "#/definitions/a~1b"}}, "definitions": {"a/b": {"type": "string"}}}`,
+			value:          `{"a": 1}`,
+			expectedErrors: []string{"/a: invalid type (integer), expected string"},
+		},
+		{name: "missing ref", schema: `{"$ref": "#/definitions/missing"}`, value: `1`, expectedErrors: []string{": invalid schema reference: #/definitions/missing"}},
+		{name: "external ref", schema: `{"$ref": "other.json"}`, value: `1`, expectedErrors: []string{": unsupported schema reference: other.json"}},
+		{
+			name:           "all of",
+			schema:         `{"allOf": [{"minimum": 1}, {"maximum": 0}]}`,
+			value:          `2`,
+			expectedErrors: []string{": invalid value (2), must be at most 0"},
+		},
+		{name: "any of", schema: `{"anyOf": [{"type": "string"}, {"minimum": 1}]}`, value: `2`, expectedErrors: []string{}},
+		{name: "none of any of", schema: `{"anyOf": [{"type": "string"}, {"minimum": 1}]}`, value: `0`, expectedErrors: []string{": doesn't match any of the allowed forms"}},
+		{name: "one of", schema: `{"oneOf": [{"type": "string"}, {"type": "array"}]}`, value: `[]`, expectedErrors: []string{}},
+		{name: "none of one of", schema: `{"oneOf": [{"type": "string"}, {"type": "array"}]}`, value: `1`, expectedErrors: []string{": must match exactly one of the allowed forms, but matches 0"}},
+		{name: "two of one of", schema: `{"oneOf": [{"type": "number"}, {"minimum": 1}]}`, value: `2`, expectedErrors: []string{": must match exactly one of the allowed forms, but matches 2"}},
+		{name: "not", schema: `{"not": {"required": ["a"]}}`, value: `{"b": 1}`, expectedErrors: []string{}},
+		{name: "matches not", schema: `{"not": {"required": ["a"]}}`, value: `{"a": 1}`, expectedErrors: []string{": matches a form that isn't allowed"}},
+		{
+			name:           "if then",
+			schema:         `{"if": {"properties": {"kind": {"const": "url"}}}, "then": {"required": ["url"]}, "else": {"required": ["path"]}}`,
+			value:          `{"kind": "url"}`,
+			expectedErrors: []string{"/url: missing required field: url"},
+		},
+		{
+			name:           "if else",
+			schema:         `{"if": {"properties": {"kind": {"const": "url"}}}, "then": {"required": ["url"]}, "else": {"required": ["path"]}}`,
+			value:          `{"kind": "file"}`,
+			expectedErrors: []string{"/path: missing required field: path"},
+		},
+		{name: "unknown keyword", schema: `{"format": "date"}`, value: `"x"`, expectedErrors: []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var schema map[string]any
+			err := json.Unmarshal([]byte(test.schema), &schema)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			value, err := decodeConfigDocument([]byte(test.value))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			schemaErrors := make([]string, 0)
+			validateJsonSchema(schema, value, func(pointer string, message string) {
+				schemaErrors = append(schemaErrors, pointer+": "+message)
+			})
+
+			if !reflect.DeepEqual(schemaErrors, test.expectedErrors) {
+				t.Errorf("got errors %q, expected %q", schemaErrors, test.expectedErrors)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Attribute keys used in log records from both the library and the CLI
+const (
+	LogKeyDiscTitle   = "disc_title"
+	LogKeyAlbumNumber = "album_number"
+	LogKeyDiscNumber  = "disc_number"
+	LogKeyTrackNumber = "track_number"
+	LogKeyStage       = "stage"
+	LogKeyTool        = "tool"
+	LogKeyCommand     = "command"
+	LogKeyExitStatus  = "exit_status"
+	LogKeyDuration    = "duration_s"
+	LogKeyError       = "error"
+)
+
+type loggerContextKey struct{}
+
+// WithLogger attaches a logger to the context passed to library functions.  The library
+// doesn't log anything unless one is attached.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+func GetLogger(ctx context.Context) *slog.Logger {
+	logger, ok := ctx.Value(loggerContextKey{}).(*slog.Logger)
+	if !ok || logger == nil {
+		return slog.New(discardHandler{})
+	}
+
+	return logger
+}
+
+// WithLogAttrs returns a context whose logger adds the given attributes to every record.
+func WithLogAttrs(ctx context.Context, args ...any) context.Context {
+	return WithLogger(ctx, GetLogger(ctx).With(args...))
+}
+
+// WithTrackLogAttrs adds a track's numbers to log records.
+func WithTrackLogAttrs(ctx context.Context, albumNumber int, discNumber int, trackNumber int) context.Context {
+	return WithLogAttrs(ctx, LogKeyAlbumNumber, albumNumber, LogKeyDiscNumber, discNumber, LogKeyTrackNumber, trackNumber)
+}
+
+// NewLogger creates a logger writing to writer in the given format (text or json).
+func NewLogger(writer io.Writer, level slog.Level, format string) (*slog.Logger, error) {
+	handlerOptions := &slog.HandlerOptions{Level: level}
+
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(writer, handlerOptions)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(writer, handlerOptions)), nil
+	}
+
+	return nil, errors.New("unsupported log format: " + format)
+}
+
+func ParseLogLevel(levelName string) (slog.Level, error) {
+	switch strings.ToLower(levelName) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+
+	return slog.LevelInfo, errors.New("unsupported log level: " + levelName)
+}
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool {
+	return false
+}
+
+func (discardHandler) Handle(context.Context, slog.Record) error {
+	return nil
+}
+
+func (handler discardHandler) WithAttrs([]slog.Attr) slog.Handler {
+	return handler
+}
+
+func (handler discardHandler) WithGroup(string) slog.Handler {
+	return handler
+}
@@ -0,0 +1,348 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// makemkvcon message box flags, from MakeMKV's apdefs.h
+const (
+	makemkvconMessageBoxMask       = 3852
+	makemkvconMessageBoxError      = 516
+	makemkvconMessageBoxYesNoError = 1288
+)
+
+// makemkvcon message codes with a known meaning
+const (
+	MakemkvconMessageCodeReadError = 2003
+)
+
+// Drive states in makemkvcon's DRV lines, from MakeMKV's apdefs.h
+const (
+	MakemkvconDriveStateEmptyClosed = 0
+	MakemkvconDriveStateEmptyOpen   = 1
+	MakemkvconDriveStateInserted    = 2
+	MakemkvconDriveStateLoading     = 3
+	MakemkvconDriveStateNoDrive     = 256
+	MakemkvconDriveStateUnmounting  = 257
+)
+
+var (
+	ErrMakemkvconReadError  = errors.New("disc read error")
+	ErrMakemkvconMissingKey = errors.New("missing disc decryption key")
+)
+
+// MakemkvconEvent is one line of makemkvcon's robot mode (-r) output that the library
+// understands: a MakemkvconProgress, a MakemkvconOperation, or a MakemkvconMessage.  These are
+// also sent to observers while makemkvcon runs.
+type MakemkvconEvent interface {
+	Event
+	makemkvconEvent()
+}
+
+// MakemkvconProgress is a PRGV line.  Current and Total count up to Max, for the current
+// operation and the whole command respectively.  The operation names come from the most
+// recent PRGC and PRGT lines.
+type MakemkvconProgress struct {
+	Current          int
+	Total            int
+	Max              int
+	CurrentOperation string
+	TotalOperation   string
+}
+
+// MakemkvconOperation is a PRGC line, or a PRGT line if IsTotal is set.
+type MakemkvconOperation struct {
+	IsTotal bool
+	Code    int
+	Id      int
+	Name    string
+}
+
+// MakemkvconMessage is an MSG line.
+type MakemkvconMessage struct {
+	Code    int
+	Flags   int
+	Message string
+	Format  string
+	Params  []string
+}
+
+func (MakemkvconProgress) event()            {}
+func (MakemkvconOperation) event()           {}
+func (MakemkvconMessage) event()             {}
+func (MakemkvconProgress) makemkvconEvent()  {}
+func (MakemkvconOperation) makemkvconEvent() {}
+func (MakemkvconMessage) makemkvconEvent()   {}
+
+func (progress MakemkvconProgress) CurrentFraction() float64 {
+	if progress.Max <= 0 {
+		return 0
+	}
+
+	return float64(progress.Current) / float64(progress.Max)
+}
+
+func (progress MakemkvconProgress) TotalFraction() float64 {
+	if progress.Max <= 0 {
+		return 0
+	}
+
+	return float64(progress.Total) / float64(progress.Max)
+}
+
+// MakemkvconMessageError is returned when makemkvcon fails after reporting an error message.
+// It matches ErrMakemkvconReadError or ErrMakemkvconMissingKey with errors.Is when the message
+// is one of those, and Err is the *ToolError for the failed command, if any.
+type MakemkvconMessageError struct {
+	Code    int
+	Message string
+	Kind    error
+	Err     error
+}
+
+func (messageError *MakemkvconMessageError) Error() string {
+	return "makemkvcon error " + strconv.Itoa(messageError.Code) + ": " + messageError.Message
+}
+
+func (messageError *MakemkvconMessageError) Unwrap() []error {
+	unwrappedErrors := make([]error, 0)
+
+	if messageError.Kind != nil {
+		unwrappedErrors = append(unwrappedErrors, messageError.Kind)
+	}
+
+	if messageError.Err != nil {
+		unwrappedErrors = append(unwrappedErrors, messageError.Err)
+	}
+
+	return unwrappedErrors
+}
+
+// ParseMakemkvconRobotLine parses a PRGV, PRGC, PRGT, or MSG line.  Other lines return a nil
+// event and no error.
+func ParseMakemkvconRobotLine(line string) (MakemkvconEvent, error) {
+	lineType, lineFields, isRobotLine := strings.Cut(line, ":")
+	if !isRobotLine {
+		return nil, nil
+	}
+
+	switch lineType {
+	case "PRGV", "PRGC", "PRGT", "MSG":
+	default:
+		return nil, nil
+	}
+
+	csvReader := csv.NewReader(strings.NewReader(lineFields))
+	csvReader.LazyQuotes = true
+	csvFields, err := csvReader.Read()
+	if err != nil {
+		return nil, errors.New("invalid makemkvcon line: " + line)
+	}
+
+	minimumFieldCount := 3
+	if lineType == "MSG" {
+		minimumFieldCount = 5
+	}
+
+	if len(csvFields) < minimumFieldCount {
+		return nil, errors.New("invalid makemkvcon line: " + line)
+	}
+
+	firstNumber, errFirst := strconv.Atoi(csvFields[0])
+	secondNumber, errSecond := strconv.Atoi(csvFields[1])
+	if errFirst != nil || errSecond != nil {
+		return nil, errors.New("invalid makemkvcon line: " + line)
+	}
+
+	switch lineType {
+	case "PRGV":
+		maxNumber, err := strconv.Atoi(csvFields[2])
+		if err != nil {
+			return nil, errors.New("invalid makemkvcon line: " + line)
+		}
+
+		return MakemkvconProgress{Current: firstNumber, Total: secondNumber, Max: maxNumber}, nil
+	case "PRGC", "PRGT":
+		return MakemkvconOperation{IsTotal: lineType == "PRGT", Code: firstNumber, Id: secondNumber, Name: csvFields[2]}, nil
+	}
+
+	return MakemkvconMessage{Code: firstNumber, Flags: secondNumber, Message: csvFields[3], Format: csvFields[4], Params: csvFields[5:]}, nil
+}
+
+// GetMakemkvconMessageError returns an error for messages that report a problem with the disc,
+// or nil for informational ones.
+func GetMakemkvconMessageError(message MakemkvconMessage) *MakemkvconMessageError {
+	messageError := &MakemkvconMessageError{Code: message.Code, Message: message.Message}
+
+	// makemkvcon doesn't use a single code for missing keys, so those are matched by their text
+	lowerMessage := strings.ToLower(message.Message)
+	isKeyMessage := strings.Contains(lowerMessage, "key") && (strings.Contains(lowerMessage, "aacs") || strings.Contains(lowerMessage, "bd+") || strings.Contains(lowerMessage, "decrypt"))
+
+	switch {
+	case message.Code == MakemkvconMessageCodeReadError:
+		messageError.Kind = ErrMakemkvconReadError
+	case isKeyMessage:
+		messageError.Kind = ErrMakemkvconMissingKey
+	}
+
+	messageBox := message.Flags & makemkvconMessageBoxMask
+	if messageError.Kind == nil && messageBox != makemkvconMessageBoxError && messageBox != makemkvconMessageBoxYesNoError {
+		return nil
+	}
+
+	return messageError
+}
+
+// runMakemkvcon runs makemkvcon in robot mode, passing its events to observers and logging its
+// messages.  The error message it reported is returned even if it succeeded, and is
+// returned as the error (wrapping the *ToolError) if it failed.  A read error or missing key is
+// preferred over the summary makemkvcon prints when it gives up.
+func runMakemkvcon(ctx context.Context, stage string, args ...string) (*MakemkvconMessageError, error) {
+	logger := GetLogger(ctx).With(LogKeyTool, "makemkvcon")
+
+	var reportedMessageError *MakemkvconMessageError
+	currentOperation := ""
+	totalOperation := ""
+
+	err := runToolWithOutputLines(ctx, "makemkvcon", func(line string) {
+		event, err := ParseMakemkvconRobotLine(line)
+		if err != nil {
+			logger.Debug("Ignoring makemkvcon output", LogKeyError, err.Error())
+			return
+		}
+
+		switch typedEvent := event.(type) {
+		case nil:
+			return
+		case MakemkvconOperation:
+			if typedEvent.IsTotal {
+				totalOperation = typedEvent.Name
+			} else {
+				currentOperation = typedEvent.Name
+			}
+		case MakemkvconProgress:
+			typedEvent.CurrentOperation = currentOperation
+			typedEvent.TotalOperation = totalOperation
+			event = typedEvent
+		case MakemkvconMessage:
+			messageError := GetMakemkvconMessageError(typedEvent)
+			if messageError != nil && (reportedMessageError == nil || reportedMessageError.Kind == nil || messageError.Kind != nil) {
+				reportedMessageError = messageError
+			}
+
+			if messageError != nil {
+				logger.Debug("makemkvcon reported an error", "code", typedEvent.Code, "message", typedEvent.Message)
+				notifyObservers(ctx, WarningEvent{Stage: stage, Message: "makemkvcon error " + strconv.Itoa(typedEvent.Code) + ": " + typedEvent.Message})
+			} else {
+				logger.Debug("makemkvcon message", "code", typedEvent.Code, "message", typedEvent.Message)
+			}
+		}
+
+		notifyObservers(ctx, event)
+	}, args...)
+
+	if err != nil && reportedMessageError != nil {
+		failedMessageError := *reportedMessageError
+		failedMessageError.Err = err
+		return reportedMessageError, &failedMessageError
+	}
+
+	return reportedMessageError, err
+}
+
+// MakemkvconDrive is a DRV line from makemkvcon -r info.  Index is the ID used in disc:<id>.
+type MakemkvconDrive struct {
+	Index      int
+	State      int
+	Flags      int
+	DriveName  string
+	DiscName   string
+	DevicePath string
+}
+
+func (drive MakemkvconDrive) HasDisc() bool {
+	return drive.State == MakemkvconDriveStateInserted
+}
+
+func ParseMakemkvconDriveLine(line string) (*MakemkvconDrive, error) {
+	if !strings.HasPrefix(line, "DRV:") {
+		return nil, errors.New("not a makemkvcon drive line: " + line)
+	}
+
+	csvReader := csv.NewReader(strings.NewReader(strings.TrimPrefix(line, "DRV:")))
+	csvReader.LazyQuotes = true
+	csvFields, err := csvReader.Read()
+	if err != nil || len(csvFields) < 7 {
+		return nil, errors.New("invalid makemkvcon drive line: " + line)
+	}
+
+	driveIndex, errIndex := strconv.Atoi(csvFields[0])
+	driveState, errState := strconv.Atoi(csvFields[1])
+	driveFlags, errFlags := strconv.Atoi(csvFields[3])
+	if errIndex != nil || errState != nil || errFlags != nil {
+		return nil, errors.New("invalid makemkvcon drive line: " + line)
+	}
+
+	return &MakemkvconDrive{
+		Index:      driveIndex,
+		State:      driveState,
+		Flags:      driveFlags,
+		DriveName:  csvFields[4],
+		DiscName:   csvFields[5],
+		DevicePath: csvFields[6],
+	}, nil
+}
+
+// GetMakemkvconDrives lists the drives makemkvcon knows about, leaving out the placeholder
+// entries it prints for drive slots that aren't in use.
+func GetMakemkvconDrives(ctx context.Context) ([]MakemkvconDrive, error) {
+	makemkvconInfoLines, err := GetMakemkvconInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	drives := make([]MakemkvconDrive, 0)
+
+	for _, line := range makemkvconInfoLines {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "DRV:") {
+			continue
+		}
+
+		drive, err := ParseMakemkvconDriveLine(line)
+		if err != nil {
+			return nil, err
+		}
+
+		if drive.State == MakemkvconDriveStateNoDrive {
+			continue
+		}
+
+		drives = append(drives, *drive)
+	}
+
+	return drives, nil
+}
@@ -0,0 +1,221 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	RipStageNone       = ""
+	RipStageExtracted  = "extracted"
+	RipStageCompressed = "compressed"
+	RipStageTagged     = "tagged"
+)
+
+const RipManifestFileName = "bdaudiodump_manifest.json"
+
+type RipManifest struct {
+	DiscVolumeKeySha1     string             `json:"disc_volume_key_sha1"`
+	BluRayTitle           string             `json:"bluray_title"`
+	MkvBasePath           string             `json:"mkv_base_path,omitempty"`
+	MkvExtractionComplete bool               `json:"mkv_extraction_complete"`
+	Tracks                []RipManifestTrack `json:"tracks"`
+	manifestPath          string
+	manifestMutex         sync.Mutex
+}
+
+type RipManifestTrack struct {
+	AlbumNumber int    `json:"album_number"`
+	DiscNumber  int    `json:"disc_number"`
+	TrackNumber int    `json:"track_number"`
+	Stage       string `json:"stage"`
+}
+
+func GetRipManifestPath(basePath string, discConfig BluRayDiscConfig, replaceSpaceWithUnderscore bool) string {
+	return strings.TrimRight(basePath, string(os.PathSeparator)) + string(os.PathSeparator) + SanitizePathSegment(discConfig.BluRayTitle, replaceSpaceWithUnderscore) + string(os.PathSeparator) + RipManifestFileName
+}
+
+func NewRipManifest(manifestPath string, discConfig BluRayDiscConfig) *RipManifest {
+	ripManifest := &RipManifest{
+		DiscVolumeKeySha1: discConfig.DiscVolumeKeySha1,
+		BluRayTitle:       discConfig.BluRayTitle,
+		Tracks:            make([]RipManifestTrack, 0),
+		manifestPath:      manifestPath,
+	}
+
+	for _, album := range discConfig.Albums {
+		for _, disc := range album.Discs {
+			for _, track := range disc.Tracks {
+				ripManifest.Tracks = append(ripManifest.Tracks, RipManifestTrack{
+					AlbumNumber: album.AlbumNumber,
+					DiscNumber:  disc.DiscNumber,
+					TrackNumber: track.TrackNumber,
+					Stage:       RipStageNone,
+				})
+			}
+		}
+	}
+
+	return ripManifest
+}
+
+func ReadRipManifest(manifestPath string, discConfig BluRayDiscConfig) (*RipManifest, error) {
+	manifestData, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	ripManifest := &RipManifest{}
+	err = json.Unmarshal(manifestData, ripManifest)
+	if err != nil {
+		return nil, err
+	}
+
+	if ripManifest.DiscVolumeKeySha1 != discConfig.DiscVolumeKeySha1 {
+		return nil, errors.New("job manifest at " + manifestPath + " was written for a different disc: " + ripManifest.BluRayTitle)
+	}
+
+	ripManifest.manifestPath = manifestPath
+
+	// Pick up any tracks added to the config since the manifest was written
+	newManifest := NewRipManifest(manifestPath, discConfig)
+	for i, newTrack := range newManifest.Tracks {
+		newManifest.Tracks[i].Stage = ripManifest.GetTrackStage(newTrack.AlbumNumber, newTrack.DiscNumber, newTrack.TrackNumber)
+	}
+	ripManifest.Tracks = newManifest.Tracks
+
+	return ripManifest, nil
+}
+
+func (ripManifest *RipManifest) Save() error {
+	ripManifest.manifestMutex.Lock()
+	defer ripManifest.manifestMutex.Unlock()
+
+	return ripManifest.save()
+}
+
+func (ripManifest *RipManifest) save() error {
+	err := os.MkdirAll(path.Dir(ripManifest.manifestPath), 0755)
+	if err != nil {
+		return err
+	}
+
+	manifestData, err := json.MarshalIndent(ripManifest, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so an interrupted run never leaves a truncated manifest
+	tempManifestPath := ripManifest.manifestPath + ".tmp"
+	err = os.WriteFile(tempManifestPath, manifestData, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tempManifestPath, ripManifest.manifestPath)
+}
+
+func (ripManifest *RipManifest) GetTrackStage(albumNumber int, discNumber int, trackNumber int) string {
+	ripManifest.manifestMutex.Lock()
+	defer ripManifest.manifestMutex.Unlock()
+
+	for _, track := range ripManifest.Tracks {
+		if track.AlbumNumber == albumNumber && track.DiscNumber == discNumber && track.TrackNumber == trackNumber {
+			return track.Stage
+		}
+	}
+
+	return RipStageNone
+}
+
+func (ripManifest *RipManifest) SetTrackStage(albumNumber int, discNumber int, trackNumber int, stage string) error {
+	ripManifest.manifestMutex.Lock()
+	defer ripManifest.manifestMutex.Unlock()
+
+	for i := range ripManifest.Tracks {
+		if ripManifest.Tracks[i].AlbumNumber == albumNumber && ripManifest.Tracks[i].DiscNumber == discNumber && ripManifest.Tracks[i].TrackNumber == trackNumber {
+			ripManifest.Tracks[i].Stage = stage
+			return ripManifest.save()
+		}
+	}
+
+	return errors.New("no job manifest entry for album number " + strconv.Itoa(albumNumber) + " and disc number " + strconv.Itoa(discNumber) + " and track number " + strconv.Itoa(trackNumber))
+}
+
+func (ripManifest *RipManifest) SetMkvBasePath(mkvBasePath string, extractionComplete bool) error {
+	ripManifest.manifestMutex.Lock()
+	defer ripManifest.manifestMutex.Unlock()
+
+	ripManifest.MkvBasePath = mkvBasePath
+	ripManifest.MkvExtractionComplete = extractionComplete
+	return ripManifest.save()
+}
+
+func RipStageReached(currentStage string, requiredStage string) bool {
+	return getRipStageOrder(currentStage) >= getRipStageOrder(requiredStage)
+}
+
+func getRipStageOrder(stage string) int {
+	switch stage {
+	case RipStageExtracted:
+		return 1
+	case RipStageCompressed:
+		return 2
+	case RipStageTagged:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// AllMkvFilesExist checks for the MKV file of every selected track.
+func AllMkvFilesExist(mkvBasePath string, discConfig BluRayDiscConfig, trackSelection TrackSelection) bool {
+	if mkvBasePath == "" {
+		return false
+	}
+
+	for _, album := range discConfig.Albums {
+		for _, disc := range album.Discs {
+			for _, track := range disc.Tracks {
+				if !trackSelection.Includes(album.AlbumNumber, disc.DiscNumber, track.TrackNumber) {
+					continue
+				}
+
+				mkvPath, err := GetMkvPathByTrackNumber(mkvBasePath, album.AlbumNumber, disc.DiscNumber, track.TrackNumber, discConfig)
+				if err != nil {
+					return false
+				}
+
+				if _, err := os.Stat(mkvPath); err != nil {
+					return false
+				}
+			}
+		}
+	}
+
+	return true
+}
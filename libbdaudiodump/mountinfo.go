@@ -0,0 +1,178 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const ProcMountinfoPath = "/proc/self/mountinfo"
+
+// MountinfoEntry is one line of /proc/self/mountinfo, with octal escapes already decoded.
+// See proc(5) for the meaning of each field.
+type MountinfoEntry struct {
+	MountId        int
+	ParentId       int
+	MajorMinor     string
+	Root           string
+	MountPoint     string
+	MountOptions   string
+	OptionalFields []string
+	FilesystemType string
+	Source         string
+	SuperOptions   string
+}
+
+// ParseMountinfo parses the contents of a mountinfo file, such as /proc/self/mountinfo.
+func ParseMountinfo(mountinfo string) ([]MountinfoEntry, error) {
+	mountinfoEntries := make([]MountinfoEntry, 0)
+
+	for _, line := range strings.Split(mountinfo, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		mountinfoEntry, err := ParseMountinfoLine(line)
+		if err != nil {
+			return nil, err
+		}
+
+		mountinfoEntries = append(mountinfoEntries, *mountinfoEntry)
+	}
+
+	return mountinfoEntries, nil
+}
+
+func ParseMountinfoLine(line string) (*MountinfoEntry, error) {
+	fields := strings.Fields(line)
+
+	// The optional fields are ended by a lone hyphen, which is followed by the last three fields
+	separatorIndex := -1
+	for i := 6; i < len(fields); i++ {
+		if fields[i] == "-" {
+			separatorIndex = i
+			break
+		}
+	}
+
+	if len(fields) < 10 || separatorIndex == -1 || len(fields) < separatorIndex+3 {
+		return nil, errors.New("invalid mountinfo line: " + line)
+	}
+
+	mountId, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return nil, errors.New("invalid mount ID in mountinfo line: " + line)
+	}
+
+	parentId, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, errors.New("invalid parent ID in mountinfo line: " + line)
+	}
+
+	mountinfoEntry := &MountinfoEntry{
+		MountId:        mountId,
+		ParentId:       parentId,
+		MajorMinor:     fields[2],
+		Root:           DecodeMountinfoEscapes(fields[3]),
+		MountPoint:     DecodeMountinfoEscapes(fields[4]),
+		MountOptions:   fields[5],
+		OptionalFields: fields[6:separatorIndex],
+		FilesystemType: DecodeMountinfoEscapes(fields[separatorIndex+1]),
+		Source:         DecodeMountinfoEscapes(fields[separatorIndex+2]),
+	}
+
+	if len(fields) > separatorIndex+3 {
+		mountinfoEntry.SuperOptions = fields[separatorIndex+3]
+	}
+
+	return mountinfoEntry, nil
+}
+
+// DecodeMountinfoEscapes decodes the three-digit octal escapes the kernel uses for spaces, tabs,
+// newlines, and backslashes in mountinfo fields, such as \040 for a space.
+func DecodeMountinfoEscapes(field string) string {
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+
+	var decodedField strings.Builder
+
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+4 <= len(field) {
+			octalValue, err := strconv.ParseUint(field[i+1:i+4], 8, 8)
+			if err == nil {
+				decodedField.WriteByte(byte(octalValue))
+				i += 3
+				continue
+			}
+		}
+
+		decodedField.WriteByte(field[i])
+	}
+
+	return decodedField.String()
+}
+
+// GetMountPointFromMountinfo finds where a device is mounted in the contents of a mountinfo file.
+// Symlinked device nodes, such as /dev/cdrom, are resolved before they're compared.
+func GetMountPointFromMountinfo(mountinfo string, devicePath string) (string, error) {
+	mountinfoEntries, err := ParseMountinfo(mountinfo)
+	if err != nil {
+		return "", err
+	}
+
+	resolvedDevicePath := resolveDevicePath(devicePath)
+
+	for _, mountinfoEntry := range mountinfoEntries {
+		if mountinfoEntry.Source == devicePath || resolveDevicePath(mountinfoEntry.Source) == resolvedDevicePath {
+			return mountinfoEntry.MountPoint, nil
+		}
+	}
+
+	return "", errors.New("unable to find mount point for device: " + devicePath)
+}
+
+func GetMountPointFromProcMountinfo(devicePath string) (string, error) {
+	mountinfo, err := os.ReadFile(ProcMountinfoPath)
+	if err != nil {
+		return "", err
+	}
+
+	return GetMountPointFromMountinfo(string(mountinfo), devicePath)
+}
+
+// resolveDevicePath follows symlinks in a device path, and returns it unchanged if it can't be
+// resolved, such as when it isn't a path at all.
+func resolveDevicePath(devicePath string) string {
+	if !strings.HasPrefix(devicePath, "/") {
+		return devicePath
+	}
+
+	resolvedDevicePath, err := filepath.EvalSymlinks(devicePath)
+	if err != nil {
+		return filepath.Clean(devicePath)
+	}
+
+	return resolvedDevicePath
+}
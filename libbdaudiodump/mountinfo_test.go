@@ -0,0 +1,183 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readTestMountinfo(t *testing.T, name string) string {
+	mountinfo, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(mountinfo)
+}
+
+func TestParseMountinfo(t *testing.T) {
+	mountinfoEntries, err := ParseMountinfo(readTestMountinfo(t, "mountinfo_desktop"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(mountinfoEntries) != 8 {
+		t.Fatalf("expected 8 entries, got %d", len(mountinfoEntries))
+	}
+
+	tests := []struct {
+		name          string
+		entryIndex    int
+		expectedEntry MountinfoEntry
+	}{
+		{
+			name:       "escaped space and several optional fields",
+			entryIndex: 6,
+			expectedEntry: MountinfoEntry{
+				MountId:        640,
+				ParentId:       28,
+				MajorMinor:     "11:0",
+				Root:           "/",
+				MountPoint:     "/media/user/MY DISC",
+				MountOptions:   "ro,nosuid,nodev,relatime",
+				OptionalFields: []string{"shared:512", "master:1"},
+				FilesystemType: "udf",
+				Source:         "/dev/sr0",
+				SuperOptions:   "ro,uid=1000,gid=1000,iocharset=utf8",
+			},
+		},
+		{
+			name:       "no optional fields",
+			entryIndex: 7,
+			expectedEntry: MountinfoEntry{
+				MountId:        652,
+				ParentId:       28,
+				MajorMinor:     "11:1",
+				Root:           "/",
+				MountPoint:     "/mnt/bluray",
+				MountOptions:   "ro,relatime",
+				OptionalFields: []string{},
+				FilesystemType: "udf",
+				Source:         "/dev/sr1",
+				SuperOptions:   "ro,iocharset=utf8",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if !reflect.DeepEqual(mountinfoEntries[test.entryIndex], test.expectedEntry) {
+				t.Errorf("got %+v, expected %+v", mountinfoEntries[test.entryIndex], test.expectedEntry)
+			}
+		})
+	}
+}
+
+func TestParseMountinfoLineErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{name: "no separator", line: "640 28 11:0 / /mnt/bluray ro,relatime shared:512 udf /dev/sr0 ro"},
+		{name: "missing source", line: "640 28 11:0 / /mnt/bluray ro,relatime - udf"},
+		{name: "invalid mount ID", line: "abc 28 11:0 / /mnt/bluray ro,relatime - udf /dev/sr0 ro"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseMountinfoLine(test.line)
+			if err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestDecodeMountinfoEscapes(t *testing.T) {
+	tests := map[string]string{
+		`/media/user/MY\040DISC`:  "/media/user/MY DISC",
+		`/mnt/tab\011and\134back`: "/mnt/tab\tand\\back",
+		`/mnt/trailing\04`:        `/mnt/trailing\04`,
+		`/mnt/not\999octal`:       `/mnt/not\999octal`,
+	}
+
+	for field, expected := range tests {
+		decodedField := DecodeMountinfoEscapes(field)
+		if decodedField != expected {
+			t.Errorf("%s: got %q, expected %q", field, decodedField, expected)
+		}
+	}
+}
+
+func TestGetMountPointFromMountinfo(t *testing.T) {
+	// The symlink fixture refers to a device in a temporary directory, since the device a symlink
+	// points to has to exist for it to be resolved
+	deviceDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(deviceDir, "sr0"), nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Symlink(filepath.Join(deviceDir, "sr0"), filepath.Join(deviceDir, "cdrom"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	symlinkMountinfo := strings.ReplaceAll(readTestMountinfo(t, "mountinfo_cdrom_symlink"), "DEVICE_DIR", deviceDir)
+
+	tests := []struct {
+		name               string
+		mountinfo          string
+		devicePath         string
+		expectedMountPoint string
+		expectError        bool
+	}{
+		{name: "mount point with a space", mountinfo: readTestMountinfo(t, "mountinfo_desktop"), devicePath: "/dev/sr0", expectedMountPoint: "/media/user/MY DISC"},
+		{name: "mount without optional fields", mountinfo: readTestMountinfo(t, "mountinfo_desktop"), devicePath: "/dev/sr1", expectedMountPoint: "/mnt/bluray"},
+		{name: "device through a symlink", mountinfo: symlinkMountinfo, devicePath: filepath.Join(deviceDir, "cdrom"), expectedMountPoint: "/media/user/MY DISC"},
+		{name: "device itself", mountinfo: symlinkMountinfo, devicePath: filepath.Join(deviceDir, "sr0"), expectedMountPoint: "/media/user/MY DISC"},
+		{name: "device that isn't mounted", mountinfo: readTestMountinfo(t, "mountinfo_desktop"), devicePath: "/dev/sr2", expectError: true},
+		{name: "invalid mountinfo", mountinfo: "640 28 11:0 / /mnt/bluray", devicePath: "/dev/sr0", expectError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mountPoint, err := GetMountPointFromMountinfo(test.mountinfo, test.devicePath)
+			if test.expectError {
+				if err == nil {
+					t.Errorf("expected an error, got %s", mountPoint)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if mountPoint != test.expectedMountPoint {
+				t.Errorf("got %s, expected %s", mountPoint, test.expectedMountPoint)
+			}
+		})
+	}
+}
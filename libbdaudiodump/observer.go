@@ -0,0 +1,115 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"context"
+	"time"
+)
+
+// Event is something the library reports to observers while it works: one of the *Event types
+// below, or a MakemkvconProgress, MakemkvconOperation, or MakemkvconMessage.
+type Event interface {
+	event()
+}
+
+type DiscIdentifiedEvent struct {
+	DiscVolumeKeySha1 string
+	BluRayTitle       string
+	VariantName       string
+}
+
+// StageStartedEvent and StageFinishedEvent bracket each stage.  Track is only set for the
+// extract, compress, and tag stages, which work on one track at a time.
+type StageStartedEvent struct {
+	Stage string
+	Track TrackJob
+}
+
+type StageFinishedEvent struct {
+	Stage    string
+	Track    TrackJob
+	Duration time.Duration
+	Err      error
+}
+
+// TrackCompletedEvent is sent once a track's FLAC file has been tagged.  Duration is the
+// length of the audio, or zero if it couldn't be read from the file.
+type TrackCompletedEvent struct {
+	Track    TrackJob
+	FlacPath string
+	Duration time.Duration
+}
+
+// WarningEvent reports a problem that didn't stop the library from continuing.
+type WarningEvent struct {
+	Stage   string
+	Track   TrackJob
+	Message string
+}
+
+func (DiscIdentifiedEvent) event() {}
+func (StageStartedEvent) event()   {}
+func (StageFinishedEvent) event()  {}
+func (TrackCompletedEvent) event() {}
+func (WarningEvent) event()        {}
+
+// Observer receives events from library functions.  With more than one job, tracks are processed
+// concurrently, so HandleEvent must be safe to call from several goroutines.  It shouldn't block.
+type Observer interface {
+	HandleEvent(event Event)
+}
+
+type ObserverFunc func(event Event)
+
+func (observerFunc ObserverFunc) HandleEvent(event Event) {
+	observerFunc(event)
+}
+
+type observersContextKey struct{}
+
+// WithObserver returns a context that sends events to observer as well as any observers already
+// attached to ctx.
+func WithObserver(ctx context.Context, observer Observer) context.Context {
+	observers := append([]Observer{}, getObservers(ctx)...)
+	return context.WithValue(ctx, observersContextKey{}, append(observers, observer))
+}
+
+func getObservers(ctx context.Context) []Observer {
+	observers, _ := ctx.Value(observersContextKey{}).([]Observer)
+	return observers
+}
+
+func notifyObservers(ctx context.Context, event Event) {
+	for _, observer := range getObservers(ctx) {
+		observer.HandleEvent(event)
+	}
+}
+
+// observeStage sends a StageStartedEvent and returns a function to call with the stage's result
+// to send the matching StageFinishedEvent.
+func observeStage(ctx context.Context, stage string, trackJob TrackJob) func(err error) {
+	notifyObservers(ctx, StageStartedEvent{Stage: stage, Track: trackJob})
+	startTime := time.Now()
+
+	return func(err error) {
+		notifyObservers(ctx, StageFinishedEvent{Stage: stage, Track: trackJob, Duration: time.Since(startTime), Err: err})
+	}
+}
@@ -0,0 +1,224 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	StageBackup   = "backup"
+	StageMkv      = "mkv"
+	StageProbe    = "probe"
+	StageExtract  = "extract"
+	StageCompress = "compress"
+	StageTag      = "tag"
+)
+
+type PlannedCommand struct {
+	Stage   string   `json:"stage"`
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+}
+
+type PlannedChapter struct {
+	ChapterNumber int      `json:"chapter_number"`
+	IsChapter     bool     `json:"is_chapter"`
+	StartTime     *float64 `json:"start_time_s,omitempty"`
+	Duration      *float64 `json:"duration_s,omitempty"`
+}
+
+type TrackPlan struct {
+	AlbumNumber       int              `json:"album_number"`
+	DiscNumber        int              `json:"disc_number"`
+	TrackNumber       int              `json:"track_number"`
+	TrackTitle        string           `json:"track_title"`
+	TitleNumber       string           `json:"title_number"`
+	MkvPath           string           `json:"mkv_path"`
+	FlacPath          string           `json:"flac_path"`
+	AudioStreamNumber int              `json:"audio_stream_number"`
+	Chapters          []PlannedChapter `json:"chapters"`
+	Commands          []PlannedCommand `json:"commands"`
+	Warnings          []string         `json:"warnings,omitempty"`
+}
+
+type RipPlan struct {
+	BluRayTitle string           `json:"bluray_title"`
+	Commands    []PlannedCommand `json:"commands"`
+	Tracks      []TrackPlan      `json:"tracks"`
+}
+
+// GetMakemkvconPlan lists the makemkvcon commands for ripping the titles the selected tracks come
+// from.  Each title is ripped into its own directory under mkvBasePath and then renamed.
+func GetMakemkvconPlan(makemkvconSource string, copyDiscBeforeMkvExtraction bool, discCopyPath string, discConfig BluRayDiscConfig, trackSelection TrackSelection, mkvBasePath string) ([]PlannedCommand, error) {
+	plannedCommands := make([]PlannedCommand, 0)
+
+	if copyDiscBeforeMkvExtraction {
+		plannedCommands = append(plannedCommands, PlannedCommand{Stage: StageBackup, Command: "makemkvcon", Args: GetBackupDiscArgs(makemkvconSource, discCopyPath)})
+	}
+
+	for _, titleNumber := range GetSelectedTitleNumbers(discConfig, trackSelection) {
+		makemkvconTitleId, err := GetMakemkvconTitleId(titleNumber)
+		if err != nil {
+			return nil, err
+		}
+
+		// The real directory names are only known once they're created
+		titleDir := strings.TrimRight(mkvBasePath, string(os.PathSeparator)) + string(os.PathSeparator) + GetMkvTitleDirPattern(titleNumber) + "*"
+
+		if copyDiscBeforeMkvExtraction {
+			plannedCommands = append(plannedCommands, PlannedCommand{Stage: StageMkv, Command: "makemkvcon", Args: GetExtractMkvFromBackupArgs(discCopyPath, makemkvconTitleId, titleDir)})
+		} else {
+			plannedCommands = append(plannedCommands, PlannedCommand{Stage: StageMkv, Command: "makemkvcon", Args: GetExtractDiscToMkvArgs(makemkvconSource, makemkvconTitleId, titleDir)})
+		}
+	}
+
+	return plannedCommands, nil
+}
+
+// GetTrackPlan mirrors ExtractFlacFromMkv, CompressFlac, and TagFlac without running anything.
+// If ffProbeData has no entry for the track's title, chapter timings are left as placeholders.
+func GetTrackPlan(mkvBasePath string, flacBasePath string, albumNumber int, discNumber int, trackNumber int, ffProbeData map[string][]*FfprobeChapterInfo, discConfig BluRayDiscConfig, audioStreamType string, coverPath string, replaceSpaceWithUnderscore bool) (*TrackPlan, error) {
+	track, err := GetTrack(albumNumber, discNumber, trackNumber, discConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	flacPath, err := GetFlacPathByTrackNumber(flacBasePath, albumNumber, discNumber, trackNumber, discConfig, replaceSpaceWithUnderscore)
+	if err != nil {
+		return nil, err
+	}
+
+	mkvPath, err := GetMkvPathByTrackNumber(mkvBasePath, albumNumber, discNumber, trackNumber, discConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	trackPlan := &TrackPlan{
+		AlbumNumber:       albumNumber,
+		DiscNumber:        discNumber,
+		TrackNumber:       trackNumber,
+		TrackTitle:        track.TrackTitle,
+		TitleNumber:       track.TitleNumber,
+		MkvPath:           mkvPath,
+		FlacPath:          flacPath,
+		AudioStreamNumber: GetAudioStreamNumberFromStringForTrack(*track, audioStreamType),
+		Chapters:          make([]PlannedChapter, 0),
+		Commands:          make([]PlannedCommand, 0),
+		Warnings:          make([]string, 0),
+	}
+
+	_, hasProbeData := ffProbeData[track.TitleNumber]
+
+	extractOutputPaths := make([]string, 0)
+	for i := range track.ChapterNumbers {
+		if len(track.ChapterNumbers) == 1 {
+			extractOutputPaths = append(extractOutputPaths, flacPath)
+		} else {
+			extractOutputPaths = append(extractOutputPaths, GetFlacPiecePath(flacPath, trackNumber, i))
+		}
+	}
+
+	trackDurationKnown := hasProbeData
+	trackDuration := 0.0
+
+	if hasProbeData {
+		chapterInfos := GetChapterInfosForTrack(*track, ffProbeData)
+		if len(chapterInfos) != len(track.ChapterNumbers) {
+			trackPlan.Warnings = append(trackPlan.Warnings, "only "+strconv.Itoa(len(chapterInfos))+" of "+strconv.Itoa(len(track.ChapterNumbers))+" chapters were found in title "+track.TitleNumber)
+		}
+
+		for i, chapterInfo := range chapterInfos {
+			startTime := chapterInfo.ChapterStartTime
+			duration := chapterInfo.ChapterDuration
+			trackPlan.Chapters = append(trackPlan.Chapters, PlannedChapter{
+				ChapterNumber: chapterInfo.ChapterIndex,
+				IsChapter:     chapterInfo.IsChapter,
+				StartTime:     &startTime,
+				Duration:      &duration,
+			})
+			trackPlan.Commands = append(trackPlan.Commands, PlannedCommand{Stage: StageExtract, Command: "ffmpeg", Args: GetFfmpegExtractArgs(mkvPath, chapterInfo, trackPlan.AudioStreamNumber, extractOutputPaths[i])})
+		}
+
+		trackDuration = GetChapterInfosDuration(chapterInfos)
+	} else {
+		for i, chapterNumber := range track.ChapterNumbers {
+			trackPlan.Chapters = append(trackPlan.Chapters, PlannedChapter{
+				ChapterNumber: chapterNumber,
+				IsChapter:     true,
+			})
+			trackPlan.Commands = append(trackPlan.Commands, PlannedCommand{Stage: StageExtract, Command: "ffmpeg", Args: GetFfmpegExtractChapterArgs(mkvPath, "<chapter "+strconv.Itoa(chapterNumber)+" start>", "<chapter "+strconv.Itoa(chapterNumber)+" duration>", trackPlan.AudioStreamNumber, extractOutputPaths[i])})
+		}
+	}
+
+	if len(track.ChapterNumbers) > 1 {
+		trackPlan.Commands = append(trackPlan.Commands, PlannedCommand{Stage: StageExtract, Command: "ffmpeg", Args: GetFfmpegConcatArgs(GetFlacConcatListPath(flacPath, trackNumber), flacPath)})
+	}
+
+	if track.TrimStartS > 0.0000001 {
+		if trackDurationKnown && track.TrimStartS > trackDuration {
+			trackPlan.Warnings = append(trackPlan.Warnings, "trim duration longer than track duration")
+		}
+		trackPlan.Commands = append(trackPlan.Commands, PlannedCommand{Stage: StageExtract, Command: "ffmpeg", Args: GetFfmpegTrimStartArgs(flacPath, fmt.Sprintf("%.6f", track.TrimStartS), GetTrimmedFlacPath(flacPath))})
+		trackDuration = trackDuration - track.TrimStartS
+	}
+
+	if track.TrimEndS > 0.0000001 {
+		trimmedDuration := "<track duration - " + fmt.Sprintf("%.6f", track.TrimEndS) + ">"
+		if trackDurationKnown {
+			if track.TrimEndS > trackDuration {
+				trackPlan.Warnings = append(trackPlan.Warnings, "trim duration longer than track duration")
+			}
+			trimmedDuration = fmt.Sprintf("%.6f", trackDuration-track.TrimEndS)
+		}
+		trackPlan.Commands = append(trackPlan.Commands, PlannedCommand{Stage: StageExtract, Command: "ffmpeg", Args: GetFfmpegTrimEndArgs(flacPath, trimmedDuration, GetTrimmedFlacPath(flacPath))})
+	}
+
+	trackPlan.Commands = append(trackPlan.Commands, PlannedCommand{Stage: StageCompress, Command: "flac", Args: GetCompressFlacArgs(flacPath)})
+
+	metaflacArgs, err := GetTagFlacArgs(flacBasePath, albumNumber, discNumber, trackNumber, coverPath, discConfig, replaceSpaceWithUnderscore)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, args := range metaflacArgs {
+		trackPlan.Commands = append(trackPlan.Commands, PlannedCommand{Stage: StageTag, Command: "metaflac", Args: args})
+	}
+
+	return trackPlan, nil
+}
+
+// FormatCommandLine renders a command as it could be pasted into a POSIX shell.
+func FormatCommandLine(command string, args []string) string {
+	quotedArgs := []string{command}
+
+	for _, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\$`&|;<>()*?[]#~!{}") {
+			quotedArgs = append(quotedArgs, "'"+strings.ReplaceAll(arg, "'", `'\''`)+"'")
+		} else {
+			quotedArgs = append(quotedArgs, arg)
+		}
+	}
+
+	return strings.Join(quotedArgs, " ")
+}
@@ -0,0 +1,297 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TrackStatusNotStarted  = "not_started"
+	TrackStatusCompleted   = "completed"
+	TrackStatusSkipped     = "skipped"
+	TrackStatusFailed      = "failed"
+	TrackStatusNotSelected = "not_selected"
+)
+
+const RunReportFileName = "report.json"
+
+// How far a finished track's length can be from the length of its chapters after trims before
+// the report warns about it
+const trackDurationToleranceS = 1.0
+
+type RunReport struct {
+	DiscVolumeKeySha1 string        `json:"disc_volume_key_sha1"`
+	BluRayTitle       string        `json:"bluray_title"`
+	VariantName       string        `json:"variant_name,omitempty"`
+	CatalogNumber     string        `json:"catalog_number,omitempty"`
+	StartTime         time.Time     `json:"start_time"`
+	EndTime           time.Time     `json:"end_time"`
+	Succeeded         bool          `json:"succeeded"`
+	Albums            []AlbumReport `json:"albums"`
+	Tracks            []TrackReport `json:"tracks"`
+	Warnings          []string      `json:"warnings"`
+	reportPath        string
+	reportMutex       sync.Mutex
+
+	// Warnings from observer events for each track, added to the tracks when the report is
+	// finished, since track reports are replaced as each track is processed
+	trackWarnings map[TrackJob][]string
+}
+
+type AlbumReport struct {
+	AlbumNumber int             `json:"album_number"`
+	AlbumTitle  string          `json:"album_title"`
+	CoverArt    *CoverArtReport `json:"cover_art,omitempty"`
+}
+
+type CoverArtReport struct {
+	SourceType string `json:"source_type"`
+	SourcePath string `json:"source_path"`
+	EntryPath  string `json:"entry_path,omitempty"`
+	Path       string `json:"path"`
+}
+
+type TrackReport struct {
+	AlbumNumber       int              `json:"album_number"`
+	DiscNumber        int              `json:"disc_number"`
+	TrackNumber       int              `json:"track_number"`
+	TrackTitle        string           `json:"track_title"`
+	Status            string           `json:"status"`
+	Error             string           `json:"error,omitempty"`
+	FlacPath          string           `json:"flac_path"`
+	MkvPath           string           `json:"mkv_path"`
+	TitleNumber       string           `json:"title_number"`
+	Chapters          []PlannedChapter `json:"chapters"`
+	AudioStreamNumber int              `json:"audio_stream_number"`
+	AudioStreamReason string           `json:"audio_stream_reason"`
+	TrimStartS        float64          `json:"trim_start_s"`
+	TrimEndS          float64          `json:"trim_end_s"`
+	ExpectedDuration  *float64         `json:"expected_duration_s,omitempty"`
+	Duration          *float64         `json:"duration_s,omitempty"`
+	CoverArt          *CoverArtReport  `json:"cover_art,omitempty"`
+	Warnings          []string         `json:"warnings"`
+}
+
+func GetRunReportPath(basePath string, discConfig BluRayDiscConfig, replaceSpaceWithUnderscore bool) string {
+	return strings.TrimRight(basePath, string(os.PathSeparator)) + string(os.PathSeparator) + SanitizePathSegment(discConfig.BluRayTitle, replaceSpaceWithUnderscore) + string(os.PathSeparator) + RunReportFileName
+}
+
+// NewRunReport creates a report listing every selected track in the disc config as not started.
+func NewRunReport(reportPath string, discConfig BluRayDiscConfig, trackSelection TrackSelection) *RunReport {
+	runReport := &RunReport{
+		DiscVolumeKeySha1: discConfig.DiscVolumeKeySha1,
+		BluRayTitle:       discConfig.BluRayTitle,
+		VariantName:       discConfig.VariantName,
+		CatalogNumber:     discConfig.CatalogNumber,
+		StartTime:         time.Now(),
+		Albums:            make([]AlbumReport, 0),
+		Tracks:            make([]TrackReport, 0),
+		Warnings:          make([]string, 0),
+		reportPath:        reportPath,
+		trackWarnings:     make(map[TrackJob][]string),
+	}
+
+	for _, album := range discConfig.Albums {
+		runReport.Albums = append(runReport.Albums, AlbumReport{
+			AlbumNumber: album.AlbumNumber,
+			AlbumTitle:  album.AlbumTitle,
+		})
+
+		for _, disc := range album.Discs {
+			for _, track := range disc.Tracks {
+				trackStatus := TrackStatusNotStarted
+				if !trackSelection.Includes(album.AlbumNumber, disc.DiscNumber, track.TrackNumber) {
+					trackStatus = TrackStatusNotSelected
+				}
+
+				runReport.Tracks = append(runReport.Tracks, TrackReport{
+					AlbumNumber: album.AlbumNumber,
+					DiscNumber:  disc.DiscNumber,
+					TrackNumber: track.TrackNumber,
+					TrackTitle:  track.TrackTitle,
+					Status:      trackStatus,
+					TitleNumber: track.TitleNumber,
+					Chapters:    make([]PlannedChapter, 0),
+					Warnings:    make([]string, 0),
+				})
+			}
+		}
+	}
+
+	return runReport
+}
+
+// GetTrackReport describes how a track is extracted, using the same chapter timings, audio stream,
+// and trims as ExtractFlacFromMkv.  The expected duration is left out if there's no probe data for
+// the track.  The duration is only set once the track's FLAC file is finished, by
+// SetMeasuredDuration.
+func GetTrackReport(mkvBasePath string, flacBasePath string, albumNumber int, discNumber int, trackNumber int, ffProbeData map[string][]*FfprobeChapterInfo, discConfig BluRayDiscConfig, audioStreamType string, replaceSpaceWithUnderscore bool) (*TrackReport, error) {
+	track, err := GetTrack(albumNumber, discNumber, trackNumber, discConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	trackPlan, err := GetTrackPlan(mkvBasePath, flacBasePath, albumNumber, discNumber, trackNumber, ffProbeData, discConfig, audioStreamType, "", replaceSpaceWithUnderscore)
+	if err != nil {
+		return nil, err
+	}
+
+	audioStreamNumber, audioStreamReason := GetAudioStreamSelectionForTrack(*track, audioStreamType)
+
+	trackReport := &TrackReport{
+		AlbumNumber:       albumNumber,
+		DiscNumber:        discNumber,
+		TrackNumber:       trackNumber,
+		TrackTitle:        track.TrackTitle,
+		Status:            TrackStatusNotStarted,
+		FlacPath:          trackPlan.FlacPath,
+		MkvPath:           trackPlan.MkvPath,
+		TitleNumber:       track.TitleNumber,
+		Chapters:          trackPlan.Chapters,
+		AudioStreamNumber: audioStreamNumber,
+		AudioStreamReason: audioStreamReason,
+		TrimStartS:        track.TrimStartS,
+		TrimEndS:          track.TrimEndS,
+		Warnings:          trackPlan.Warnings,
+	}
+
+	if _, hasProbeData := ffProbeData[track.TitleNumber]; hasProbeData {
+		expectedDuration := GetChapterInfosDuration(GetChapterInfosForTrack(*track, ffProbeData)) - track.TrimStartS - track.TrimEndS
+		trackReport.ExpectedDuration = &expectedDuration
+	}
+
+	return trackReport, nil
+}
+
+// SetMeasuredDuration records the length of the finished FLAC file, and adds a warning if it's
+// too far from the expected duration, which usually means a chapter or trim is wrong.
+func (trackReport *TrackReport) SetMeasuredDuration(flacDuration time.Duration) {
+	duration := flacDuration.Seconds()
+	trackReport.Duration = &duration
+
+	if trackReport.ExpectedDuration != nil && math.Abs(duration-*trackReport.ExpectedDuration) > trackDurationToleranceS {
+		trackReport.Warnings = append(trackReport.Warnings, fmt.Sprintf("FLAC duration (%.3fs) doesn't match the expected duration (%.3fs)", duration, *trackReport.ExpectedDuration))
+	}
+}
+
+// HandleEvent collects warnings from the library, so a RunReport can be passed to WithObserver.
+// Warnings for a track are added to that track, and any others to the whole run.
+func (runReport *RunReport) HandleEvent(event Event) {
+	warningEvent, isWarning := event.(WarningEvent)
+	if !isWarning {
+		return
+	}
+
+	runReport.reportMutex.Lock()
+	defer runReport.reportMutex.Unlock()
+
+	if warningEvent.Track.TrackNumber == 0 {
+		runReport.Warnings = append(runReport.Warnings, warningEvent.Message)
+		return
+	}
+
+	runReport.trackWarnings[warningEvent.Track] = append(runReport.trackWarnings[warningEvent.Track], warningEvent.Message)
+}
+
+func (runReport *RunReport) SetAlbumCoverArt(albumNumber int, coverArtReport *CoverArtReport) {
+	runReport.reportMutex.Lock()
+	defer runReport.reportMutex.Unlock()
+
+	for i := range runReport.Albums {
+		if runReport.Albums[i].AlbumNumber == albumNumber {
+			runReport.Albums[i].CoverArt = coverArtReport
+		}
+	}
+}
+
+func (runReport *RunReport) SetTrackReport(trackReport TrackReport) {
+	runReport.reportMutex.Lock()
+	defer runReport.reportMutex.Unlock()
+
+	for i := range runReport.Tracks {
+		if runReport.Tracks[i].AlbumNumber == trackReport.AlbumNumber && runReport.Tracks[i].DiscNumber == trackReport.DiscNumber && runReport.Tracks[i].TrackNumber == trackReport.TrackNumber {
+			runReport.Tracks[i] = trackReport
+			return
+		}
+	}
+
+	runReport.Tracks = append(runReport.Tracks, trackReport)
+}
+
+// Finish records the end of the rip and writes the report.
+func (runReport *RunReport) Finish(succeeded bool) error {
+	runReport.reportMutex.Lock()
+	defer runReport.reportMutex.Unlock()
+
+	runReport.EndTime = time.Now()
+	runReport.Succeeded = succeeded
+
+	for i := range runReport.Tracks {
+		trackJob := TrackJob{AlbumNumber: runReport.Tracks[i].AlbumNumber, DiscNumber: runReport.Tracks[i].DiscNumber, TrackNumber: runReport.Tracks[i].TrackNumber}
+		runReport.Tracks[i].Warnings = append(runReport.Tracks[i].Warnings, runReport.trackWarnings[trackJob]...)
+		delete(runReport.trackWarnings, trackJob)
+	}
+
+	err := os.MkdirAll(path.Dir(runReport.reportPath), 0755)
+	if err != nil {
+		return err
+	}
+
+	reportData, err := json.MarshalIndent(runReport, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so tools watching for the report never read a partial one
+	tempReportPath := runReport.reportPath + ".tmp"
+	err = os.WriteFile(tempReportPath, reportData, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tempReportPath, runReport.reportPath)
+}
+
+// GetCoverArtReport describes where an album's cover art was copied from, following the same
+// precedence as the CLI: an explicit cover art path first, then the album's configured cover.
+func GetCoverArtReport(discBasePath string, coverArtFullPath string, album BluRayDiscConfigAlbum, coverArtPath string) *CoverArtReport {
+	if coverArtFullPath != "" {
+		return &CoverArtReport{SourceType: "file", SourcePath: coverArtFullPath, Path: coverArtPath}
+	}
+
+	coverArtReport := &CoverArtReport{SourceType: album.CoverType, SourcePath: GetExpandedCoverArtSourcePath(discBasePath, album), Path: coverArtPath}
+
+	switch album.CoverType {
+	case "url":
+		coverArtReport.SourcePath = album.CoverUrl
+	case "zip", "zip_mp3":
+		coverArtReport.EntryPath = album.CoverRelativePath
+	}
+
+	return coverArtReport
+}
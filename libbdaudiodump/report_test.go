@@ -0,0 +1,88 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTrackReportSetMeasuredDuration(t *testing.T) {
+	expectedDuration := 96.5
+
+	trackReport := &TrackReport{ExpectedDuration: &expectedDuration, Warnings: make([]string, 0)}
+	trackReport.SetMeasuredDuration(96*time.Second + 700*time.Millisecond)
+	if trackReport.Duration == nil || *trackReport.Duration != 96.7 || len(trackReport.Warnings) != 0 {
+		t.Errorf("expected a duration of 96.7 without warnings, got %+v", trackReport)
+	}
+
+	trackReport = &TrackReport{ExpectedDuration: &expectedDuration, Warnings: make([]string, 0)}
+	trackReport.SetMeasuredDuration(100 * time.Second)
+	if trackReport.Duration == nil || *trackReport.Duration != 100 || len(trackReport.Warnings) != 1 {
+		t.Errorf("expected a duration of 100 with a warning, got %+v", trackReport)
+	}
+}
+
+func TestRunReportCollectsWarnings(t *testing.T) {
+	discConfig := newTestDiscConfig()
+	reportPath := filepath.Join(t.TempDir(), RunReportFileName)
+
+	runReport := NewRunReport(reportPath, discConfig, TrackSelection{})
+	runReport.HandleEvent(WarningEvent{Stage: StageMkv, Message: "makemkvcon error 2003: read error"})
+	runReport.HandleEvent(WarningEvent{Stage: StageExtract, Track: TrackJob{AlbumNumber: 1, DiscNumber: 1, TrackNumber: 2}, Message: "chapter is very short"})
+	runReport.HandleEvent(StageStartedEvent{Stage: StageExtract})
+
+	// Track reports are replaced as tracks finish, which shouldn't lose the warnings
+	runReport.SetTrackReport(TrackReport{AlbumNumber: 1, DiscNumber: 1, TrackNumber: 2, Status: TrackStatusCompleted, Warnings: []string{"planned warning"}})
+
+	err := runReport.Finish(true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reportData, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var writtenReport RunReport
+	err = json.Unmarshal(reportData, &writtenReport)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(writtenReport.Warnings) != 1 || writtenReport.Warnings[0] != "makemkvcon error 2003: read error" {
+		t.Errorf("unexpected run warnings: %q", writtenReport.Warnings)
+	}
+
+	for _, trackReport := range writtenReport.Tracks {
+		expectedWarnings := 0
+		if trackReport.TrackNumber == 2 {
+			expectedWarnings = 2
+		}
+
+		if len(trackReport.Warnings) != expectedWarnings {
+			t.Errorf("track %d: got warnings %q, expected %d", trackReport.TrackNumber, trackReport.Warnings, expectedWarnings)
+		}
+	}
+}
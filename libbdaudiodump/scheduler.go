@@ -0,0 +1,104 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+)
+
+type TrackJob struct {
+	AlbumNumber int
+	DiscNumber  int
+	TrackNumber int
+}
+
+func GetTrackJobs(discConfig BluRayDiscConfig) []TrackJob {
+	trackJobs := make([]TrackJob, 0)
+
+	for _, album := range discConfig.Albums {
+		for _, disc := range album.Discs {
+			for _, track := range disc.Tracks {
+				trackJobs = append(trackJobs, TrackJob{
+					AlbumNumber: album.AlbumNumber,
+					DiscNumber:  disc.DiscNumber,
+					TrackNumber: track.TrackNumber,
+				})
+			}
+		}
+	}
+
+	return trackJobs
+}
+
+// RunTrackJobs runs processTrack for each job using up to jobCount workers.  Jobs are
+// started in order.  The first error cancels the context passed to the remaining
+// workers, no further jobs are started, and that error is returned once every
+// in-flight job has returned.
+func RunTrackJobs(ctx context.Context, jobCount int, trackJobs []TrackJob, processTrack func(ctx context.Context, trackJob TrackJob) error) error {
+	if jobCount < 1 {
+		return errors.New("invalid number of jobs: " + strconv.Itoa(jobCount))
+	}
+
+	jobContext, cancelJobs := context.WithCancel(ctx)
+	defer cancelJobs()
+
+	trackJobChannel := make(chan TrackJob)
+
+	var firstErr error
+	var firstErrOnce sync.Once
+	var waitGroup sync.WaitGroup
+
+	for i := 0; i < jobCount; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for trackJob := range trackJobChannel {
+				err := processTrack(jobContext, trackJob)
+				if err != nil {
+					firstErrOnce.Do(func() {
+						firstErr = err
+						cancelJobs()
+					})
+				}
+			}
+		}()
+	}
+
+dispatchLoop:
+	for _, trackJob := range trackJobs {
+		select {
+		case trackJobChannel <- trackJob:
+		case <-jobContext.Done():
+			break dispatchLoop
+		}
+	}
+
+	close(trackJobChannel)
+	waitGroup.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	return ctx.Err()
+}
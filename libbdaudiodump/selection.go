@@ -0,0 +1,176 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TrackSelection limits a rip to some of the tracks on a disc.  A zero AlbumNumber or
+// DiscNumber matches every album or disc, and a nil TrackNumberRanges matches every track.
+// Tracks that aren't selected are skipped rather than removed from the config, so output
+// paths don't change depending on what was selected.
+type TrackSelection struct {
+	AlbumNumber       int
+	DiscNumber        int
+	TrackNumberRanges []TrackNumberRange
+}
+
+// TrackNumberRange is an inclusive range of track numbers.  Ranges are kept as they were
+// written rather than expanded, so a range like 1-1000000000 doesn't allocate every number in it.
+type TrackNumberRange struct {
+	First int
+	Last  int
+}
+
+func (trackNumberRange TrackNumberRange) Includes(trackNumber int) bool {
+	return trackNumber >= trackNumberRange.First && trackNumber <= trackNumberRange.Last
+}
+
+// ParseTrackNumberList parses a comma-separated list of track numbers and ranges, such as 3,7-9.
+func ParseTrackNumberList(trackNumberList string) ([]TrackNumberRange, error) {
+	trackNumberRanges := make([]TrackNumberRange, 0)
+
+	for _, listEntry := range strings.Split(trackNumberList, ",") {
+		listEntry = strings.TrimSpace(listEntry)
+
+		rangeStart, rangeEnd, isRange := strings.Cut(listEntry, "-")
+		if !isRange {
+			rangeEnd = rangeStart
+		}
+
+		firstTrackNumber, err := strconv.Atoi(strings.TrimSpace(rangeStart))
+		if err != nil || firstTrackNumber < 1 {
+			return nil, errors.New("invalid track number in list: " + listEntry)
+		}
+
+		lastTrackNumber, err := strconv.Atoi(strings.TrimSpace(rangeEnd))
+		if err != nil || lastTrackNumber < firstTrackNumber {
+			return nil, errors.New("invalid track range in list: " + listEntry)
+		}
+
+		trackNumberRanges = append(trackNumberRanges, TrackNumberRange{First: firstTrackNumber, Last: lastTrackNumber})
+	}
+
+	return trackNumberRanges, nil
+}
+
+func (trackSelection TrackSelection) Includes(albumNumber int, discNumber int, trackNumber int) bool {
+	if trackSelection.AlbumNumber != 0 && trackSelection.AlbumNumber != albumNumber {
+		return false
+	}
+
+	if trackSelection.DiscNumber != 0 && trackSelection.DiscNumber != discNumber {
+		return false
+	}
+
+	if trackSelection.TrackNumberRanges == nil {
+		return true
+	}
+
+	for _, trackNumberRange := range trackSelection.TrackNumberRanges {
+		if trackNumberRange.Includes(trackNumber) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (trackSelection TrackSelection) IncludesAll() bool {
+	return trackSelection.AlbumNumber == 0 && trackSelection.DiscNumber == 0 && trackSelection.TrackNumberRanges == nil
+}
+
+func (trackSelection TrackSelection) IncludesAnyTrackInAlbum(album BluRayDiscConfigAlbum) bool {
+	for _, disc := range album.Discs {
+		for _, track := range disc.Tracks {
+			if trackSelection.Includes(album.AlbumNumber, disc.DiscNumber, track.TrackNumber) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func GetSelectedTrackJobs(discConfig BluRayDiscConfig, trackSelection TrackSelection) []TrackJob {
+	trackJobs := make([]TrackJob, 0)
+
+	for _, trackJob := range GetTrackJobs(discConfig) {
+		if trackSelection.Includes(trackJob.AlbumNumber, trackJob.DiscNumber, trackJob.TrackNumber) {
+			trackJobs = append(trackJobs, trackJob)
+		}
+	}
+
+	return trackJobs
+}
+
+// GetSelectedTitleNumbers returns the title numbers the selected tracks are extracted from,
+// sorted and without duplicates.
+func GetSelectedTitleNumbers(discConfig BluRayDiscConfig, trackSelection TrackSelection) []string {
+	titleNumbers := make([]string, 0)
+	seenTitleNumbers := make(map[string]bool)
+
+	for _, album := range discConfig.Albums {
+		for _, disc := range album.Discs {
+			for _, track := range disc.Tracks {
+				if !trackSelection.Includes(album.AlbumNumber, disc.DiscNumber, track.TrackNumber) || seenTitleNumbers[track.TitleNumber] {
+					continue
+				}
+
+				seenTitleNumbers[track.TitleNumber] = true
+				titleNumbers = append(titleNumbers, track.TitleNumber)
+			}
+		}
+	}
+
+	sort.Slice(titleNumbers, func(i int, j int) bool {
+		return compareTitleNumbers(titleNumbers[i], titleNumbers[j]) < 0
+	})
+
+	return titleNumbers
+}
+
+// compareTitleNumbers orders title numbers numerically, so 9 comes before 10 even without zero padding
+func compareTitleNumbers(titleNumberA string, titleNumberB string) int {
+	numberA, errA := strconv.Atoi(titleNumberA)
+	numberB, errB := strconv.Atoi(titleNumberB)
+	if errA != nil || errB != nil || numberA == numberB {
+		return strings.Compare(titleNumberA, titleNumberB)
+	}
+
+	if numberA < numberB {
+		return -1
+	}
+
+	return 1
+}
+
+// CheckTrackSelection returns an error if the selection doesn't match any tracks on the disc.
+func CheckTrackSelection(discConfig BluRayDiscConfig, trackSelection TrackSelection) error {
+	if len(GetSelectedTrackJobs(discConfig, trackSelection)) == 0 {
+		return errors.New("no tracks match the selected album, disc, and tracks for disc: " + discConfig.BluRayTitle)
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package libbdaudiodump
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTrackNumberList(t *testing.T) {
+	tests := []struct {
+		name           string
+		trackNumbers   string
+		expectedRanges []TrackNumberRange
+		expectError    bool
+	}{
+		{name: "single track", trackNumbers: "3", expectedRanges: []TrackNumberRange{{First: 3, Last: 3}}},
+		{name: "tracks and ranges", trackNumbers: "3, 7-9", expectedRanges: []TrackNumberRange{{First: 3, Last: 3}, {First: 7, Last: 9}}},
+		{name: "huge range", trackNumbers: "1-1000000000", expectedRanges: []TrackNumberRange{{First: 1, Last: 1000000000}}},
+		{name: "zero track", trackNumbers: "0", expectError: true},
+		{name: "reversed range", trackNumbers: "9-7", expectError: true},
+		{name: "open range", trackNumbers: "7-", expectError: true},
+		{name: "not a number", trackNumbers: "three", expectError: true},
+		{name: "empty entry", trackNumbers: "3,,4", expectError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			trackNumberRanges, err := ParseTrackNumberList(test.trackNumbers)
+			if test.expectError {
+				if err == nil {
+					t.Errorf("expected an error, got %v", trackNumberRanges)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(trackNumberRanges, test.expectedRanges) {
+				t.Errorf("got %v, expected %v", trackNumberRanges, test.expectedRanges)
+			}
+		})
+	}
+}
+
+func TestTrackSelectionIncludes(t *testing.T) {
+	trackNumberRanges, err := ParseTrackNumberList("2,5-1000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trackSelection := TrackSelection{AlbumNumber: 1, TrackNumberRanges: trackNumberRanges}
+
+	tests := []struct {
+		albumNumber int
+		trackNumber int
+		expected    bool
+	}{
+		{albumNumber: 1, trackNumber: 1, expected: false},
+		{albumNumber: 1, trackNumber: 2, expected: true},
+		{albumNumber: 1, trackNumber: 4, expected: false},
+		{albumNumber: 1, trackNumber: 5, expected: true},
+		{albumNumber: 1, trackNumber: 999999999, expected: true},
+		{albumNumber: 2, trackNumber: 2, expected: false},
+	}
+
+	for _, test := range tests {
+		if trackSelection.Includes(test.albumNumber, 1, test.trackNumber) != test.expected {
+			t.Errorf("album %d track %d: expected %v", test.albumNumber, test.trackNumber, test.expected)
+		}
+	}
+
+	if trackSelection.IncludesAll() || !(TrackSelection{}).IncludesAll() {
+		t.Error("unexpected IncludesAll result")
+	}
+}
+
+func TestGetSelectedTrackJobs(t *testing.T) {
+	trackSelection := TrackSelection{TrackNumberRanges: []TrackNumberRange{{First: 2, Last: 3}}}
+
+	trackJobs := GetSelectedTrackJobs(newTestDiscConfig(), trackSelection)
+	expectedTrackJobs := []TrackJob{
+		{AlbumNumber: 1, DiscNumber: 1, TrackNumber: 2},
+		{AlbumNumber: 1, DiscNumber: 1, TrackNumber: 3},
+	}
+	if !reflect.DeepEqual(trackJobs, expectedTrackJobs) {
+		t.Errorf("got %v, expected %v", trackJobs, expectedTrackJobs)
+	}
+
+	err := CheckTrackSelection(newTestDiscConfig(), TrackSelection{TrackNumberRanges: []TrackNumberRange{{First: 4, Last: 100}}})
+	if err == nil {
+		t.Error("expected an error for a selection without matching tracks")
+	}
+}
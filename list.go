@@ -0,0 +1,93 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+)
+
+func runList(ctx context.Context, args []string) int {
+	flagSet := flag.NewFlagSet("list", flag.ContinueOnError)
+	flagSet.Usage = printListUsage
+
+	configPaths := make([]string, 0)
+	addConfigPathFlag(flagSet, &configPaths)
+	logOptions := addLogFlags(flagSet)
+
+	err := flagSet.Parse(args)
+	if err != nil {
+		return getFlagParseExitCode(err)
+	}
+
+	_, logger, closeLogFile, err := setUpLogging(ctx, logOptions)
+	if err != nil {
+		println(err.Error())
+		printListUsage()
+		return 1
+	}
+	defer closeLogFile()
+
+	parsedConfig, err := loadConfig(logger, configPaths)
+	if err != nil {
+		return 1
+	}
+
+	for i, discConfig := range *parsedConfig {
+		if i > 0 {
+			fmt.Println("")
+		}
+
+		fmt.Println(discConfig.BluRayTitle)
+		if discConfig.DiscVolumeKeySha1 != "" {
+			fmt.Println("    Volume key SHA1: " + discConfig.DiscVolumeKeySha1)
+		}
+		for _, variant := range discConfig.Variants {
+			variantDescription := variant.VariantName
+			if variant.CatalogNumber != "" {
+				variantDescription = variantDescription + " (" + variant.CatalogNumber + ")"
+			}
+			fmt.Println("    Variant " + variantDescription + " volume key SHA1: " + variant.DiscVolumeKeySha1)
+		}
+		fmt.Println("    MakeMKV prefix: " + discConfig.MakemkvPrefix)
+
+		for _, album := range discConfig.Albums {
+			trackCount := 0
+			for _, disc := range album.Discs {
+				trackCount = trackCount + len(disc.Tracks)
+			}
+
+			fmt.Println("    Album " + strconv.Itoa(album.AlbumNumber) + ": " + album.AlbumTitle + " by " + album.AlbumArtist + " (" + strconv.Itoa(len(album.Discs)) + " discs, " + strconv.Itoa(trackCount) + " tracks)")
+		}
+	}
+
+	return 0
+}
+
+func printListUsage() {
+	println("Lists the discs in the config")
+	println("")
+	println("Usage:")
+	println("bdaudiodump list [arguments]")
+	printConfigUsage()
+	printLogUsage()
+}
@@ -0,0 +1,162 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bdaudiodump/libbdaudiodump"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// ripObserver is how the CLI reports what the library is doing.  Stages and tracks are logged,
+// and makemkvcon's progress is shown on a status line that's redrawn in place when the output is
+// a terminal, or logged every ten percent otherwise.
+type ripObserver struct {
+	logger             *slog.Logger
+	writer             io.Writer
+	isTerminal         bool
+	lastPrintedPercent int
+	lastLoggedPercent  int
+	lineOpen           bool
+	observerMutex      sync.Mutex
+}
+
+// newRipObserver creates an observer that logs to logger.  The status line is only drawn if
+// outputFile is a terminal, so pass nil to always log progress instead.
+func newRipObserver(logger *slog.Logger, outputFile *os.File) *ripObserver {
+	isTerminal := false
+	if outputFile != nil {
+		fileInfo, err := outputFile.Stat()
+		if err == nil && fileInfo.Mode()&os.ModeCharDevice != 0 {
+			isTerminal = true
+		}
+	}
+
+	return &ripObserver{
+		logger:             logger,
+		writer:             outputFile,
+		isTerminal:         isTerminal,
+		lastPrintedPercent: -1,
+		lastLoggedPercent:  -1,
+	}
+}
+
+func (observer *ripObserver) HandleEvent(event libbdaudiodump.Event) {
+	observer.observerMutex.Lock()
+	defer observer.observerMutex.Unlock()
+
+	switch typedEvent := event.(type) {
+	case libbdaudiodump.DiscIdentifiedEvent:
+		observer.logger = observer.logger.With(libbdaudiodump.LogKeyDiscTitle, typedEvent.BluRayTitle)
+		if typedEvent.VariantName != "" {
+			observer.logger = observer.logger.With("variant", typedEvent.VariantName)
+		}
+		observer.logger.Info("Found matching disc in config")
+	case libbdaudiodump.StageStartedEvent:
+		observer.getTrackLogger(typedEvent.Track).Info(getStageStartedMessage(typedEvent.Stage), libbdaudiodump.LogKeyStage, typedEvent.Stage)
+	case libbdaudiodump.StageFinishedEvent:
+		observer.endLine()
+		if typedEvent.Err == nil {
+			observer.getTrackLogger(typedEvent.Track).Debug("Finished stage", libbdaudiodump.LogKeyStage, typedEvent.Stage, libbdaudiodump.LogKeyDuration, typedEvent.Duration.Seconds())
+		}
+	case libbdaudiodump.TrackCompletedEvent:
+		observer.getTrackLogger(typedEvent.Track).Info("Finished processing track", "path", typedEvent.FlacPath, "track_duration_s", typedEvent.Duration.Seconds())
+	case libbdaudiodump.WarningEvent:
+		observer.endLine()
+		observer.getTrackLogger(typedEvent.Track).Warn(typedEvent.Message, libbdaudiodump.LogKeyStage, typedEvent.Stage)
+	case libbdaudiodump.MakemkvconOperation:
+		if typedEvent.IsTotal {
+			observer.endLine()
+			observer.logger.Info("makemkvcon started operation", "operation", typedEvent.Name)
+			observer.lastLoggedPercent = -1
+		}
+	case libbdaudiodump.MakemkvconProgress:
+		observer.showMakemkvconProgress(typedEvent)
+	}
+}
+
+func (observer *ripObserver) getTrackLogger(trackJob libbdaudiodump.TrackJob) *slog.Logger {
+	if trackJob.TrackNumber == 0 {
+		return observer.logger
+	}
+
+	return observer.logger.With(libbdaudiodump.LogKeyAlbumNumber, trackJob.AlbumNumber, libbdaudiodump.LogKeyDiscNumber, trackJob.DiscNumber, libbdaudiodump.LogKeyTrackNumber, trackJob.TrackNumber)
+}
+
+func getStageStartedMessage(stage string) string {
+	switch stage {
+	case libbdaudiodump.StageBackup:
+		return "Copying disc"
+	case libbdaudiodump.StageMkv:
+		return "Dumping disc to MKV files"
+	case libbdaudiodump.StageProbe:
+		return "Running ffprobe on MKV files"
+	case libbdaudiodump.StageExtract:
+		return "Extracting track"
+	case libbdaudiodump.StageCompress:
+		return "Compressing track"
+	case libbdaudiodump.StageTag:
+		return "Tagging track"
+	}
+
+	return "Starting stage"
+}
+
+func (observer *ripObserver) showMakemkvconProgress(progress libbdaudiodump.MakemkvconProgress) {
+	totalPercent := int(progress.TotalFraction() * 100)
+
+	if !observer.isTerminal {
+		// Log every ten percent.  -1 means nothing has been logged yet, but -1/10 is 0 in Go, so it
+		// has to be checked separately for the first 0% to be logged
+		if observer.lastLoggedPercent < 0 || totalPercent/10 != observer.lastLoggedPercent/10 {
+			observer.lastLoggedPercent = totalPercent
+			observer.logger.Info("makemkvcon progress", "operation", progress.TotalOperation, "percent", totalPercent)
+		}
+		return
+	}
+
+	// Redraw at most once per tenth of a percent
+	printedPercent := int(progress.TotalFraction() * 1000)
+	if printedPercent == observer.lastPrintedPercent {
+		return
+	}
+
+	observer.lastPrintedPercent = printedPercent
+	observer.lineOpen = true
+
+	progressLine := fmt.Sprintf("%s: %5.1f%%", progress.TotalOperation, progress.TotalFraction()*100)
+	if progress.CurrentOperation != "" && progress.CurrentOperation != progress.TotalOperation {
+		progressLine = progressLine + fmt.Sprintf(" (%s: %5.1f%%)", progress.CurrentOperation, progress.CurrentFraction()*100)
+	}
+
+	fmt.Fprint(observer.writer, "\r"+progressLine+"\x1b[K")
+}
+
+// endLine ends the status line so later output starts on a new line.
+func (observer *ripObserver) endLine() {
+	if observer.lineOpen {
+		fmt.Fprintln(observer.writer)
+		observer.lineOpen = false
+		observer.lastPrintedPercent = -1
+	}
+}
@@ -0,0 +1,112 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bdaudiodump/libbdaudiodump"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+)
+
+func runProbe(ctx context.Context, args []string) int {
+	flagSet := flag.NewFlagSet("probe", flag.ContinueOnError)
+	flagSet.Usage = printProbeUsage
+
+	logOptions := addLogFlags(flagSet)
+
+	err := flagSet.Parse(args)
+	if err != nil {
+		return getFlagParseExitCode(err)
+	}
+
+	if flagSet.NArg() == 0 {
+		printProbeUsage()
+		return 1
+	}
+
+	ctx, logger, closeLogFile, err := setUpLogging(ctx, logOptions)
+	if err != nil {
+		println(err.Error())
+		printProbeUsage()
+		return 1
+	}
+	defer closeLogFile()
+
+	mkvPaths := make([]string, 0)
+	for _, probePath := range flagSet.Args() {
+		fileInfo, err := os.Stat(probePath)
+		if err != nil {
+			logError(logger, "Unable to open MKV path", err, "path", probePath)
+			return 1
+		}
+
+		if !fileInfo.IsDir() {
+			mkvPaths = append(mkvPaths, probePath)
+			continue
+		}
+
+		directoryMkvPaths, err := libbdaudiodump.GetMkvPathsInDirectory(probePath)
+		if err != nil {
+			logError(logger, "Unable to list MKV files", err, "path", probePath)
+			return 1
+		}
+		mkvPaths = append(mkvPaths, directoryMkvPaths...)
+	}
+
+	for i, mkvPath := range mkvPaths {
+		chapterInfos, err := libbdaudiodump.GetFfprobeDataFromMkv(ctx, mkvPath)
+		if err != nil {
+			logError(logger, "Error reading data from MKV file", err, "path", mkvPath)
+			return 1
+		}
+
+		if i > 0 {
+			fmt.Println("")
+		}
+
+		titleNumber := libbdaudiodump.GetTitleNumberFromMkvPath(mkvPath)
+		if titleNumber != "" {
+			fmt.Println("Title " + titleNumber + ": " + mkvPath)
+		} else {
+			fmt.Println("Unknown title: " + mkvPath)
+		}
+
+		for _, chapterInfo := range chapterInfos {
+			if chapterInfo.IsChapter {
+				fmt.Printf("    Chapter %d: start %.6fs, end %.6fs, duration %.6fs\n", chapterInfo.ChapterIndex, chapterInfo.ChapterStartTime, chapterInfo.ChapterEndTime, chapterInfo.ChapterDuration)
+			} else {
+				fmt.Printf("    No chapters, duration %.6fs\n", chapterInfo.ChapterDuration)
+			}
+		}
+	}
+
+	return 0
+}
+
+func printProbeUsage() {
+	println("Shows the titles and chapters in MKV files, numbered the way the disc")
+	println("config expects them")
+	println("")
+	println("Usage:")
+	println("bdaudiodump probe [arguments] <MKV file or directory>...")
+	printLogUsage()
+}
@@ -0,0 +1,842 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bdaudiodump/libbdaudiodump"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ripOptions holds the settings for a rip.  The rip command fills them in from its flags, and
+// the serve command from submitted jobs.
+type ripOptions struct {
+	MakemkvconDiscId             int      `json:"makemkvcon_disc_id"`
+	Device                       string   `json:"device,omitempty"`
+	OutputDirectory              string   `json:"output_directory"`
+	VolumeKeySha1                string   `json:"volume_key_sha1,omitempty"`
+	ReplaceSpacesWithUnderscores bool     `json:"replace_spaces_with_underscores"`
+	MkvSourcePath                string   `json:"mkv_source_path,omitempty"`
+	CopyDiscBeforeMkvExtraction  bool     `json:"copy_disc_before_mkv_extraction"`
+	AudioStreamType              string   `json:"audio_stream_type,omitempty"`
+	ConfigPaths                  []string `json:"config_paths,omitempty"`
+	DiscBasePath                 string   `json:"disc_base_path,omitempty"`
+	CoverArtFullPath             string   `json:"cover_art_full_path,omitempty"`
+	DryRun                       bool     `json:"dry_run,omitempty"`
+	DryRunFormat                 string   `json:"dry_run_format,omitempty"`
+	Jobs                         int      `json:"jobs"`
+	Resume                       bool     `json:"resume,omitempty"`
+	AlbumNumber                  int      `json:"album,omitempty"`
+	DiscNumber                   int      `json:"disc,omitempty"`
+	TrackNumberList              string   `json:"tracks,omitempty"`
+}
+
+func getDefaultRipOptions() ripOptions {
+	return ripOptions{
+		MakemkvconDiscId:             math.MaxInt,
+		ReplaceSpacesWithUnderscores: true,
+		CopyDiscBeforeMkvExtraction:  true,
+		DryRunFormat:                 "text",
+		Jobs:                         1,
+	}
+}
+
+func runRip(ctx context.Context, args []string) int {
+	flagSet := flag.NewFlagSet("rip", flag.ContinueOnError)
+	flagSet.Usage = printRipUsage
+
+	options := getDefaultRipOptions()
+
+	flagSet.IntVar(&options.MakemkvconDiscId, "makemkvcon-disc-id", options.MakemkvconDiscId, "The disc ID (for the disc: identifier) to pass to makemkvcon")
+	flagSet.StringVar(&options.Device, "device", options.Device, "The device path of the drive the disc is in, such as /dev/sr0")
+	flagSet.StringVar(&options.OutputDirectory, "output-directory", options.OutputDirectory, "The directory to store output in")
+	flagSet.StringVar(&options.VolumeKeySha1, "volume-key-sha1", options.VolumeKeySha1, "Use the specified SHA1 sum for detecting the disc instead of analyzing it")
+	flagSet.BoolVar(&options.ReplaceSpacesWithUnderscores, "replace-spaces-with-underscores", options.ReplaceSpacesWithUnderscores, "Replace spaces with underscores in FLAC files and directory")
+	flagSet.StringVar(&options.MkvSourcePath, "mkv-source-path", options.MkvSourcePath, "Path to pre-extracted MKV files")
+	flagSet.BoolVar(&options.CopyDiscBeforeMkvExtraction, "copy-disc-before-mkv-extraction", options.CopyDiscBeforeMkvExtraction, "Copy disc contents to destination before MKV extraction")
+	flagSet.StringVar(&options.AudioStreamType, "audio-stream-type", options.AudioStreamType, "Audio stream type (best, surround71, surround51, stereo21, or stereo20)")
+	addConfigPathFlag(flagSet, &options.ConfigPaths)
+	flagSet.StringVar(&options.DiscBasePath, "disc-base-path", options.DiscBasePath, "The base path to the mounted disc")
+	flagSet.StringVar(&options.CoverArtFullPath, "cover-art-full-path", options.CoverArtFullPath, "An explicit path to a cover art file")
+	flagSet.BoolVar(&options.DryRun, "dry-run", options.DryRun, "Print the commands a rip would run without running them")
+	flagSet.StringVar(&options.DryRunFormat, "dry-run-format", options.DryRunFormat, "Output format for --dry-run (text or json)")
+	flagSet.IntVar(&options.Jobs, "jobs", options.Jobs, "The number of tracks to process concurrently")
+	flagSet.BoolVar(&options.Resume, "resume", options.Resume, "Resume a previous rip using the job manifest in the output directory")
+	flagSet.IntVar(&options.AlbumNumber, "album", options.AlbumNumber, "Only rip tracks from this album number")
+	flagSet.IntVar(&options.DiscNumber, "disc", options.DiscNumber, "Only rip tracks from this disc number")
+	flagSet.StringVar(&options.TrackNumberList, "tracks", options.TrackNumberList, "Only rip these track numbers (for example, 3,7-9)")
+	logOptions := addLogFlags(flagSet)
+
+	err := flagSet.Parse(args)
+	if err != nil {
+		return getFlagParseExitCode(err)
+	}
+
+	_, err = checkRipOptions(options)
+	if err != nil {
+		println(err.Error())
+		printRipUsage()
+		return 1
+	}
+
+	ctx, logger, closeLogFile, err := setUpLogging(ctx, logOptions)
+	if err != nil {
+		println(err.Error())
+		printRipUsage()
+		return 1
+	}
+	defer closeLogFile()
+
+	ctx = libbdaudiodump.WithObserver(ctx, newRipObserver(logger, os.Stderr))
+
+	err = executeRip(ctx, options)
+	if err != nil {
+		return 1
+	}
+
+	return 0
+}
+
+// checkRipOptions returns the track selection the options describe, or an error if they're
+// missing something or contradict each other.
+func checkRipOptions(options ripOptions) (libbdaudiodump.TrackSelection, error) {
+	trackSelection := libbdaudiodump.TrackSelection{AlbumNumber: options.AlbumNumber, DiscNumber: options.DiscNumber}
+
+	if options.OutputDirectory == "" {
+		return trackSelection, errors.New("an output directory is required")
+	}
+
+	if options.MakemkvconDiscId == math.MaxInt && options.Device == "" && options.MkvSourcePath == "" {
+		return trackSelection, errors.New("either a makemkvcon disc ID, a device, or an MKV source path is required")
+	}
+
+	if options.MakemkvconDiscId != math.MaxInt && options.Device != "" {
+		return trackSelection, errors.New("a makemkvcon disc ID and a device can't both be specified")
+	}
+
+	if options.Jobs < 1 {
+		return trackSelection, errors.New("invalid number of jobs: " + strconv.Itoa(options.Jobs))
+	}
+
+	if options.DryRunFormat != "text" && options.DryRunFormat != "json" {
+		return trackSelection, errors.New("unsupported dry run format: " + options.DryRunFormat)
+	}
+
+	if options.AlbumNumber < 0 || options.DiscNumber < 0 {
+		return trackSelection, errors.New("album and disc numbers can't be negative")
+	}
+
+	if options.TrackNumberList != "" {
+		trackNumberRanges, err := libbdaudiodump.ParseTrackNumberList(options.TrackNumberList)
+		if err != nil {
+			return trackSelection, err
+		}
+		trackSelection.TrackNumberRanges = trackNumberRanges
+	}
+
+	if options.AudioStreamType != "" {
+		if options.AudioStreamType != "best" && options.AudioStreamType != "surround71" && options.AudioStreamType != "surround51" && options.AudioStreamType != "stereo21" && options.AudioStreamType != "stereo20" {
+			return trackSelection, errors.New("unsupported audio stream type: " + options.AudioStreamType)
+		}
+	}
+
+	return trackSelection, nil
+}
+
+// setMeasuredTrackDuration reads the length of a finished track's FLAC file into its report.  A
+// file that can't be read is only logged, since the track itself was still ripped.
+func setMeasuredTrackDuration(logger *slog.Logger, trackReport *libbdaudiodump.TrackReport) {
+	flacDuration, err := libbdaudiodump.GetFlacDuration(trackReport.FlacPath)
+	if err != nil {
+		logError(logger, "Unable to read FLAC duration for run report", err, "path", trackReport.FlacPath)
+		return
+	}
+
+	trackReport.SetMeasuredDuration(flacDuration)
+}
+
+// getMakemkvconSource returns the makemkvcon source for the drive the options point to, preferring
+// the device path, since it doesn't depend on the order makemkvcon lists the drives in.
+// removePreviousMkvFiles removes the MKV files a failed run kept for --resume, since replacing its
+// manifest would leave them behind.  Only a directory the rip created in the output directory is
+// removed, in case the manifest was edited.
+func removePreviousMkvFiles(logger *slog.Logger, manifestPath string, discConfig libbdaudiodump.BluRayDiscConfig, outputDirectory string) {
+	previousManifest, err := libbdaudiodump.ReadRipManifest(manifestPath, discConfig)
+	if err != nil || previousManifest.MkvBasePath == "" {
+		return
+	}
+
+	mkvBasePath := filepath.Clean(previousManifest.MkvBasePath)
+	if filepath.Dir(mkvBasePath) != filepath.Clean(outputDirectory) || !strings.HasPrefix(filepath.Base(mkvBasePath), "mkvFiles") {
+		logger.Warn("Not removing MKV files from previous run outside the output directory", "path", mkvBasePath)
+		return
+	}
+
+	logger.Info("Removing MKV files from previous run", "path", mkvBasePath)
+	os.RemoveAll(mkvBasePath)
+}
+
+func getMakemkvconSource(options ripOptions) string {
+	if options.Device != "" {
+		return libbdaudiodump.GetMakemkvconDeviceSource(options.Device)
+	}
+
+	return libbdaudiodump.GetMakemkvconDiscSource(options.MakemkvconDiscId)
+}
+
+// executeRip runs a rip, logging to the context's logger.  Errors are logged with their details
+// before they're returned.
+func executeRip(ctx context.Context, options ripOptions) error {
+	logger := libbdaudiodump.GetLogger(ctx)
+
+	trackSelection, err := checkRipOptions(options)
+	if err != nil {
+		logError(logger, "Invalid rip options", err)
+		return err
+	}
+
+	parsedConfig, err := loadConfig(logger, options.ConfigPaths)
+	if err != nil {
+		return err
+	}
+
+	var discMountPoint string
+
+	if options.DiscBasePath != "" {
+		logger.Info("Using disc base path from CLI for filesystem access", "path", options.DiscBasePath)
+		discMountPoint = options.DiscBasePath
+	} else if options.Device != "" {
+		logger.Info("Detecting volume mount point for device", "device", options.Device)
+		discMountPoint, err = libbdaudiodump.GetMountPointForDevice(ctx, options.Device)
+		if err != nil {
+			logError(logger, "Error detecting volume mount point", err)
+			return err
+		}
+	} else if options.MkvSourcePath == "" {
+		logger.Info("Detecting volume mount point for disc")
+		discMountPoint, err = libbdaudiodump.GetMountPointForMakemkvconDiscId(ctx, options.MakemkvconDiscId)
+		if err != nil {
+			logError(logger, "Error detecting volume mount point", err)
+			return err
+		}
+	}
+
+	var discConfig *libbdaudiodump.BluRayDiscConfig
+
+	if options.VolumeKeySha1 != "" {
+		logger.Info("Using volume key SHA1 hash from CLI parameters", "volume_key_sha1", options.VolumeKeySha1)
+
+		logger.Info("Looking up disc volume key SHA1 hash", "volume_key_sha1", options.VolumeKeySha1)
+
+		discConfig, err = libbdaudiodump.GetDiscConfigByVolumeKeySha1Hash(ctx, options.VolumeKeySha1, parsedConfig)
+	} else {
+		logger.Info("Identifying disc", "path", discMountPoint)
+		var discIdentifiers []libbdaudiodump.DiscIdentifier
+		discIdentifiers, err = libbdaudiodump.GetDiscIdentifiers(discMountPoint)
+		if err != nil {
+			logError(logger, "Error identifying disc", err)
+			return err
+		}
+
+		for _, discIdentifier := range discIdentifiers {
+			logger.Info("Looking up disc identifier", "identifier_type", discIdentifier.Type, "identifier", discIdentifier.Value)
+		}
+
+		discConfig, _, err = libbdaudiodump.GetDiscConfigByIdentifiers(ctx, discIdentifiers, parsedConfig)
+	}
+
+	if err != nil {
+		logError(logger, "Unable to find matching disc in config", err)
+		return err
+	}
+
+	ctx = libbdaudiodump.WithLogAttrs(ctx, libbdaudiodump.LogKeyDiscTitle, discConfig.BluRayTitle)
+	logger = libbdaudiodump.GetLogger(ctx)
+
+	err = libbdaudiodump.CheckTrackSelection(*discConfig, trackSelection)
+	if err != nil {
+		logError(logger, "Invalid track selection", err)
+		return err
+	}
+
+	if !trackSelection.IncludesAll() {
+		logger.Info("Ripping selected tracks", "titles", strings.Join(libbdaudiodump.GetSelectedTitleNumbers(*discConfig, trackSelection), ","))
+	}
+
+	if options.DryRun {
+		err = printRipPlan(ctx, options.DryRunFormat, getMakemkvconSource(options), options.OutputDirectory, options.MkvSourcePath, options.CopyDiscBeforeMkvExtraction, discMountPoint, options.CoverArtFullPath, *discConfig, trackSelection, options.AudioStreamType, options.ReplaceSpacesWithUnderscores)
+		if err != nil {
+			logError(logger, "Error generating rip plan", err)
+			return err
+		}
+		return nil
+	}
+
+	manifestPath := libbdaudiodump.GetRipManifestPath(options.OutputDirectory, *discConfig, options.ReplaceSpacesWithUnderscores)
+
+	var ripManifest *libbdaudiodump.RipManifest
+
+	if options.Resume {
+		logger.Info("Reading job manifest", "path", manifestPath)
+		ripManifest, err = libbdaudiodump.ReadRipManifest(manifestPath, *discConfig)
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				logError(logger, "Error reading job manifest", err)
+				return err
+			}
+			logger.Info("No job manifest found, starting a new rip")
+		}
+	}
+
+	if ripManifest == nil {
+		removePreviousMkvFiles(logger, manifestPath, *discConfig, options.OutputDirectory)
+
+		ripManifest = libbdaudiodump.NewRipManifest(manifestPath, *discConfig)
+		err = ripManifest.Save()
+		if err != nil {
+			logError(logger, "Error writing job manifest", err, "path", manifestPath)
+			return err
+		}
+	}
+
+	var mkvPath string
+	var mkvBasePath string
+	var discCopyTempDir string
+	ripSucceeded := false
+
+	runReport := libbdaudiodump.NewRunReport(libbdaudiodump.GetRunReportPath(options.OutputDirectory, *discConfig, options.ReplaceSpacesWithUnderscores), *discConfig, trackSelection)
+	defer func() {
+		reportPath := libbdaudiodump.GetRunReportPath(options.OutputDirectory, *discConfig, options.ReplaceSpacesWithUnderscores)
+		err := runReport.Finish(ripSucceeded)
+		if err != nil {
+			logError(logger, "Error writing run report", err, "path", reportPath)
+			return
+		}
+		logger.Info("Wrote run report", "path", reportPath)
+	}()
+	ctx = libbdaudiodump.WithObserver(ctx, runReport)
+
+	// Clean up in a fixed order: the disc copy first, then the MKV files.  Partial FLAC files
+	// are removed by the library before the stage that was writing them returns.  MKV files
+	// are kept after a failure so --resume can reuse them, but not after an interruption.
+	defer func() {
+		if ctx.Err() != nil {
+			logger.Warn("Interrupted, cleaning up temporary files")
+		}
+
+		if discCopyTempDir != "" {
+			logger.Info("Removing temp directory", "path", discCopyTempDir)
+			os.RemoveAll(discCopyTempDir)
+		}
+
+		if mkvBasePath != "" {
+			if ripSucceeded || ctx.Err() != nil || !ripManifest.MkvExtractionComplete {
+				logger.Info("Removing temp directory", "path", mkvBasePath)
+				os.RemoveAll(mkvBasePath)
+			} else {
+				logger.Info("Keeping MKV files for use with --resume", "path", mkvBasePath)
+			}
+		}
+	}()
+
+	if options.MkvSourcePath == "" {
+		if ripManifest.MkvExtractionComplete && libbdaudiodump.AllMkvFilesExist(ripManifest.MkvBasePath, *discConfig, trackSelection) {
+			logger.Info("Reusing MKV files from previous run", "path", ripManifest.MkvBasePath)
+			mkvBasePath = ripManifest.MkvBasePath
+		} else if options.CopyDiscBeforeMkvExtraction {
+			if ripManifest.MkvBasePath != "" {
+				logger.Info("Removing incomplete MKV files from previous run", "path", ripManifest.MkvBasePath)
+				os.RemoveAll(ripManifest.MkvBasePath)
+			}
+
+			logger.Info("Creating temp directory for disc copy")
+			discCopyTempDir, err = os.MkdirTemp(options.OutputDirectory, "discFiles")
+			if err != nil {
+				logError(logger, "Error creating temporary directory for disc copy", err)
+				return err
+			}
+
+			logger.Info("Created temp directory", "path", discCopyTempDir)
+
+			err = libbdaudiodump.BackupDisc(ctx, getMakemkvconSource(options), discCopyTempDir)
+			if err != nil {
+				logError(logger, "Error copying disc contents to temp directory", err)
+				return err
+			}
+
+			logger.Info("Creating temp directory for MKV files")
+
+			mkvBasePath, err = os.MkdirTemp(options.OutputDirectory, "mkvFiles")
+			if err != nil {
+				logError(logger, "Error creating temp directory for MKV files", err)
+				return err
+			}
+
+			err = ripManifest.SetMkvBasePath(mkvBasePath, false)
+			if err != nil {
+				logError(logger, "Error writing job manifest", err, "path", manifestPath)
+				return err
+			}
+
+			logger.Info("Created temp directory", "path", mkvBasePath)
+
+			err = libbdaudiodump.ExtractMkvFromBackup(ctx, discCopyTempDir, *discConfig, trackSelection, mkvBasePath)
+			if err != nil {
+				logError(logger, "Error extracting MKVs from disc copy", err)
+				return err
+			}
+
+			err = ripManifest.SetMkvBasePath(mkvBasePath, true)
+			if err != nil {
+				logError(logger, "Error writing job manifest", err, "path", manifestPath)
+				return err
+			}
+
+			logger.Info("Cleaning up copied disc files")
+
+			os.RemoveAll(discCopyTempDir)
+			discCopyTempDir = ""
+		} else {
+			if ripManifest.MkvBasePath != "" {
+				logger.Info("Removing incomplete MKV files from previous run", "path", ripManifest.MkvBasePath)
+				os.RemoveAll(ripManifest.MkvBasePath)
+			}
+
+			logger.Info("Creating temp directory for MKV files")
+
+			mkvBasePath, err = os.MkdirTemp(options.OutputDirectory, "mkvFiles")
+			if err != nil {
+				logError(logger, "Error creating temp directory for MKV files", err)
+				return err
+			}
+
+			err = ripManifest.SetMkvBasePath(mkvBasePath, false)
+			if err != nil {
+				logError(logger, "Error writing job manifest", err, "path", manifestPath)
+				return err
+			}
+
+			logger.Info("Created temp directory", "path", mkvBasePath)
+
+			err = libbdaudiodump.ExtractDiscToMkv(ctx, getMakemkvconSource(options), *discConfig, trackSelection, mkvBasePath)
+			if err != nil {
+				logError(logger, "Error using makemkv to extract disc", err)
+				return err
+			}
+
+			err = ripManifest.SetMkvBasePath(mkvBasePath, true)
+			if err != nil {
+				logError(logger, "Error writing job manifest", err, "path", manifestPath)
+				return err
+			}
+		}
+
+		firstAlbum, firstDisc, firstTrack, err := libbdaudiodump.GetFirstAlbumDiscTrack(*discConfig)
+		if err != nil {
+			logError(logger, "Error getting first album, disc, and track for BluRay disc", err)
+			return err
+		}
+
+		mkvPath, err = libbdaudiodump.GetMkvPathByTrackNumber(mkvBasePath, firstAlbum.AlbumNumber, firstDisc.DiscNumber, firstTrack.TrackNumber, *discConfig)
+		if err != nil {
+			logError(logger, "Error setting MKV destination path", err)
+			return err
+		}
+
+		mkvPath = filepath.Dir(mkvPath)
+	} else {
+		logger.Info("Using MKV path from CLI parameters", "path", options.MkvSourcePath)
+		mkvPath = options.MkvSourcePath
+	}
+
+	ffProbeData, err := libbdaudiodump.GetFfprobeDataFromSelectedMkvs(ctx, mkvPath, *discConfig, trackSelection)
+	if err != nil {
+		logError(logger, "Error reading data from generated MKV files", err)
+		return err
+	}
+
+	logger.Info("Processing albums")
+
+	coverArtPaths := make(map[int]string)
+	coverArtReports := make(map[int]*libbdaudiodump.CoverArtReport)
+
+	for _, album := range discConfig.Albums {
+		if !trackSelection.IncludesAnyTrackInAlbum(album) {
+			continue
+		}
+
+		logger.Info("Processing album", "album_title", album.AlbumTitle)
+
+		var coverArtPath string
+		var fullCoverArtDestinationPath string
+
+		if options.CoverArtFullPath != "" {
+			logger.Info("Copying cover art")
+			coverArtPath = libbdaudiodump.GetCoverArtDestinationPath(options.OutputDirectory, *discConfig, album, options.ReplaceSpacesWithUnderscores)
+			logger.Info("Cover art source", "path", options.CoverArtFullPath)
+			logger.Info("Cover art destination", "path", coverArtPath)
+			fullCoverArtDestinationPath, err = libbdaudiodump.CopyCoverImageFromFileToDestinationDirectory(options.CoverArtFullPath, coverArtPath)
+			if err != nil {
+				logError(logger, "Error copying cover art to destination", err)
+				return err
+			}
+			logger.Info("Cover art copied")
+		} else if discMountPoint != "" {
+			logger.Info("Copying cover art")
+			coverArtPath = libbdaudiodump.GetCoverArtDestinationPath(options.OutputDirectory, *discConfig, album, options.ReplaceSpacesWithUnderscores)
+			expandedCoverArtSourcePath := libbdaudiodump.GetExpandedCoverArtSourcePath(discMountPoint, album)
+			if album.CoverType == "plain" {
+				logger.Info("Cover art source", "path", expandedCoverArtSourcePath)
+				logger.Info("Cover art destination", "path", coverArtPath)
+				fullCoverArtDestinationPath, err = libbdaudiodump.CopyCoverImageFromFileToDestinationDirectory(expandedCoverArtSourcePath, coverArtPath)
+				if err != nil {
+					logError(logger, "Error copying cover art to destination", err)
+					return err
+				}
+			} else if album.CoverType == "zip" {
+				logger.Info("Cover art ZIP file", "path", expandedCoverArtSourcePath)
+				logger.Info("File in ZIP to copy from", "path", album.CoverRelativePath)
+				logger.Info("Cover art destination", "path", coverArtPath)
+				fullCoverArtDestinationPath, err = libbdaudiodump.CopyCoverImageFromZipFileToDestinationDirectory(discMountPoint, album, coverArtPath)
+				if err != nil {
+					logError(logger, "Error copying cover art to destination", err)
+					return err
+				}
+			} else if album.CoverType == "mp3" {
+				logger.Info("Cover art source (extracting from MP3)", "path", expandedCoverArtSourcePath)
+				logger.Info("Cover art destination", "path", coverArtPath)
+				fullCoverArtDestinationPath, err = libbdaudiodump.CopyCoverImageFromMp3FileToDestinationDirectory(discMountPoint, album, coverArtPath)
+				if err != nil {
+					logError(logger, "Error copying cover art to destination", err)
+					return err
+				}
+			} else if album.CoverType == "zip_mp3" {
+				logger.Info("Cover art ZIP file", "path", expandedCoverArtSourcePath)
+				logger.Info("File in ZIP to copy from (extracting from MP3)", "path", album.CoverRelativePath)
+				logger.Info("Cover art destination", "path", coverArtPath)
+				fullCoverArtDestinationPath, err = libbdaudiodump.CopyCoverImageFromZippedMp3FileToDestinationDirectory(discMountPoint, album, coverArtPath)
+				if err != nil {
+					logError(logger, "Error copying cover art to destination", err)
+					return err
+				}
+			} else if album.CoverType == "url" {
+				logger.Info("Cover art URL", "url", album.CoverUrl)
+				logger.Info("Cover art destination", "path", coverArtPath)
+				fullCoverArtDestinationPath, err = libbdaudiodump.CopyCoverImageFromUrlToDestinationDirectory(ctx, album.CoverUrl, coverArtPath)
+				if err != nil {
+					logError(logger, "Error copying cover art to destination", err)
+					return err
+				}
+			}
+			logger.Info("Cover art copied")
+		}
+
+		coverArtPaths[album.AlbumNumber] = fullCoverArtDestinationPath
+
+		if fullCoverArtDestinationPath != "" {
+			coverArtReports[album.AlbumNumber] = libbdaudiodump.GetCoverArtReport(discMountPoint, options.CoverArtFullPath, album, fullCoverArtDestinationPath)
+			runReport.SetAlbumCoverArt(album.AlbumNumber, coverArtReports[album.AlbumNumber])
+		}
+	}
+
+	logger.Info("Processing tracks", "jobs", options.Jobs)
+
+	err = libbdaudiodump.RunTrackJobs(ctx, options.Jobs, libbdaudiodump.GetSelectedTrackJobs(*discConfig, trackSelection), func(ctx context.Context, trackJob libbdaudiodump.TrackJob) (trackErr error) {
+		ctx = libbdaudiodump.WithTrackLogAttrs(ctx, trackJob.AlbumNumber, trackJob.DiscNumber, trackJob.TrackNumber)
+		logger := libbdaudiodump.GetLogger(ctx)
+
+		trackReport, err := libbdaudiodump.GetTrackReport(mkvPath, options.OutputDirectory, trackJob.AlbumNumber, trackJob.DiscNumber, trackJob.TrackNumber, ffProbeData, *discConfig, options.AudioStreamType, options.ReplaceSpacesWithUnderscores)
+		if err != nil {
+			logError(logger, "Error getting track details", err)
+			return err
+		}
+
+		trackReport.CoverArt = coverArtReports[trackJob.AlbumNumber]
+		trackReport.Status = libbdaudiodump.TrackStatusCompleted
+		defer func() {
+			if trackErr != nil {
+				trackReport.Status = libbdaudiodump.TrackStatusFailed
+				trackReport.Error = trackErr.Error()
+			}
+			runReport.SetTrackReport(*trackReport)
+		}()
+
+		flacPath := trackReport.FlacPath
+
+		trackStage := ripManifest.GetTrackStage(trackJob.AlbumNumber, trackJob.DiscNumber, trackJob.TrackNumber)
+		if trackStage != libbdaudiodump.RipStageNone {
+			if _, err := os.Stat(flacPath); err != nil {
+				logger.Info("FLAC file from previous run is missing, so processing track again", "path", flacPath)
+				trackStage = libbdaudiodump.RipStageNone
+			}
+		}
+
+		if libbdaudiodump.RipStageReached(trackStage, libbdaudiodump.RipStageTagged) {
+			logger.Info("Skipping track finished in previous run", "path", flacPath)
+			trackReport.Status = libbdaudiodump.TrackStatusSkipped
+			setMeasuredTrackDuration(logger, trackReport)
+			return nil
+		}
+
+		if !libbdaudiodump.RipStageReached(trackStage, libbdaudiodump.RipStageExtracted) {
+			err = libbdaudiodump.ExtractFlacFromMkv(ctx, mkvPath, options.OutputDirectory, trackJob.AlbumNumber, trackJob.DiscNumber, trackJob.TrackNumber, ffProbeData, *discConfig, options.AudioStreamType, options.ReplaceSpacesWithUnderscores)
+			if err != nil {
+				logError(logger, "Error extracting FLAC from MKV", err)
+				return err
+			}
+
+			err = ripManifest.SetTrackStage(trackJob.AlbumNumber, trackJob.DiscNumber, trackJob.TrackNumber, libbdaudiodump.RipStageExtracted)
+			if err != nil {
+				logError(logger, "Error writing job manifest", err, "path", manifestPath)
+				return err
+			}
+		}
+
+		if !libbdaudiodump.RipStageReached(trackStage, libbdaudiodump.RipStageCompressed) {
+			err = libbdaudiodump.CompressFlac(ctx, flacPath, trackJob.AlbumNumber, trackJob.DiscNumber, trackJob.TrackNumber)
+			if err != nil {
+				logError(logger, "Error compressing FLAC file", err, "path", flacPath)
+				return err
+			}
+
+			err = ripManifest.SetTrackStage(trackJob.AlbumNumber, trackJob.DiscNumber, trackJob.TrackNumber, libbdaudiodump.RipStageCompressed)
+			if err != nil {
+				logError(logger, "Error writing job manifest", err, "path", manifestPath)
+				return err
+			}
+		}
+
+		err = libbdaudiodump.TagFlac(ctx, options.OutputDirectory, trackJob.AlbumNumber, trackJob.DiscNumber, trackJob.TrackNumber, coverArtPaths[trackJob.AlbumNumber], *discConfig, options.ReplaceSpacesWithUnderscores)
+		if err != nil {
+			logError(logger, "Error tagging FLAC file", err, "path", flacPath)
+			return err
+		}
+
+		setMeasuredTrackDuration(logger, trackReport)
+
+		err = ripManifest.SetTrackStage(trackJob.AlbumNumber, trackJob.DiscNumber, trackJob.TrackNumber, libbdaudiodump.RipStageTagged)
+		if err != nil {
+			logError(logger, "Error writing job manifest", err, "path", manifestPath)
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		logger.Error("Stopped processing tracks after an error")
+		return err
+	}
+
+	ripSucceeded = true
+
+	return nil
+}
+
+func printRipPlan(ctx context.Context, dryRunFormat string, makemkvconSource string, outputDirectory string, mkvSourcePath string, copyDiscBeforeMkvExtraction bool, discMountPoint string, coverArtFullPath string, discConfig libbdaudiodump.BluRayDiscConfig, trackSelection libbdaudiodump.TrackSelection, audioStreamType string, replaceSpacesWithUnderscores bool) error {
+	ripPlan := libbdaudiodump.RipPlan{
+		BluRayTitle: discConfig.BluRayTitle,
+		Commands:    make([]libbdaudiodump.PlannedCommand, 0),
+		Tracks:      make([]libbdaudiodump.TrackPlan, 0),
+	}
+
+	var mkvBasePath string
+	var ffProbeData map[string][]*libbdaudiodump.FfprobeChapterInfo
+	var err error
+
+	if mkvSourcePath != "" {
+		mkvBasePath = mkvSourcePath
+
+		ffProbeData, err = libbdaudiodump.GetFfprobeDataFromSelectedMkvs(ctx, mkvBasePath, discConfig, trackSelection)
+		if err != nil {
+			return err
+		}
+	} else {
+		// The real temp directory names are only known once they're created
+		mkvBasePath = filepath.Join(outputDirectory, "mkvFiles*")
+		ripPlan.Commands, err = libbdaudiodump.GetMakemkvconPlan(makemkvconSource, copyDiscBeforeMkvExtraction, filepath.Join(outputDirectory, "discFiles*"), discConfig, trackSelection, mkvBasePath)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, album := range discConfig.Albums {
+		coverPath := ""
+		if coverArtFullPath != "" || discMountPoint != "" {
+			coverPath = libbdaudiodump.GetCoverArtDestinationPath(outputDirectory, discConfig, album, replaceSpacesWithUnderscores) + "cover.<ext>"
+		}
+
+		for _, disc := range album.Discs {
+			for _, track := range disc.Tracks {
+				if !trackSelection.Includes(album.AlbumNumber, disc.DiscNumber, track.TrackNumber) {
+					continue
+				}
+
+				trackPlan, err := libbdaudiodump.GetTrackPlan(mkvBasePath, outputDirectory, album.AlbumNumber, disc.DiscNumber, track.TrackNumber, ffProbeData, discConfig, audioStreamType, coverPath, replaceSpacesWithUnderscores)
+				if err != nil {
+					return err
+				}
+
+				ripPlan.Tracks = append(ripPlan.Tracks, *trackPlan)
+			}
+		}
+	}
+
+	if dryRunFormat == "json" {
+		ripPlanJson, err := json.MarshalIndent(ripPlan, "", "    ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(ripPlanJson))
+		return nil
+	}
+
+	fmt.Println("Rip plan for: " + ripPlan.BluRayTitle)
+
+	for _, plannedCommand := range ripPlan.Commands {
+		fmt.Println("[" + plannedCommand.Stage + "] " + libbdaudiodump.FormatCommandLine(plannedCommand.Command, plannedCommand.Args))
+	}
+
+	for _, trackPlan := range ripPlan.Tracks {
+		fmt.Println("")
+		fmt.Println("Album " + strconv.Itoa(trackPlan.AlbumNumber) + ", disc " + strconv.Itoa(trackPlan.DiscNumber) + ", track " + strconv.Itoa(trackPlan.TrackNumber) + ": " + trackPlan.TrackTitle)
+		fmt.Println("    Output: " + trackPlan.FlacPath)
+		fmt.Println("    Source: " + trackPlan.MkvPath + " (audio stream " + strconv.Itoa(trackPlan.AudioStreamNumber) + ")")
+
+		for _, plannedChapter := range trackPlan.Chapters {
+			if plannedChapter.StartTime != nil && plannedChapter.Duration != nil {
+				fmt.Printf("    Chapter %d: start %.6fs, duration %.6fs\n", plannedChapter.ChapterNumber, *plannedChapter.StartTime, *plannedChapter.Duration)
+			} else {
+				fmt.Printf("    Chapter %d: timing unknown until MKVs are probed\n", plannedChapter.ChapterNumber)
+			}
+		}
+
+		for _, plannedCommand := range trackPlan.Commands {
+			fmt.Println("    [" + plannedCommand.Stage + "] " + libbdaudiodump.FormatCommandLine(plannedCommand.Command, plannedCommand.Args))
+		}
+
+		for _, warning := range trackPlan.Warnings {
+			fmt.Println("    Warning: " + warning)
+		}
+	}
+
+	return nil
+}
+
+func printRipUsage() {
+	println("Rips a known Blu-Ray disc to tagged FLAC files")
+	println("")
+	println("Usage:")
+	println("bdaudiodump rip [arguments]")
+	println("--makemkvcon-disc-id")
+	println("    Type: Integer")
+	println("    Required if not using a device or an MKV source path. The disc ID")
+	println("    for the disc: identifier) to pass to makemkvcon.")
+	println("--device")
+	println("    Type: String")
+	println("    The device path of the drive the disc is in, such as /dev/sr0.")
+	println("    Used instead of --makemkvcon-disc-id to find where the disc is")
+	println("    mounted without asking makemkvcon, and to rip from the drive.")
+	println("--output-directory")
+	println("    Type: String")
+	println("    Required. The directory to store output in.  FLAC files will be created")
+	println("    in a directory named for the disc.  Also, the directory will be used")
+	println("    for temporary files created as part of the process.")
+	println("--volume-key-sha1")
+	println("    Type: String")
+	println("    Skip detection of the SHA1 sum of /AACS/Unit_Key_RO.inf on the disc,")
+	println("    and use the specified SHA1 sum instead.")
+	println("--replace-spaces-with-underscores")
+	println("    Type: Boolean")
+	println("    Replace spaces in directory names and FLAC file names with underscores.")
+	println("    Defaults to true.")
+	println("--mkv-source-path")
+	println("    Type: String")
+	println("    Path to pre-extracted MKVs, if MakeMKV has already been used to rip")
+	println("    them from the disc.  Minimum segment length of 0 should be used for")
+	println("    pre-extractd MKV files.")
+	println("--copy-disc-before-mkv-extraction")
+	println("    Type: Boolean")
+	println("    Some discs cause frequent seeks during MKV extraction, causing extraction")
+	println("    to fail.  This works around that by copying the disc contents and key")
+	println("    information prior to MKV extraction.  Defaults to true.")
+	println("--audio-stream-type")
+	println("    Type: String")
+	println("    Some discs offer multiple audio streams of differing channel numbers,")
+	println("    such as stereo, 5.1, 7.1, etc.  This allows specifying which streams")
+	println("    to extract.  Valid values are: best, surround71, surround51,")
+	println("    stereo21, and stereo20.  If best is selected, the best available")
+	println("    version of each track as defined in the disc configuration will be")
+	println("    selected.  For all other options, if there is no matching version")
+	println("    for a given track, the default audio stream for that track will be")
+	println("    selected.")
+	println("--disc-base-path")
+	println("    Type: String")
+	println("    The path to a mounted Blu-Ray disc, used for disc identification and")
+	println("    known cover art locations.  This overrides detected path locations.")
+	println("--cover-art-full-path")
+	println("    Type: String")
+	println("    An explicit path to a cover art file.  Overrides art locations")
+	println("    derived from the disc path.")
+	println("--dry-run")
+	println("    Type: Boolean")
+	println("    Identify the disc and print every makemkvcon, ffmpeg, flac, and")
+	println("    metaflac command a rip would run, without running them.  When")
+	println("    --mkv-source-path is used, the MKVs are probed so the plan includes")
+	println("    chapter start times and durations.")
+	println("--dry-run-format")
+	println("    Type: String")
+	println("    The output format for --dry-run.  Valid values are text and json.")
+	println("    Defaults to text.")
+	println("--jobs")
+	println("    Type: Integer")
+	println("    The number of tracks to extract, compress, and tag concurrently.")
+	println("    Cover art is always copied for each album before any tracks are")
+	println("    processed.  Defaults to 1.")
+	println("--resume")
+	println("    Type: Boolean")
+	println("    Resume a previous rip of the same disc using the job manifest stored")
+	println("    in the disc's output directory.  Finished tracks are skipped, and MKV")
+	println("    files from the previous run are reused if they are still present.")
+	println("--album")
+	println("    Type: Integer")
+	println("    Only rip tracks from this album number.")
+	println("--disc")
+	println("    Type: Integer")
+	println("    Only rip tracks from this disc number.")
+	println("--tracks")
+	println("    Type: String")
+	println("    Only rip these track numbers, as a comma-separated list of numbers")
+	println("    and ranges (for example, 3,7-9).  Combined with --album and --disc,")
+	println("    only the matching tracks are extracted, and only the titles they")
+	println("    come from are ripped with makemkvcon and probed with ffprobe.")
+	printConfigUsage()
+	printLogUsage()
+}
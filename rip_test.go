@@ -0,0 +1,82 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bdaudiodump/libbdaudiodump"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemovePreviousMkvFiles(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	discConfig := libbdaudiodump.BluRayDiscConfig{DiscVolumeKeySha1: "0123456789abcdef0123456789abcdef01234567", BluRayTitle: "Test Disc"}
+
+	tests := []struct {
+		name             string
+		mkvDirName       string
+		outsideOutput    bool
+		expectMkvRemoved bool
+	}{
+		{name: "MKV directory from a failed run", mkvDirName: "mkvFiles123", expectMkvRemoved: true},
+		{name: "directory the rip didn't create", mkvDirName: "music", expectMkvRemoved: false},
+		{name: "directory outside the output directory", mkvDirName: "mkvFiles123", outsideOutput: true, expectMkvRemoved: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			outputDirectory := t.TempDir()
+
+			mkvBasePath := filepath.Join(outputDirectory, test.mkvDirName)
+			if test.outsideOutput {
+				mkvBasePath = filepath.Join(t.TempDir(), test.mkvDirName)
+			}
+
+			err := os.MkdirAll(mkvBasePath, 0755)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			manifestPath := libbdaudiodump.GetRipManifestPath(outputDirectory, discConfig, false)
+			err = os.MkdirAll(filepath.Dir(manifestPath), 0755)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = libbdaudiodump.NewRipManifest(manifestPath, discConfig).SetMkvBasePath(mkvBasePath, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			removePreviousMkvFiles(logger, manifestPath, discConfig, outputDirectory)
+
+			_, err = os.Stat(mkvBasePath)
+			if mkvRemoved := os.IsNotExist(err); mkvRemoved != test.expectMkvRemoved {
+				t.Errorf("MKV directory removed: %v, expected %v", mkvRemoved, test.expectMkvRemoved)
+			}
+		})
+	}
+
+	// Without a previous manifest there's nothing to remove
+	removePreviousMkvFiles(logger, filepath.Join(t.TempDir(), "missing.json"), discConfig, t.TempDir())
+}
@@ -0,0 +1,510 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bdaudiodump/libbdaudiodump"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	ripJobStatusQueued    = "queued"
+	ripJobStatusRunning   = "running"
+	ripJobStatusSucceeded = "succeeded"
+	ripJobStatusFailed    = "failed"
+	ripJobStatusCancelled = "cancelled"
+)
+
+// How many events a slow subscriber can fall behind by before events are dropped for it
+const ripJobEventBufferSize = 256
+
+type ripJob struct {
+	Id         string     `json:"id"`
+	Options    ripOptions `json:"options"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	SubmitTime time.Time  `json:"submit_time"`
+	StartTime  *time.Time `json:"start_time,omitempty"`
+	EndTime    *time.Time `json:"end_time,omitempty"`
+
+	// The drive is looked up when the job is queued, since disc: IDs need makemkvcon to resolve
+	driveKey string
+}
+
+type ripJobEvent struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	Data any       `json:"data"`
+}
+
+// ripJobQueue runs submitted rips one at a time per drive, and saves every job to statePath so
+// the queue survives a restart.  Jobs that were running when the queue stopped are queued again
+// with --resume, so they pick up where they left off.
+type ripJobQueue struct {
+	ctx                context.Context
+	statePath          string
+	defaultConfigPaths []string
+	jobs               []*ripJob
+	cancelJobs         map[string]context.CancelFunc
+	subscribers        map[string][]chan ripJobEvent
+	jobWaitGroup       sync.WaitGroup
+	queueMutex         sync.Mutex
+}
+
+func newRipJobQueue(ctx context.Context, statePath string, defaultConfigPaths []string) (*ripJobQueue, error) {
+	jobQueue := &ripJobQueue{
+		ctx:                ctx,
+		statePath:          statePath,
+		defaultConfigPaths: defaultConfigPaths,
+		jobs:               make([]*ripJob, 0),
+		cancelJobs:         make(map[string]context.CancelFunc),
+		subscribers:        make(map[string][]chan ripJobEvent),
+	}
+
+	stateData, err := os.ReadFile(statePath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	if err == nil {
+		err = json.Unmarshal(stateData, &jobQueue.jobs)
+		if err != nil {
+			return nil, errors.New("unable to parse job state file: " + statePath + ": " + err.Error())
+		}
+	}
+
+	for _, job := range jobQueue.jobs {
+		if job.Status == ripJobStatusRunning {
+			job.Status = ripJobStatusQueued
+			job.Options.Resume = true
+			job.StartTime = nil
+		}
+
+		if job.Status == ripJobStatusQueued {
+			job.driveKey = getRipJobDriveKey(ctx, job.Options)
+		}
+	}
+
+	jobQueue.queueMutex.Lock()
+	defer jobQueue.queueMutex.Unlock()
+
+	err = jobQueue.save()
+	if err != nil {
+		return nil, err
+	}
+
+	jobQueue.startRunnableJobs()
+
+	return jobQueue, nil
+}
+
+// Submit queues a rip.  If the options don't name a config, the queue's default is used.
+func (jobQueue *ripJobQueue) Submit(options ripOptions) (ripJob, error) {
+	_, err := checkRipOptions(options)
+	if err != nil {
+		return ripJob{}, err
+	}
+
+	if options.DryRun {
+		return ripJob{}, errors.New("dry runs can't be submitted as jobs")
+	}
+
+	if len(options.ConfigPaths) == 0 {
+		options.ConfigPaths = jobQueue.defaultConfigPaths
+	}
+
+	driveKey := getRipJobDriveKey(jobQueue.ctx, options)
+
+	jobQueue.queueMutex.Lock()
+	defer jobQueue.queueMutex.Unlock()
+
+	job := &ripJob{
+		Id:         jobQueue.getNextJobId(),
+		Options:    options,
+		Status:     ripJobStatusQueued,
+		SubmitTime: time.Now(),
+		driveKey:   driveKey,
+	}
+	jobQueue.jobs = append(jobQueue.jobs, job)
+
+	err = jobQueue.save()
+	if err != nil {
+		jobQueue.jobs = jobQueue.jobs[:len(jobQueue.jobs)-1]
+		return ripJob{}, err
+	}
+
+	jobQueue.startRunnableJobs()
+
+	return *job, nil
+}
+
+func (jobQueue *ripJobQueue) List() []ripJob {
+	jobQueue.queueMutex.Lock()
+	defer jobQueue.queueMutex.Unlock()
+
+	jobs := make([]ripJob, 0, len(jobQueue.jobs))
+	for _, job := range jobQueue.jobs {
+		jobs = append(jobs, *job)
+	}
+
+	return jobs
+}
+
+func (jobQueue *ripJobQueue) Get(jobId string) (ripJob, bool) {
+	jobQueue.queueMutex.Lock()
+	defer jobQueue.queueMutex.Unlock()
+
+	job := jobQueue.getJob(jobId)
+	if job == nil {
+		return ripJob{}, false
+	}
+
+	return *job, true
+}
+
+// Cancel removes a queued job from the queue, or stops a running one.  A running job is only
+// marked as cancelled once it has finished cleaning up.
+func (jobQueue *ripJobQueue) Cancel(jobId string) error {
+	jobQueue.queueMutex.Lock()
+	defer jobQueue.queueMutex.Unlock()
+
+	job := jobQueue.getJob(jobId)
+	if job == nil {
+		return errors.New("no job with ID: " + jobId)
+	}
+
+	switch job.Status {
+	case ripJobStatusQueued:
+		endTime := time.Now()
+		job.Status = ripJobStatusCancelled
+		job.EndTime = &endTime
+		jobQueue.publish(job.Id, ripJobEvent{Type: "status", Time: endTime, Data: *job})
+		jobQueue.closeSubscribers(job.Id)
+		return jobQueue.save()
+	case ripJobStatusRunning:
+		jobQueue.cancelJobs[job.Id]()
+		return nil
+	}
+
+	return errors.New("job has already finished: " + jobId)
+}
+
+// Subscribe returns a channel of events for a job, along with the job as it was when the
+// subscription started.  The channel is closed when the job finishes.
+func (jobQueue *ripJobQueue) Subscribe(jobId string) (<-chan ripJobEvent, func(), ripJob, error) {
+	jobQueue.queueMutex.Lock()
+	defer jobQueue.queueMutex.Unlock()
+
+	job := jobQueue.getJob(jobId)
+	if job == nil {
+		return nil, nil, ripJob{}, errors.New("no job with ID: " + jobId)
+	}
+
+	events := make(chan ripJobEvent, ripJobEventBufferSize)
+	if job.Status != ripJobStatusQueued && job.Status != ripJobStatusRunning {
+		close(events)
+		return events, func() {}, *job, nil
+	}
+
+	jobQueue.subscribers[jobId] = append(jobQueue.subscribers[jobId], events)
+
+	unsubscribe := func() {
+		jobQueue.queueMutex.Lock()
+		defer jobQueue.queueMutex.Unlock()
+
+		subscribers := jobQueue.subscribers[jobId]
+		for i, subscriber := range subscribers {
+			if subscriber == events {
+				jobQueue.subscribers[jobId] = append(subscribers[:i:i], subscribers[i+1:]...)
+				close(events)
+				return
+			}
+		}
+	}
+
+	return events, unsubscribe, *job, nil
+}
+
+// Wait blocks until every running job has returned.
+func (jobQueue *ripJobQueue) Wait() {
+	jobQueue.jobWaitGroup.Wait()
+}
+
+// startRunnableJobs starts queued jobs in the order they were submitted, as long as no other job
+// is using the same drive.  The queue mutex must be held.
+func (jobQueue *ripJobQueue) startRunnableJobs() {
+	if jobQueue.ctx.Err() != nil {
+		return
+	}
+
+	busyDrives := make(map[string]bool)
+	for _, job := range jobQueue.jobs {
+		if job.Status == ripJobStatusRunning {
+			busyDrives[job.driveKey] = true
+		}
+	}
+
+	for _, job := range jobQueue.jobs {
+		if job.Status != ripJobStatusQueued || busyDrives[job.driveKey] {
+			continue
+		}
+
+		busyDrives[job.driveKey] = true
+
+		startTime := time.Now()
+		job.Status = ripJobStatusRunning
+		job.StartTime = &startTime
+
+		jobCtx, cancelJob := context.WithCancel(jobQueue.ctx)
+		jobQueue.cancelJobs[job.Id] = cancelJob
+		jobQueue.publish(job.Id, ripJobEvent{Type: "status", Time: startTime, Data: *job})
+
+		jobQueue.jobWaitGroup.Add(1)
+		go jobQueue.runJob(jobCtx, job.Id, job.Options)
+	}
+
+	err := jobQueue.save()
+	if err != nil {
+		libbdaudiodump.GetLogger(jobQueue.ctx).Error("Error saving job state", libbdaudiodump.LogKeyError, err.Error(), "path", jobQueue.statePath)
+	}
+}
+
+func (jobQueue *ripJobQueue) runJob(jobCtx context.Context, jobId string, options ripOptions) {
+	defer jobQueue.jobWaitGroup.Done()
+
+	jobCtx = libbdaudiodump.WithLogAttrs(jobCtx, "job_id", jobId)
+	logger := libbdaudiodump.GetLogger(jobCtx)
+	jobCtx = libbdaudiodump.WithObserver(jobCtx, newRipObserver(logger, nil))
+	jobCtx = libbdaudiodump.WithObserver(jobCtx, libbdaudiodump.ObserverFunc(func(event libbdaudiodump.Event) {
+		jobQueue.queueMutex.Lock()
+		defer jobQueue.queueMutex.Unlock()
+
+		jobQueue.publish(jobId, getRipJobEvent(event))
+	}))
+
+	logger.Info("Starting job")
+	err := executeRip(jobCtx, options)
+	wasCancelled := jobCtx.Err() != nil
+
+	jobQueue.queueMutex.Lock()
+	defer jobQueue.queueMutex.Unlock()
+
+	jobQueue.cancelJobs[jobId]()
+	delete(jobQueue.cancelJobs, jobId)
+
+	// Leave the job running in the state file if the whole queue is stopping, so it's resumed
+	// the next time the queue starts
+	if jobQueue.ctx.Err() != nil {
+		jobQueue.closeSubscribers(jobId)
+		return
+	}
+
+	job := jobQueue.getJob(jobId)
+	endTime := time.Now()
+	job.EndTime = &endTime
+
+	switch {
+	case err == nil:
+		job.Status = ripJobStatusSucceeded
+	case wasCancelled:
+		job.Status = ripJobStatusCancelled
+	default:
+		job.Status = ripJobStatusFailed
+		job.Error = err.Error()
+	}
+
+	logger.Info("Finished job", "status", job.Status)
+
+	jobQueue.publish(jobId, ripJobEvent{Type: "status", Time: endTime, Data: *job})
+	jobQueue.closeSubscribers(jobId)
+	jobQueue.startRunnableJobs()
+}
+
+// publish sends an event to a job's subscribers, dropping it for any that have fallen too far
+// behind.  The queue mutex must be held.
+func (jobQueue *ripJobQueue) publish(jobId string, event ripJobEvent) {
+	for _, subscriber := range jobQueue.subscribers[jobId] {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+func (jobQueue *ripJobQueue) closeSubscribers(jobId string) {
+	for _, subscriber := range jobQueue.subscribers[jobId] {
+		close(subscriber)
+	}
+
+	delete(jobQueue.subscribers, jobId)
+}
+
+func (jobQueue *ripJobQueue) getJob(jobId string) *ripJob {
+	for _, job := range jobQueue.jobs {
+		if job.Id == jobId {
+			return job
+		}
+	}
+
+	return nil
+}
+
+func (jobQueue *ripJobQueue) getNextJobId() string {
+	lastJobNumber := 0
+	for _, job := range jobQueue.jobs {
+		jobNumber, err := strconv.Atoi(job.Id)
+		if err == nil && jobNumber > lastJobNumber {
+			lastJobNumber = jobNumber
+		}
+	}
+
+	return strconv.Itoa(lastJobNumber + 1)
+}
+
+// save writes every job to the state file.  The queue mutex must be held.
+func (jobQueue *ripJobQueue) save() error {
+	stateData, err := json.MarshalIndent(jobQueue.jobs, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(jobQueue.statePath), 0755)
+	if err != nil {
+		return err
+	}
+
+	tempStatePath := jobQueue.statePath + ".tmp"
+	err = os.WriteFile(tempStatePath, stateData, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tempStatePath, jobQueue.statePath)
+}
+
+// getRipJobDriveKey identifies the drive a job reads from.  Jobs that rip from existing MKV
+// files don't use a drive, so they're only kept from running alongside jobs using the same files.
+// Devices are keyed by their resolved path, so /dev/cdrom, /dev/sr0, and the disc: ID makemkvcon
+// gives the same drive all share a key.
+func getRipJobDriveKey(ctx context.Context, options ripOptions) string {
+	if options.MkvSourcePath != "" {
+		return "mkv:" + filepath.Clean(options.MkvSourcePath)
+	}
+
+	if options.Device != "" {
+		return libbdaudiodump.GetMakemkvconDeviceSource(getCanonicalDevicePath(options.Device))
+	}
+
+	drives, err := libbdaudiodump.GetMakemkvconDrives(ctx)
+	if err != nil {
+		libbdaudiodump.GetLogger(ctx).Warn("Unable to look up the device for a makemkvcon disc ID", "makemkvcon_disc_id", options.MakemkvconDiscId, libbdaudiodump.LogKeyError, err.Error())
+		return libbdaudiodump.GetMakemkvconDiscSource(options.MakemkvconDiscId)
+	}
+
+	for _, drive := range drives {
+		if drive.Index == options.MakemkvconDiscId && drive.DevicePath != "" {
+			return libbdaudiodump.GetMakemkvconDeviceSource(getCanonicalDevicePath(drive.DevicePath))
+		}
+	}
+
+	return libbdaudiodump.GetMakemkvconDiscSource(options.MakemkvconDiscId)
+}
+
+func getCanonicalDevicePath(devicePath string) string {
+	canonicalDevicePath, err := filepath.EvalSymlinks(devicePath)
+	if err != nil {
+		return filepath.Clean(devicePath)
+	}
+
+	return canonicalDevicePath
+}
+
+func getRipJobEvent(event libbdaudiodump.Event) ripJobEvent {
+	jobEvent := ripJobEvent{Time: time.Now()}
+
+	switch typedEvent := event.(type) {
+	case libbdaudiodump.DiscIdentifiedEvent:
+		jobEvent.Type = "disc_identified"
+		eventData := map[string]any{"disc_volume_key_sha1": typedEvent.DiscVolumeKeySha1, "bluray_title": typedEvent.BluRayTitle}
+		if typedEvent.VariantName != "" {
+			eventData["variant_name"] = typedEvent.VariantName
+		}
+		jobEvent.Data = eventData
+	case libbdaudiodump.StageStartedEvent:
+		jobEvent.Type = "stage_started"
+		jobEvent.Data = getRipJobStageEventData(typedEvent.Stage, typedEvent.Track)
+	case libbdaudiodump.StageFinishedEvent:
+		jobEvent.Type = "stage_finished"
+		eventData := getRipJobStageEventData(typedEvent.Stage, typedEvent.Track)
+		eventData["duration_s"] = typedEvent.Duration.Seconds()
+		if typedEvent.Err != nil {
+			eventData["error"] = typedEvent.Err.Error()
+		}
+		jobEvent.Data = eventData
+	case libbdaudiodump.TrackCompletedEvent:
+		jobEvent.Type = "track_completed"
+		eventData := getRipJobStageEventData("", typedEvent.Track)
+		eventData["flac_path"] = typedEvent.FlacPath
+		eventData["duration_s"] = typedEvent.Duration.Seconds()
+		jobEvent.Data = eventData
+	case libbdaudiodump.WarningEvent:
+		jobEvent.Type = "warning"
+		eventData := getRipJobStageEventData(typedEvent.Stage, typedEvent.Track)
+		eventData["message"] = typedEvent.Message
+		jobEvent.Data = eventData
+	case libbdaudiodump.MakemkvconProgress:
+		jobEvent.Type = "makemkvcon_progress"
+		jobEvent.Data = map[string]any{"current_operation": typedEvent.CurrentOperation, "current_fraction": typedEvent.CurrentFraction(), "total_operation": typedEvent.TotalOperation, "total_fraction": typedEvent.TotalFraction()}
+	case libbdaudiodump.MakemkvconOperation:
+		jobEvent.Type = "makemkvcon_operation"
+		jobEvent.Data = map[string]any{"is_total": typedEvent.IsTotal, "code": typedEvent.Code, "name": typedEvent.Name}
+	case libbdaudiodump.MakemkvconMessage:
+		jobEvent.Type = "makemkvcon_message"
+		jobEvent.Data = map[string]any{"code": typedEvent.Code, "flags": typedEvent.Flags, "message": typedEvent.Message}
+	default:
+		jobEvent.Type = "unknown"
+	}
+
+	return jobEvent
+}
+
+func getRipJobStageEventData(stage string, trackJob libbdaudiodump.TrackJob) map[string]any {
+	eventData := make(map[string]any)
+
+	if stage != "" {
+		eventData["stage"] = stage
+	}
+
+	if trackJob.TrackNumber != 0 {
+		eventData["album_number"] = trackJob.AlbumNumber
+		eventData["disc_number"] = trackJob.DiscNumber
+		eventData["track_number"] = trackJob.TrackNumber
+	}
+
+	return eventData
+}
@@ -0,0 +1,337 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bdaudiodump/libbdaudiodump"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// The first disc in the bundled config, which the test jobs rip
+const testRipJobVolumeKeySha1 = "2772dbbf5cc160aa16adc39787cfb2b0dc6429e9"
+
+// newTestRipJobContext returns a context whose makemkvcon lists two drives without device paths,
+// and holds every rip in progress until releaseRips is closed.  The rips then fail, so the jobs
+// don't go any further.
+func newTestRipJobContext(t *testing.T) (context.Context, *libbdaudiodump.FakeCommandRunner, chan struct{}) {
+	releaseRips := make(chan struct{})
+
+	fakeCommandRunner := &libbdaudiodump.FakeCommandRunner{
+		Commands: []libbdaudiodump.FakeCommand{
+			{
+				Name:   "makemkvcon",
+				Args:   libbdaudiodump.GetMakemkvconInfoArgs(),
+				Output: "DRV:0,2,999,12,\"BD-RE DRIVE\",\"DISC\",\"\"\nDRV:1,2,999,12,\"BD-RE DRIVE\",\"DISC\",\"\"\n",
+			},
+			{Name: "makemkvcon", Output: "MSG:5010,0,0,\"Failed to open disc\",\"Failed to open disc\"", ExitCode: 1, Wait: releaseRips},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(libbdaudiodump.WithCommandRunner(context.Background(), fakeCommandRunner))
+	t.Cleanup(cancel)
+
+	return ctx, fakeCommandRunner, releaseRips
+}
+
+func newTestRipJobOptions(t *testing.T, makemkvconDiscId int) ripOptions {
+	options := getDefaultRipOptions()
+	options.OutputDirectory = t.TempDir()
+	options.ConfigPaths = []string{filepath.Join("config", "bdaudiodump_config.json")}
+	options.MakemkvconDiscId = makemkvconDiscId
+	options.DiscBasePath = t.TempDir()
+	options.VolumeKeySha1 = testRipJobVolumeKeySha1
+	options.TrackNumberList = "1"
+
+	return options
+}
+
+func waitForRipJobStatus(t *testing.T, jobQueue *ripJobQueue, jobId string, status string) ripJob {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		job, found := jobQueue.Get(jobId)
+		if !found {
+			t.Fatalf("job %s not found", jobId)
+		}
+
+		if job.Status == status {
+			return job
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s is %s, expected %s: %+v", jobId, job.Status, status, job)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func countMkvRips(fakeCommandRunner *libbdaudiodump.FakeCommandRunner) int {
+	mkvRips := 0
+	for _, call := range fakeCommandRunner.GetCalls() {
+		if call.Name == "makemkvcon" && len(call.Args) > 0 && call.Args[len(call.Args)-1] != "info" {
+			mkvRips++
+		}
+	}
+
+	return mkvRips
+}
+
+func TestRipJobQueueRunsOneJobPerDrive(t *testing.T) {
+	ctx, fakeCommandRunner, releaseRips := newTestRipJobContext(t)
+
+	jobQueue, err := newRipJobQueue(ctx, filepath.Join(t.TempDir(), "jobs.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jobQueue.Wait()
+
+	firstJob, err := jobQueue.Submit(newTestRipJobOptions(t, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sameDriveJob, err := jobQueue.Submit(newTestRipJobOptions(t, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherDriveJob, err := jobQueue.Submit(newTestRipJobOptions(t, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitForRipJobStatus(t, jobQueue, firstJob.Id, ripJobStatusRunning)
+	waitForRipJobStatus(t, jobQueue, otherDriveJob.Id, ripJobStatusRunning)
+
+	// Both running jobs have to reach makemkvcon before the queued one is checked again
+	for countMkvRips(fakeCommandRunner) < 2 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if job, _ := jobQueue.Get(sameDriveJob.Id); job.Status != ripJobStatusQueued {
+		t.Errorf("job for a busy drive is %s, expected it to be queued", job.Status)
+	}
+
+	close(releaseRips)
+
+	finishedFirstJob := waitForRipJobStatus(t, jobQueue, firstJob.Id, ripJobStatusFailed)
+	finishedSameDriveJob := waitForRipJobStatus(t, jobQueue, sameDriveJob.Id, ripJobStatusFailed)
+	waitForRipJobStatus(t, jobQueue, otherDriveJob.Id, ripJobStatusFailed)
+
+	if finishedSameDriveJob.StartTime.Before(*finishedFirstJob.EndTime) {
+		t.Errorf("job for the same drive started at %v, before the first job finished at %v", finishedSameDriveJob.StartTime, finishedFirstJob.EndTime)
+	}
+
+	if countMkvRips(fakeCommandRunner) != 3 {
+		t.Errorf("expected 3 rips, got %d", countMkvRips(fakeCommandRunner))
+	}
+}
+
+func TestRipJobQueueCancel(t *testing.T) {
+	ctx, fakeCommandRunner, releaseRips := newTestRipJobContext(t)
+	defer close(releaseRips)
+
+	jobQueue, err := newRipJobQueue(ctx, filepath.Join(t.TempDir(), "jobs.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jobQueue.Wait()
+
+	runningJob, err := jobQueue.Submit(newTestRipJobOptions(t, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queuedJob, err := jobQueue.Submit(newTestRipJobOptions(t, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitForRipJobStatus(t, jobQueue, runningJob.Id, ripJobStatusRunning)
+	for countMkvRips(fakeCommandRunner) < 1 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	err = jobQueue.Cancel(queuedJob.Id)
+	if err != nil {
+		t.Fatalf("unexpected error cancelling a queued job: %v", err)
+	}
+
+	if job, _ := jobQueue.Get(queuedJob.Id); job.Status != ripJobStatusCancelled || job.EndTime == nil {
+		t.Errorf("expected the queued job to be cancelled right away, got %+v", job)
+	}
+
+	err = jobQueue.Cancel(runningJob.Id)
+	if err != nil {
+		t.Fatalf("unexpected error cancelling a running job: %v", err)
+	}
+
+	waitForRipJobStatus(t, jobQueue, runningJob.Id, ripJobStatusCancelled)
+
+	err = jobQueue.Cancel(runningJob.Id)
+	if err == nil {
+		t.Error("expected an error cancelling a job that has already finished")
+	}
+
+	err = jobQueue.Cancel("100")
+	if err == nil {
+		t.Error("expected an error cancelling a job that doesn't exist")
+	}
+
+	// The cancelled job held the drive, so the queued job would have started if it was still queued
+	if countMkvRips(fakeCommandRunner) != 1 {
+		t.Errorf("expected only the running job to rip, got %d rips", countMkvRips(fakeCommandRunner))
+	}
+}
+
+func TestRipJobQueueResumesRunningJobsAfterRestart(t *testing.T) {
+	ctx, _, releaseRips := newTestRipJobContext(t)
+	defer close(releaseRips)
+
+	statePath := filepath.Join(t.TempDir(), "jobs.json")
+
+	queueCtx, stopQueue := context.WithCancel(ctx)
+	jobQueue, err := newRipJobQueue(queueCtx, statePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runningJob, err := jobQueue.Submit(newTestRipJobOptions(t, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queuedJob, err := jobQueue.Submit(newTestRipJobOptions(t, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitForRipJobStatus(t, jobQueue, runningJob.Id, ripJobStatusRunning)
+
+	stopQueue()
+	jobQueue.Wait()
+
+	stateData, err := os.ReadFile(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var savedJobs []ripJob
+	err = json.Unmarshal(stateData, &savedJobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(savedJobs) != 2 || savedJobs[0].Status != ripJobStatusRunning || savedJobs[1].Status != ripJobStatusQueued {
+		t.Fatalf("expected the stopped job to be saved as running, got %+v", savedJobs)
+	}
+
+	// A stopped context keeps the restarted queue from starting the jobs again
+	restartCtx, stopRestartedQueue := context.WithCancel(ctx)
+	stopRestartedQueue()
+
+	restartedQueue, err := newRipJobQueue(restartCtx, statePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resumedJob, _ := restartedQueue.Get(runningJob.Id)
+	if resumedJob.Status != ripJobStatusQueued || !resumedJob.Options.Resume || resumedJob.StartTime != nil {
+		t.Errorf("expected the running job to be queued again with resume, got %+v", resumedJob)
+	}
+
+	stillQueuedJob, _ := restartedQueue.Get(queuedJob.Id)
+	if stillQueuedJob.Status != ripJobStatusQueued || stillQueuedJob.Options.Resume {
+		t.Errorf("expected the queued job to be unchanged, got %+v", stillQueuedJob)
+	}
+
+	nextJob, err := restartedQueue.Submit(newTestRipJobOptions(t, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if nextJob.Id != "3" {
+		t.Errorf("expected job IDs to carry on from the saved jobs, got %s", nextJob.Id)
+	}
+}
+
+func TestGetRipJobDriveKey(t *testing.T) {
+	tempDir := t.TempDir()
+	devicePath := filepath.Join(tempDir, "sr0")
+	deviceLinkPath := filepath.Join(tempDir, "cdrom")
+
+	err := os.WriteFile(devicePath, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Symlink(devicePath, deviceLinkPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The temporary directory can itself be under a symlink, like /tmp on macOS
+	resolvedDevicePath, err := filepath.EvalSymlinks(devicePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fakeCommandRunner := &libbdaudiodump.FakeCommandRunner{
+		Commands: []libbdaudiodump.FakeCommand{{
+			Name: "makemkvcon",
+			Args: libbdaudiodump.GetMakemkvconInfoArgs(),
+			Output: "DRV:0,2,999,12,\"BD-RE DRIVE\",\"MY DISC\",\"" + deviceLinkPath + "\"\n" +
+				"DRV:1,256,999,0,\"\",\"\",\"\"\n",
+		}},
+	}
+	ctx := libbdaudiodump.WithCommandRunner(context.Background(), fakeCommandRunner)
+
+	deviceKey := getRipJobDriveKey(ctx, ripOptions{Device: devicePath})
+	if deviceKey != "dev:"+resolvedDevicePath {
+		t.Errorf("unexpected key for the device: %s", deviceKey)
+	}
+
+	linkKey := getRipJobDriveKey(ctx, ripOptions{Device: deviceLinkPath})
+	if linkKey != deviceKey {
+		t.Errorf("key for the device symlink, %s, doesn't match the device's key, %s", linkKey, deviceKey)
+	}
+
+	discIdKey := getRipJobDriveKey(ctx, ripOptions{MakemkvconDiscId: 0})
+	if discIdKey != deviceKey {
+		t.Errorf("key for the disc ID, %s, doesn't match the device's key, %s", discIdKey, deviceKey)
+	}
+
+	unknownDiscIdKey := getRipJobDriveKey(ctx, ripOptions{MakemkvconDiscId: 1})
+	if unknownDiscIdKey != "disc:1" {
+		t.Errorf("unexpected key for a disc ID without a device: %s", unknownDiscIdKey)
+	}
+
+	mkvKey := getRipJobDriveKey(ctx, ripOptions{MkvSourcePath: tempDir + "/mkvs/", Device: devicePath})
+	if mkvKey != "mkv:"+filepath.Join(tempDir, "mkvs") {
+		t.Errorf("unexpected key for an MKV source: %s", mkvKey)
+	}
+}
@@ -0,0 +1,384 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// How long open requests, such as event streams, get to finish when the server stops
+const serveShutdownTimeout = 5 * time.Second
+
+func runServe(ctx context.Context, args []string) int {
+	flagSet := flag.NewFlagSet("serve", flag.ContinueOnError)
+	flagSet.Usage = printServeUsage
+
+	listenAddress := flagSet.String("listen", "localhost:8780", "The address to listen for API requests on")
+	statePath := flagSet.String("state-path", "", "The file to save the job queue in")
+	configPaths := make([]string, 0)
+	addConfigPathFlag(flagSet, &configPaths)
+	logOptions := addLogFlags(flagSet)
+
+	err := flagSet.Parse(args)
+	if err != nil {
+		return getFlagParseExitCode(err)
+	}
+
+	ctx, logger, closeLogFile, err := setUpLogging(ctx, logOptions)
+	if err != nil {
+		println(err.Error())
+		printServeUsage()
+		return 1
+	}
+	defer closeLogFile()
+
+	if *statePath == "" {
+		*statePath, err = getDefaultJobStatePath()
+		if err != nil {
+			logger.Error("Unable to get your home directory to save jobs in")
+			return 1
+		}
+	}
+
+	// Check the config up front, even though each job reads it again when it starts
+	_, err = loadConfig(logger, configPaths)
+	if err != nil {
+		return 1
+	}
+
+	jobQueue, err := newRipJobQueue(ctx, *statePath, configPaths)
+	if err != nil {
+		logError(logger, "Error loading job queue", err, "path", *statePath)
+		return 1
+	}
+
+	server := &http.Server{
+		Addr:    *listenAddress,
+		Handler: newServeHandler(jobQueue, *listenAddress),
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+
+	if !isLoopbackListenAddress(*listenAddress) {
+		logger.Warn("The API has no authentication, and is listening on an address other machines can reach", "address", *listenAddress)
+	}
+
+	serverErrors := make(chan error, 1)
+	go func() {
+		logger.Info("Listening for API requests", "address", *listenAddress)
+		serverErrors <- server.ListenAndServe()
+	}()
+
+	exitCode := 0
+
+	select {
+	case err = <-serverErrors:
+		logError(logger, "Error running API server", err)
+		exitCode = 1
+	case <-ctx.Done():
+		logger.Info("Stopping API server")
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), serveShutdownTimeout)
+	defer cancelShutdown()
+	server.Shutdown(shutdownCtx)
+
+	// Running jobs are stopped by the same signal as the server, and are resumed on the next start
+	jobQueue.Wait()
+
+	return exitCode
+}
+
+func getDefaultJobStatePath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return homeDir + string(os.PathSeparator) + ".config" + string(os.PathSeparator) + "bdaudiodump_jobs.json", nil
+}
+
+// newServeHandler routes the job API:
+//
+//	GET  /jobs               list jobs
+//	POST /jobs               submit a job
+//	GET  /jobs/<id>          show a job
+//	GET  /jobs/<id>/events   stream a job's events with server-sent events
+//	POST /jobs/<id>/cancel   cancel a job
+//
+// Requests are only answered for the loopback names and the host in listenAddress.
+func newServeHandler(jobQueue *ripJobQueue, listenAddress string) http.Handler {
+	serveMux := http.NewServeMux()
+
+	serveMux.HandleFunc("/jobs", func(responseWriter http.ResponseWriter, request *http.Request) {
+		switch request.Method {
+		case http.MethodGet:
+			writeJsonResponse(responseWriter, http.StatusOK, jobQueue.List())
+		case http.MethodPost:
+			handleSubmitJob(jobQueue, responseWriter, request)
+		default:
+			writeJsonError(responseWriter, http.StatusMethodNotAllowed, errors.New("unsupported method: "+request.Method))
+		}
+	})
+
+	serveMux.HandleFunc("/jobs/", func(responseWriter http.ResponseWriter, request *http.Request) {
+		jobId, action, _ := strings.Cut(strings.TrimPrefix(request.URL.Path, "/jobs/"), "/")
+
+		switch {
+		case action == "" && request.Method == http.MethodGet:
+			job, found := jobQueue.Get(jobId)
+			if !found {
+				writeJsonError(responseWriter, http.StatusNotFound, errors.New("no job with ID: "+jobId))
+				return
+			}
+			writeJsonResponse(responseWriter, http.StatusOK, job)
+		case action == "events" && request.Method == http.MethodGet:
+			handleJobEvents(jobQueue, jobId, responseWriter, request)
+		case action == "cancel" && request.Method == http.MethodPost:
+			err := checkRequestOrigin(request)
+			if err != nil {
+				writeJsonError(responseWriter, http.StatusForbidden, err)
+				return
+			}
+
+			if _, found := jobQueue.Get(jobId); !found {
+				writeJsonError(responseWriter, http.StatusNotFound, errors.New("no job with ID: "+jobId))
+				return
+			}
+
+			err = jobQueue.Cancel(jobId)
+			if err != nil {
+				writeJsonError(responseWriter, http.StatusConflict, err)
+				return
+			}
+
+			job, _ := jobQueue.Get(jobId)
+			writeJsonResponse(responseWriter, http.StatusAccepted, job)
+		default:
+			writeJsonError(responseWriter, http.StatusNotFound, errors.New("not found: "+request.Method+" "+request.URL.Path))
+		}
+	})
+
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		err := checkRequestHost(request, listenAddress)
+		if err != nil {
+			writeJsonError(responseWriter, http.StatusForbidden, err)
+			return
+		}
+
+		serveMux.ServeHTTP(responseWriter, request)
+	})
+}
+
+// handleSubmitJob takes the same options as the rip command, as JSON.  Options that are left out
+// get the same defaults as the command's flags.
+func handleSubmitJob(jobQueue *ripJobQueue, responseWriter http.ResponseWriter, request *http.Request) {
+	err := checkRequestOrigin(request)
+	if err != nil {
+		writeJsonError(responseWriter, http.StatusForbidden, err)
+		return
+	}
+
+	// Browsers send form posts without asking first, so only JSON is accepted
+	mediaType, _, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		writeJsonError(responseWriter, http.StatusUnsupportedMediaType, errors.New("jobs must be submitted as application/json"))
+		return
+	}
+
+	options := getDefaultRipOptions()
+
+	requestDecoder := json.NewDecoder(request.Body)
+	requestDecoder.DisallowUnknownFields()
+
+	err = requestDecoder.Decode(&options)
+	if err != nil {
+		writeJsonError(responseWriter, http.StatusBadRequest, errors.New("invalid job: "+err.Error()))
+		return
+	}
+
+	job, err := jobQueue.Submit(options)
+	if err != nil {
+		writeJsonError(responseWriter, http.StatusBadRequest, err)
+		return
+	}
+
+	writeJsonResponse(responseWriter, http.StatusCreated, job)
+}
+
+// checkRequestHost stops DNS rebinding, where a web page gets its own host name to resolve to
+// this machine, so the browser treats the API as part of the page's site.
+func checkRequestHost(request *http.Request, listenAddress string) error {
+	hostName, _, err := net.SplitHostPort(request.Host)
+	if err != nil {
+		hostName = strings.TrimSuffix(strings.TrimPrefix(request.Host, "["), "]")
+	}
+
+	if isLoopbackHostName(hostName) {
+		return nil
+	}
+
+	listenHostName, _, err := net.SplitHostPort(listenAddress)
+	if err == nil && listenHostName != "" && strings.EqualFold(hostName, listenHostName) {
+		return nil
+	}
+
+	return errors.New("requests for this host aren't allowed: " + request.Host)
+}
+
+func isLoopbackHostName(hostName string) bool {
+	if strings.EqualFold(hostName, "localhost") {
+		return true
+	}
+
+	ip := net.ParseIP(hostName)
+	return ip != nil && ip.IsLoopback()
+}
+
+func isLoopbackListenAddress(listenAddress string) bool {
+	listenHostName, _, err := net.SplitHostPort(listenAddress)
+	return err == nil && isLoopbackHostName(listenHostName)
+}
+
+// checkRequestOrigin stops web pages on other sites from starting or cancelling rips through a
+// browser.  Requests without an Origin, like those from curl or scripts, are allowed.
+func checkRequestOrigin(request *http.Request) error {
+	origin := request.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+
+	originUrl, err := url.Parse(origin)
+	if err != nil || originUrl.Host != request.Host {
+		return errors.New("requests from another origin aren't allowed: " + origin)
+	}
+
+	return nil
+}
+
+func handleJobEvents(jobQueue *ripJobQueue, jobId string, responseWriter http.ResponseWriter, request *http.Request) {
+	flusher, ok := responseWriter.(http.Flusher)
+	if !ok {
+		writeJsonError(responseWriter, http.StatusInternalServerError, errors.New("streaming isn't supported"))
+		return
+	}
+
+	events, unsubscribe, job, err := jobQueue.Subscribe(jobId)
+	if err != nil {
+		writeJsonError(responseWriter, http.StatusNotFound, err)
+		return
+	}
+	defer unsubscribe()
+
+	responseWriter.Header().Set("Content-Type", "text/event-stream")
+	responseWriter.Header().Set("Cache-Control", "no-cache")
+	responseWriter.WriteHeader(http.StatusOK)
+
+	writeServerSentEvent(responseWriter, ripJobEvent{Type: "status", Time: time.Now(), Data: job})
+	flusher.Flush()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			writeServerSentEvent(responseWriter, event)
+			flusher.Flush()
+		case <-request.Context().Done():
+			return
+		}
+	}
+}
+
+func writeServerSentEvent(responseWriter http.ResponseWriter, event ripJobEvent) {
+	eventData, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	fmt.Fprintf(responseWriter, "event: %s\ndata: %s\n\n", event.Type, eventData)
+}
+
+func writeJsonResponse(responseWriter http.ResponseWriter, statusCode int, value any) {
+	responseData, err := json.MarshalIndent(value, "", "    ")
+	if err != nil {
+		responseWriter.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	responseWriter.Header().Set("Content-Type", "application/json")
+	responseWriter.WriteHeader(statusCode)
+	responseWriter.Write(append(responseData, '\n'))
+}
+
+func writeJsonError(responseWriter http.ResponseWriter, statusCode int, err error) {
+	writeJsonResponse(responseWriter, statusCode, map[string]string{"error": err.Error()})
+}
+
+func printServeUsage() {
+	println("Runs a local HTTP API for queueing rips")
+	println("")
+	println("Usage:")
+	println("bdaudiodump serve [arguments]")
+	println("")
+	println("Jobs are submitted as JSON with the same options as the rip command, using")
+	println("underscores instead of dashes (for example, output_directory).  Jobs using")
+	println("the same drive run one at a time, and jobs that were running when the")
+	println("server stopped are resumed when it starts again.")
+	println("")
+	println("    GET  /jobs               List jobs")
+	println("    POST /jobs               Submit a job")
+	println("    GET  /jobs/<id>          Show a job")
+	println("    GET  /jobs/<id>/events   Stream a job's progress as server-sent events")
+	println("    POST /jobs/<id>/cancel   Cancel a job")
+	println("")
+	println("--listen")
+	println("    Type: String")
+	println("    The address to listen for API requests on.  Defaults to")
+	println("    localhost:8780.  The API has no authentication, so only listen on")
+	println("    another address on a network you trust.  Requests are only answered")
+	println("    when they're addressed to localhost or the host given here.")
+	println("--state-path")
+	println("    Type: String")
+	println("    The file to save the job queue in.  If not specified, it defaults to:")
+	println("    ~/.config/bdaudiodump_jobs.json")
+	println("--config-path")
+	println("    Type: String")
+	println("    An explicit path to a disc configuration JSON file, or a directory of")
+	println("    them, used by jobs that don't specify any.  Can be given more than once.")
+	println("    If not specified, it defaults to both of these, if they exist:")
+	println("    ~/.config/bdaudiodump_config.json")
+	println("    ~/.config/bdaudiodump.d/")
+	printLogUsage()
+}
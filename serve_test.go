@@ -0,0 +1,113 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleSubmitJobRejectsForeignRequests(t *testing.T) {
+	tests := []struct {
+		name               string
+		contentType        string
+		origin             string
+		expectedStatusCode int
+	}{
+		{name: "form post", contentType: "application/x-www-form-urlencoded", expectedStatusCode: http.StatusUnsupportedMediaType},
+		{name: "plain text", contentType: "text/plain", expectedStatusCode: http.StatusUnsupportedMediaType},
+		{name: "no content type", expectedStatusCode: http.StatusUnsupportedMediaType},
+		{name: "foreign origin", contentType: "application/json", origin: "https://example.com", expectedStatusCode: http.StatusForbidden},
+		{name: "null origin", contentType: "application/json", origin: "null", expectedStatusCode: http.StatusForbidden},
+		{name: "same origin with an invalid job", contentType: "application/json; charset=utf-8", origin: "http://localhost:8780", expectedStatusCode: http.StatusBadRequest},
+		{name: "no origin with an invalid job", contentType: "application/json", expectedStatusCode: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "http://localhost:8780/jobs", strings.NewReader(`{"unknown_option": true}`))
+			if test.contentType != "" {
+				request.Header.Set("Content-Type", test.contentType)
+			}
+			if test.origin != "" {
+				request.Header.Set("Origin", test.origin)
+			}
+
+			// The job queue isn't needed, since none of these requests get as far as submitting a job
+			responseRecorder := httptest.NewRecorder()
+			handleSubmitJob(nil, responseRecorder, request)
+
+			if responseRecorder.Code != test.expectedStatusCode {
+				t.Errorf("got status %d, expected %d: %s", responseRecorder.Code, test.expectedStatusCode, responseRecorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestServeHandlerRejectsForeignHosts(t *testing.T) {
+	tests := []struct {
+		name               string
+		listenAddress      string
+		host               string
+		expectedStatusCode int
+	}{
+		{name: "localhost", listenAddress: "localhost:8780", host: "localhost:8780", expectedStatusCode: http.StatusMethodNotAllowed},
+		{name: "IPv4 loopback", listenAddress: "localhost:8780", host: "127.0.0.1:8780", expectedStatusCode: http.StatusMethodNotAllowed},
+		{name: "IPv6 loopback", listenAddress: "localhost:8780", host: "[::1]:8780", expectedStatusCode: http.StatusMethodNotAllowed},
+		{name: "loopback without a port", listenAddress: "localhost:8780", host: "localhost", expectedStatusCode: http.StatusMethodNotAllowed},
+		{name: "listen host", listenAddress: "ripstation.lan:8780", host: "RipStation.lan:8780", expectedStatusCode: http.StatusMethodNotAllowed},
+		{name: "rebound host name", listenAddress: "localhost:8780", host: "attacker.example:8780", expectedStatusCode: http.StatusForbidden},
+		{name: "other host while listening on every address", listenAddress: ":8780", host: "192.168.1.20:8780", expectedStatusCode: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// An unsupported method is answered before the job queue is used
+			request := httptest.NewRequest(http.MethodDelete, "http://localhost:8780/jobs", nil)
+			request.Host = test.host
+
+			responseRecorder := httptest.NewRecorder()
+			newServeHandler(nil, test.listenAddress).ServeHTTP(responseRecorder, request)
+
+			if responseRecorder.Code != test.expectedStatusCode {
+				t.Errorf("got status %d, expected %d: %s", responseRecorder.Code, test.expectedStatusCode, responseRecorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestIsLoopbackListenAddress(t *testing.T) {
+	tests := map[string]bool{
+		"localhost:8780":      true,
+		"127.0.0.1:8780":      true,
+		"[::1]:8780":          true,
+		":8780":               false,
+		"0.0.0.0:8780":        false,
+		"ripstation.lan:8780": false,
+	}
+
+	for listenAddress, expected := range tests {
+		if isLoopbackListenAddress(listenAddress) != expected {
+			t.Errorf("%s: expected %v", listenAddress, expected)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bdaudiodump/libbdaudiodump"
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func runValidate(ctx context.Context, args []string) int {
+	flagSet := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flagSet.Usage = printValidateUsage
+
+	configPaths := make([]string, 0)
+	addConfigPathFlag(flagSet, &configPaths)
+	logOptions := addLogFlags(flagSet)
+
+	err := flagSet.Parse(args)
+	if err != nil {
+		return getFlagParseExitCode(err)
+	}
+
+	_, logger, closeLogFile, err := setUpLogging(ctx, logOptions)
+	if err != nil {
+		println(err.Error())
+		printValidateUsage()
+		return 1
+	}
+	defer closeLogFile()
+
+	validatePaths := configPaths
+	if len(validatePaths) == 0 {
+		validatePaths, err = getDefaultConfigPaths()
+		if err != nil {
+			logger.Error("Unable to get your home directory to read config from")
+			return 1
+		}
+	}
+
+	parsedConfig, configIssues, err := libbdaudiodump.ValidateConfigPaths(validatePaths)
+	if err != nil {
+		logError(logger, "Error reading config", err, "path", strings.Join(validatePaths, ", "))
+		return 1
+	}
+
+	for _, configIssue := range configIssues {
+		fmt.Println(configIssue.String())
+	}
+
+	errorCount := len(libbdaudiodump.GetConfigIssuesBySeverity(configIssues, libbdaudiodump.ConfigIssueSeverityError))
+	warningCount := len(libbdaudiodump.GetConfigIssuesBySeverity(configIssues, libbdaudiodump.ConfigIssueSeverityWarning))
+
+	if errorCount > 0 {
+		fmt.Println("Config is invalid: " + strings.Join(validatePaths, ", ") + " (" + strconv.Itoa(errorCount) + " errors, " + strconv.Itoa(warningCount) + " warnings)")
+		return 1
+	}
+
+	fmt.Println("Config is valid: " + strings.Join(validatePaths, ", ") + " (" + strconv.Itoa(len(*parsedConfig)) + " discs, " + strconv.Itoa(warningCount) + " warnings)")
+
+	return 0
+}
+
+func printValidateUsage() {
+	println("Checks config files for errors")
+	println("")
+	println("Usage:")
+	println("bdaudiodump validate [arguments]")
+	println("")
+	println("Every problem is listed with its line and column and a JSON pointer to")
+	println("the value, and the exit status is non-zero if there are any errors.")
+	println("Warnings are listed, but don't make the config invalid.  When there")
+	println("are several config files, each is checked and their discs are merged, so")
+	println("a disc that's in more than one file is reported too.")
+	printConfigUsage()
+	printLogUsage()
+}
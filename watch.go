@@ -0,0 +1,248 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bdaudiodump/libbdaudiodump"
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"os"
+	"time"
+)
+
+func runWatch(ctx context.Context, args []string) int {
+	flagSet := flag.NewFlagSet("watch", flag.ContinueOnError)
+	flagSet.Usage = printWatchUsage
+
+	libraryRoot := flagSet.String("library-root", "", "The directory to rip discs into")
+	pollInterval := flagSet.Duration("poll-interval", 5*time.Second, "How often to check the drives for new discs")
+	configPaths := make([]string, 0)
+	addConfigPathFlag(flagSet, &configPaths)
+	audioStreamType := flagSet.String("audio-stream-type", "", "Audio stream type (best, surround71, surround51, stereo21, or stereo20)")
+	jobs := flagSet.Int("jobs", 1, "The number of tracks to process concurrently")
+	logOptions := addLogFlags(flagSet)
+
+	err := flagSet.Parse(args)
+	if err != nil {
+		return getFlagParseExitCode(err)
+	}
+
+	if *libraryRoot == "" || *pollInterval <= 0 {
+		printWatchUsage()
+		return 1
+	}
+
+	ripOptionsTemplate := getDefaultRipOptions()
+	ripOptionsTemplate.OutputDirectory = *libraryRoot
+	ripOptionsTemplate.ConfigPaths = configPaths
+	ripOptionsTemplate.AudioStreamType = *audioStreamType
+	ripOptionsTemplate.Jobs = *jobs
+
+	// Any disc ID will do here, since it's replaced for each disc
+	ripOptionsTemplate.MakemkvconDiscId = 0
+	_, err = checkRipOptions(ripOptionsTemplate)
+	if err != nil {
+		println(err.Error())
+		printWatchUsage()
+		return 1
+	}
+
+	ctx, logger, closeLogFile, err := setUpLogging(ctx, logOptions)
+	if err != nil {
+		println(err.Error())
+		printWatchUsage()
+		return 1
+	}
+	defer closeLogFile()
+
+	// Check the config up front, even though it's read again for each disc
+	_, err = loadConfig(logger, configPaths)
+	if err != nil {
+		return 1
+	}
+
+	logger.Info("Watching for discs", "library_root", *libraryRoot, "poll_interval", pollInterval.String())
+
+	watcher := newDriveWatcher()
+
+	pollTicker := time.NewTicker(*pollInterval)
+	defer pollTicker.Stop()
+
+	for {
+		drives, err := libbdaudiodump.GetMakemkvconDrives(ctx)
+		if err != nil && ctx.Err() == nil {
+			logError(logger, "Error listing drives", err)
+		}
+
+		for _, drive := range watcher.GetDrivesToRip(logger, drives) {
+			watcher.SetDriveHandled(drive.Index, ripInsertedDisc(ctx, logger, ripOptionsTemplate, drive))
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.Info("Stopped watching for discs")
+			return 0
+		case <-pollTicker.C:
+		}
+	}
+}
+
+// driveWatcher keeps track of the drives with a disc that's already been dealt with, so each disc
+// is only ripped once per insertion.  Discs that are in a drive when watching starts are left alone.
+type driveWatcher struct {
+	handledDrives map[int]bool
+	firstPoll     bool
+}
+
+func newDriveWatcher() *driveWatcher {
+	return &driveWatcher{
+		handledDrives: make(map[int]bool),
+		firstPoll:     true,
+	}
+}
+
+// GetDrivesToRip takes the drives from one poll and returns the ones with a newly inserted disc.
+// A drive stays unhandled until SetDriveHandled is called for it, so it's returned again by the
+// next poll if the disc couldn't be dealt with yet.
+func (watcher *driveWatcher) GetDrivesToRip(logger *slog.Logger, drives []libbdaudiodump.MakemkvconDrive) []libbdaudiodump.MakemkvconDrive {
+	drivesToRip := make([]libbdaudiodump.MakemkvconDrive, 0)
+
+	for _, drive := range drives {
+		if !drive.HasDisc() {
+			if watcher.handledDrives[drive.Index] {
+				logger.Info("Disc removed", "drive", drive.Index)
+			}
+			delete(watcher.handledDrives, drive.Index)
+			continue
+		}
+
+		if watcher.handledDrives[drive.Index] {
+			continue
+		}
+
+		if watcher.firstPoll {
+			logger.Info("Ignoring disc that was already in the drive", "drive", drive.Index, "disc_label", drive.DiscName)
+			watcher.handledDrives[drive.Index] = true
+			continue
+		}
+
+		drivesToRip = append(drivesToRip, drive)
+	}
+
+	watcher.firstPoll = false
+
+	return drivesToRip
+}
+
+func (watcher *driveWatcher) SetDriveHandled(driveIndex int, handled bool) {
+	if handled {
+		watcher.handledDrives[driveIndex] = true
+	} else {
+		delete(watcher.handledDrives, driveIndex)
+	}
+}
+
+// ripInsertedDisc identifies a newly inserted disc and rips it if it's in the config.  Rips run
+// one at a time, so makemkvcon isn't asked about the drives while it's reading one.  It returns
+// false if the disc isn't mounted yet, so it's tried again on the next poll.
+func ripInsertedDisc(ctx context.Context, logger *slog.Logger, ripOptionsTemplate ripOptions, drive libbdaudiodump.MakemkvconDrive) bool {
+	logger = logger.With("drive", drive.Index, "device", drive.DevicePath, "disc_label", drive.DiscName)
+
+	discMountPoint, err := libbdaudiodump.GetMountPointForDevice(ctx, drive.DevicePath)
+	if err != nil {
+		logger.Debug("Waiting for disc to be mounted", libbdaudiodump.LogKeyError, err.Error())
+		return false
+	}
+
+	logger.Info("Disc inserted", "path", discMountPoint)
+
+	discIdentifiers, err := libbdaudiodump.GetDiscIdentifiers(discMountPoint)
+	if err != nil {
+		logError(logger, "Error identifying disc", err)
+		return true
+	}
+
+	parsedConfig, err := loadConfig(logger, ripOptionsTemplate.ConfigPaths)
+	if err != nil {
+		return true
+	}
+
+	_, discIdentifier, err := libbdaudiodump.GetDiscConfigByIdentifiers(ctx, discIdentifiers, parsedConfig)
+	if errors.Is(err, libbdaudiodump.ErrUnknownDiscHash) {
+		identifierAttrs := make([]any, 0)
+		for _, discIdentifier := range discIdentifiers {
+			identifierAttrs = append(identifierAttrs, discIdentifier.Type, discIdentifier.Value)
+		}
+
+		logger.Warn("Disc isn't in the config, so it won't be ripped", identifierAttrs...)
+		return true
+	} else if err != nil {
+		logError(logger, "Error looking up disc in config", err)
+		return true
+	}
+
+	options := ripOptionsTemplate
+	options.MakemkvconDiscId = drive.Index
+	options.DiscBasePath = discMountPoint
+	options.VolumeKeySha1 = discIdentifier.Value
+
+	ripCtx := libbdaudiodump.WithLogger(ctx, logger)
+	ripCtx = libbdaudiodump.WithObserver(ripCtx, newRipObserver(logger, os.Stderr))
+
+	err = executeRip(ripCtx, options)
+	if err != nil {
+		logger.Error("Rip failed")
+		return true
+	}
+
+	logger.Info("Rip finished, disc can be removed")
+
+	return true
+}
+
+func printWatchUsage() {
+	println("Watches the drives and rips each known disc that's inserted")
+	println("")
+	println("Usage:")
+	println("bdaudiodump watch [arguments]")
+	println("")
+	println("Discs that aren't in the config are logged with their volume key SHA1")
+	println("hash, so a config entry can be written for them.  Discs that are already")
+	println("in a drive when watching starts are ignored until they're reinserted.")
+	println("")
+	println("--library-root")
+	println("    Type: String")
+	println("    The directory to rip discs into.  Required.")
+	println("--poll-interval")
+	println("    Type: Duration")
+	println("    How often to ask makemkvcon about the drives, such as 5s or 1m.")
+	println("    Defaults to 5s.")
+	println("--audio-stream-type")
+	println("    Type: String")
+	println("    The audio stream type to use for every disc.  Valid values are best,")
+	println("    surround71, surround51, stereo21, and stereo20.")
+	println("--jobs")
+	println("    Type: Integer")
+	println("    The number of tracks to process concurrently.  Defaults to 1.")
+	printConfigUsage()
+	printLogUsage()
+}
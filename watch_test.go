@@ -0,0 +1,98 @@
+/*
+   Copyright 2023, Christopher Gelatt
+
+   This file is part of bdaudiodump.
+
+   bdaudiodump is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   bdaudiodump is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with bdaudiodump.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bdaudiodump/libbdaudiodump"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestDriveWatcherGetDrivesToRip(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake makemkvcon is a shell script")
+	}
+
+	testdataPath, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", testdataPath+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	watcher := newDriveWatcher()
+
+	polls := []struct {
+		name                 string
+		drive0State          int
+		drive1State          int
+		drive0Handled        bool
+		expectedDriveIndexes []int
+	}{
+		{name: "disc already inserted when watching starts", drive0State: libbdaudiodump.MakemkvconDriveStateInserted, expectedDriveIndexes: []int{}},
+		{name: "disc left in the drive", drive0State: libbdaudiodump.MakemkvconDriveStateInserted, expectedDriveIndexes: []int{}},
+		{name: "drive opened", drive0State: libbdaudiodump.MakemkvconDriveStateEmptyOpen, expectedDriveIndexes: []int{}},
+		{name: "disc loading", drive0State: libbdaudiodump.MakemkvconDriveStateLoading, expectedDriveIndexes: []int{}},
+		{name: "disc inserted but not mounted yet", drive0State: libbdaudiodump.MakemkvconDriveStateInserted, drive0Handled: false, expectedDriveIndexes: []int{0}},
+		{name: "disc mounted", drive0State: libbdaudiodump.MakemkvconDriveStateInserted, drive0Handled: true, expectedDriveIndexes: []int{0}},
+		{name: "disc ripped", drive0State: libbdaudiodump.MakemkvconDriveStateInserted, expectedDriveIndexes: []int{}},
+		{name: "disc inserted in the other drive", drive0State: libbdaudiodump.MakemkvconDriveStateInserted, drive1State: libbdaudiodump.MakemkvconDriveStateInserted, expectedDriveIndexes: []int{1}},
+		{name: "disc ejected", drive0State: libbdaudiodump.MakemkvconDriveStateEmptyClosed, drive1State: libbdaudiodump.MakemkvconDriveStateInserted, expectedDriveIndexes: []int{}},
+		{name: "disc reinserted", drive0State: libbdaudiodump.MakemkvconDriveStateInserted, drive1State: libbdaudiodump.MakemkvconDriveStateInserted, drive0Handled: true, expectedDriveIndexes: []int{0}},
+		{name: "reinserted disc ripped", drive0State: libbdaudiodump.MakemkvconDriveStateInserted, drive1State: libbdaudiodump.MakemkvconDriveStateInserted, expectedDriveIndexes: []int{}},
+	}
+
+	for _, poll := range polls {
+		t.Setenv("FAKE_MAKEMKVCON_DRIVE0", strconv.Itoa(poll.drive0State))
+		t.Setenv("FAKE_MAKEMKVCON_DRIVE1", strconv.Itoa(poll.drive1State))
+
+		drives, err := libbdaudiodump.GetMakemkvconDrives(context.Background())
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", poll.name, err)
+		}
+
+		if len(drives) != 2 {
+			t.Fatalf("%s: expected 2 drives, got %+v", poll.name, drives)
+		}
+
+		driveIndexes := make([]int, 0)
+		for _, drive := range watcher.GetDrivesToRip(logger, drives) {
+			driveIndexes = append(driveIndexes, drive.Index)
+
+			// Stand in for ripInsertedDisc, which says whether the disc was dealt with
+			if drive.Index == 0 {
+				watcher.SetDriveHandled(drive.Index, poll.drive0Handled)
+			} else {
+				watcher.SetDriveHandled(drive.Index, true)
+			}
+		}
+
+		if !reflect.DeepEqual(driveIndexes, poll.expectedDriveIndexes) {
+			t.Errorf("%s: got drives %v to rip, expected %v", poll.name, driveIndexes, poll.expectedDriveIndexes)
+		}
+	}
+}